@@ -2,14 +2,17 @@ package main
 
 import (
 	"auth/config"
+	"auth/internal/entity"
 	"auth/internal/http"
 	"auth/internal/repository"
+	"auth/internal/repository/memory"
 	"auth/internal/repository/mongodb"
 	"auth/internal/repository/postgres"
 	"auth/internal/service"
 	"auth/internal/usecase"
 	"auth/pkg/logger"
 	"os"
+	"time"
 )
 
 func main() {
@@ -34,6 +37,34 @@ func main() {
 	}
 
 	userRepoPostgres := postgres.NewUserPostgres(pool)
+	refreshTokenRepo := postgres.NewRefreshTokenPostgres(pool)
+	passwordResetRepo := postgres.NewPasswordResetPostgres(pool)
+	loginAttemptRepo := postgres.NewLoginAttemptPostgres(pool)
+	mfaRepo := postgres.NewMFAPostgres(pool)
+	webAuthnCredentialRepo := postgres.NewWebAuthnCredentialPostgres(pool)
+	identityRepo := postgres.NewIdentityPostgres(pool)
+	oauthClientRepo := postgres.NewOAuthClientPostgres(pool)
+	authorizationCodeRepo := postgres.NewAuthorizationCodePostgres(pool)
+	oauthConsentRepo := postgres.NewOAuthConsentPostgres(pool)
+	apiKeyRepo := postgres.NewAPIKeyPostgres(pool)
+	sessionRepo := postgres.NewSessionPostgres(pool)
+	reportClaimRepo := postgres.NewReportClaimPostgres(pool)
+	walletRepo := postgres.NewWalletPostgres(pool)
+	idempotencyRepo := postgres.NewIdempotencyPostgres(pool)
+	paymentRepo := postgres.NewPaymentPostgres(pool)
+	promoCodeRepo := postgres.NewPromoCodePostgres(pool)
+
+	var denylist entity.TokenDenylist
+	switch cfg.Auth.DenylistStore {
+	case "memory":
+		denylist = memory.NewDenylist()
+	case "postgres":
+		denylist = postgres.NewDenylistPostgres(pool)
+	default:
+		logger.Logger.Fatal().Str("store", cfg.Auth.DenylistStore).Msg("unknown denylist store")
+	}
+	go pruneDenylist(denylist, cfg.Auth.DenylistPruneInterval)
+	go pruneIdempotencyKeys(idempotencyRepo, cfg.Idempotency.PruneInterval)
 
 	// MongoDB
 	mongoClient, err := mongodb.NewMongoClient(cfg.Database)
@@ -44,12 +75,117 @@ func main() {
 	reportRepoMongo := mongodb.NewReportMongo(mongoClient.Database(cfg.Database.Mongo.Name))
 
 	// Services & Usecases
-	jwtService := service.NewJWTService(cfg.Auth.JWTSecret)
-	userUC := usecase.NewUserUsecase(userRepoPostgres, reportRepoMongo, jwtService)
-	reportUC := usecase.NewReportUsecase(reportRepoMongo, userRepoPostgres)
+	signingKeys, err := service.LoadKeySet(cfg.Auth)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("failed to load JWT signing keys")
+	}
+	jwtService := service.NewJWTService(signingKeys, cfg.Auth)
+
+	mailer, err := service.NewMailer(cfg.Mail)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("failed to create mailer")
+	}
+
+	reportPrice, err := entity.ParseMoney(cfg.Reports.Price, cfg.Reports.Currency)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("invalid reports.price")
+	}
+	maxTopUp, err := entity.ParseMoney(cfg.Payments.MaxTopUp, cfg.Reports.Currency)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("invalid payments.max_top_up")
+	}
+
+	rates, err := service.NewRateProvider(cfg.ExchangeRates)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("failed to load exchange rates")
+	}
+
+	paymentProvider, err := service.NewPaymentProvider(cfg.Payments)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("failed to configure payment provider")
+	}
+
+	webAuthn, err := service.NewWebAuthn(cfg.Auth.WebAuthn)
+	if err != nil {
+		logger.Logger.Fatal().Err(err).Msg("failed to configure passkeys")
+	}
+
+	verificationUC := usecase.NewVerificationUsecase(userRepoPostgres, jwtService, mailer,
+		cfg.Auth.EmailVerificationTTL, cfg.Auth.VerificationResendInterval, cfg.PublicURL)
+	mfaUC := usecase.NewMFAUsecase(mfaRepo, userRepoPostgres, cfg.Auth.MFA.Issuer)
+	webAuthnUC := usecase.NewWebAuthnUsecase(webAuthnCredentialRepo, userRepoPostgres, jwtService, denylist,
+		webAuthn, cfg.Auth.WebAuthn.CeremonyTTL)
+	oauthUC := usecase.NewOAuthUsecase(service.NewOIDCProviders(cfg.OAuth.Providers, cfg.PublicURL), identityRepo,
+		userRepoPostgres, jwtService, verificationUC, cfg.OAuth.StateTTL)
+	loginLimiter := service.NewLoginLimiter(loginAttemptRepo, cfg.Auth.LoginProtection)
+	userUC := usecase.NewUserUsecase(userRepoPostgres, reportRepoMongo, refreshTokenRepo, sessionRepo, denylist, jwtService,
+		verificationUC, mfaUC, webAuthnUC, oauthUC, loginLimiter, cfg.Auth.RefreshTokenTTL)
+	reportUC := usecase.NewReportUsecase(reportRepoMongo, reportClaimRepo, walletRepo, promoCodeRepo, rates, reportPrice)
+	go resumePurchases(reportUC, cfg.Reports.PurchaseRetryInterval)
+	apiKeyUC := usecase.NewAPIKeyUsecase(apiKeyRepo, userRepoPostgres)
+	promoCodeUC := usecase.NewPromoCodeUsecase(promoCodeRepo)
+	walletUC := usecase.NewWalletUsecase(walletRepo, paymentRepo, paymentProvider, rates, maxTopUp)
+	passwordUC := usecase.NewPasswordUsecase(userRepoPostgres, passwordResetRepo, userUC, mailer, loginAttemptRepo,
+		cfg.Auth.PasswordResetTTL, cfg.Auth.PasswordResetInterval, cfg.Auth.PasswordResetMaxPerIP,
+		cfg.Auth.PasswordResetIPWindow, cfg.PublicURL)
+
+	var oauthServerUC usecase.OAuthServerUsecase
+	if idp := cfg.Auth.IdentityProvider; idp.Enabled {
+		// clients verify ID tokens with our JWKS, a shared secret cannot be published
+		if jwtService.SigningAlgorithm() == "HS256" {
+			logger.Logger.Fatal().Msg("identity provider requires asymmetric signing_keys")
+		}
+		oauthServerUC = usecase.NewOAuthServerUsecase(oauthClientRepo, authorizationCodeRepo, oauthConsentRepo,
+			refreshTokenRepo, userRepoPostgres, denylist, jwtService,
+			idp.Issuer, idp.AuthorizationCodeTTL, idp.ConsentTTL, cfg.Auth.RefreshTokenTTL)
+	}
 
 	// Start HTTP server
-	if err := http.StartServer(cfg, userUC, reportUC); err != nil {
+	usecases := http.Usecases{
+		User:         userUC,
+		Report:       reportUC,
+		Password:     passwordUC,
+		Verification: verificationUC,
+		MFA:          mfaUC,
+		WebAuthn:     webAuthnUC,
+		OAuth:        oauthUC,
+		APIKey:       apiKeyUC,
+		Wallet:       walletUC,
+		PromoCode:    promoCodeUC,
+		OAuthServer:  oauthServerUC,
+	}
+	if err := http.StartServer(cfg, usecases, jwtService, denylist, idempotencyRepo); err != nil {
 		logger.Logger.Fatal().Err(err).Msg("failed to start server")
 	}
 }
+
+func pruneDenylist(denylist entity.TokenDenylist, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := denylist.PruneExpired(); err != nil {
+			logger.Logger.Error().Err(err).Msg("failed to prune token denylist")
+		}
+	}
+}
+
+func pruneIdempotencyKeys(repo entity.IdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := repo.PruneExpired(); err != nil {
+			logger.Logger.Error().Err(err).Msg("failed to prune idempotency keys")
+		}
+	}
+}
+
+func resumePurchases(reports usecase.ReportUsecase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// purchases younger than an interval may still be in flight
+		if err := reports.ResumePendingPurchases(time.Now().Add(-interval)); err != nil {
+			logger.Logger.Error().Err(err).Msg("failed to resume pending purchases")
+		}
+	}
+}
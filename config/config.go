@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -29,14 +31,150 @@ type DatabaseConfig struct {
 	Mongo    MongoConfig    `yaml:"mongo"`
 }
 
+type SigningKeyConfig struct {
+	Kid       string `yaml:"kid"`
+	Algorithm string `yaml:"alg"` // RS256 or EdDSA
+	// retired keys may be given by their public key only
+	PrivateKeyPath string `yaml:"private_key_path"`
+	PublicKeyPath  string `yaml:"public_key_path"`
+}
+
 type AuthConfig struct {
 	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" env-default:"mysecretkey"`
+	// when signing keys are set, jwt_secret is no longer used
+	SigningKeys                []SigningKeyConfig `yaml:"signing_keys"`
+	ActiveKeyID                string             `yaml:"active_kid" env:"JWT_ACTIVE_KID"`
+	Issuer                     string             `yaml:"issuer" env:"JWT_ISSUER" env-default:"freeze-auth"`
+	Audience                   string             `yaml:"audience" env:"JWT_AUDIENCE" env-default:"freeze-api"`
+	ClockSkew                  time.Duration      `yaml:"clock_skew" env:"JWT_CLOCK_SKEW" env-default:"30s"`
+	AccessTokenTTL             time.Duration      `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" env-default:"15m"`
+	RefreshTokenTTL            time.Duration      `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" env-default:"720h"`
+	PasswordResetTTL           time.Duration      `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" env-default:"30m"`
+	PasswordResetInterval      time.Duration      `yaml:"password_reset_interval" env:"PASSWORD_RESET_INTERVAL" env-default:"2m"`
+	PasswordResetMaxPerIP      int                `yaml:"password_reset_max_per_ip" env:"PASSWORD_RESET_MAX_PER_IP" env-default:"10"`
+	PasswordResetIPWindow      time.Duration      `yaml:"password_reset_ip_window" env:"PASSWORD_RESET_IP_WINDOW" env-default:"1h"`
+	EmailVerificationTTL       time.Duration      `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL" env-default:"48h"`
+	VerificationResendInterval time.Duration      `yaml:"verification_resend_interval" env:"VERIFICATION_RESEND_INTERVAL" env-default:"2m"`
+	// full: unverified users may use everything; limited: only login, profile
+	// and resending the verification mail
+	UnverifiedAccess string `yaml:"unverified_access" env:"UNVERIFIED_ACCESS" env-default:"limited"`
+	// memory or postgres
+	DenylistStore         string        `yaml:"denylist_store" env:"DENYLIST_STORE" env-default:"postgres"`
+	DenylistPruneInterval time.Duration `yaml:"denylist_prune_interval" env:"DENYLIST_PRUNE_INTERVAL" env-default:"10m"`
+
+	LoginProtection LoginProtectionConfig `yaml:"login_protection"`
+	MFA             MFAConfig             `yaml:"mfa"`
+	WebAuthn        WebAuthnConfig        `yaml:"webauthn"`
+	// this service as an OpenID Connect provider for our other apps
+	IdentityProvider IdentityProviderConfig `yaml:"identity_provider"`
+}
+
+type IdentityProviderConfig struct {
+	// needs asymmetric signing keys, clients cannot verify HS256 ID tokens
+	Enabled bool `yaml:"enabled" env:"IDP_ENABLED" env-default:"false"`
+	// issuer URL of ID tokens and the discovery document, no trailing slash
+	Issuer               string        `yaml:"issuer" env:"IDP_ISSUER" env-default:"http://localhost:8083"`
+	AuthorizationCodeTTL time.Duration `yaml:"authorization_code_ttl" env:"IDP_AUTHORIZATION_CODE_TTL" env-default:"1m"`
+	ConsentTTL           time.Duration `yaml:"consent_ttl" env:"IDP_CONSENT_TTL" env-default:"10m"`
+}
+
+type WebAuthnConfig struct {
+	// RPID is the domain passkeys are bound to, IP addresses are not allowed
+	RPID          string `yaml:"rp_id" env:"WEBAUTHN_RP_ID" env-default:"localhost"`
+	RPDisplayName string `yaml:"rp_display_name" env:"WEBAUTHN_RP_DISPLAY_NAME" env-default:"Freeze"`
+	// origins the login page is served from
+	RPOrigins   []string      `yaml:"rp_origins" env:"WEBAUTHN_RP_ORIGINS" env-separator:"," env-default:"http://localhost:8083"`
+	CeremonyTTL time.Duration `yaml:"ceremony_ttl" env:"WEBAUTHN_CEREMONY_TTL" env-default:"5m"`
+}
+
+type MFAConfig struct {
+	// shown in authenticator apps
+	Issuer string `yaml:"issuer" env:"MFA_ISSUER" env-default:"freeze"`
+	// holders of these roles only get their permissions after a second factor
+	RequiredRoles []string `yaml:"required_roles" env:"MFA_REQUIRED_ROLES" env-separator:"," env-default:"admin,support"`
+}
+
+type LoginProtectionConfig struct {
+	MaxAccountFailures int           `yaml:"max_account_failures" env:"LOGIN_MAX_ACCOUNT_FAILURES" env-default:"5"`
+	MaxIPFailures      int           `yaml:"max_ip_failures" env:"LOGIN_MAX_IP_FAILURES" env-default:"20"`
+	FailureWindow      time.Duration `yaml:"failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"15m"`
+	BaseLockout        time.Duration `yaml:"base_lockout" env:"LOGIN_BASE_LOCKOUT" env-default:"30s"`
+	MaxLockout         time.Duration `yaml:"max_lockout" env:"LOGIN_MAX_LOCKOUT" env-default:"1h"`
+}
+
+type MailConfig struct {
+	Driver   string `yaml:"driver" env:"MAIL_DRIVER" env-default:"log"` // smtp or log
+	Host     string `yaml:"host" env:"SMTP_HOST" env-default:"localhost"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" env-default:"587"`
+	User     string `yaml:"user" env:"SMTP_USER"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string `yaml:"from" env:"MAIL_FROM" env-default:"no-reply@localhost"`
+	// log driver only: append mails to this file instead of the application log
+	LogFile string `yaml:"log_file" env:"MAIL_LOG_FILE"`
 }
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server_config"`
-	Database DatabaseConfig `yaml:"database"`
-	Auth     AuthConfig     `yaml:"auth"`
+	Server ServerConfig `yaml:"server_config"`
+	// base URL used in links sent to users
+	PublicURL string `yaml:"public_url" env:"PUBLIC_URL" env-default:"http://localhost:8080"`
+	// take the client IP from X-Forwarded-For, only behind a trusted proxy
+	TrustProxy  bool              `yaml:"trust_proxy" env:"TRUST_PROXY" env-default:"false"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Mail        MailConfig        `yaml:"mail"`
+	OAuth       OAuthConfig       `yaml:"oauth"`
+	Reports     ReportsConfig     `yaml:"reports"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Payments    PaymentsConfig    `yaml:"payments"`
+	// rates for paying from a wallet in another currency than the price
+	ExchangeRates ExchangeRatesConfig `yaml:"exchange_rates"`
+}
+
+type ExchangeRatesConfig struct {
+	Provider string `yaml:"provider" env:"EXCHANGE_RATE_PROVIDER" env-default:"static"`
+	// static provider only
+	File string `yaml:"file" env:"EXCHANGE_RATES_FILE" env-default:"rates.yaml"`
+}
+
+type PaymentsConfig struct {
+	Provider      string `yaml:"provider" env:"PAYMENT_PROVIDER" env-default:"fake"`
+	WebhookSecret string `yaml:"webhook_secret" env:"PAYMENT_WEBHOOK_SECRET"`
+	// webhooks signed longer ago than this are rejected as replays
+	WebhookTolerance time.Duration `yaml:"webhook_tolerance" env:"PAYMENT_WEBHOOK_TOLERANCE" env-default:"5m"`
+	// in major units of reports.currency
+	MaxTopUp string `yaml:"max_top_up" env:"PAYMENT_MAX_TOP_UP" env-default:"100000"`
+}
+
+type IdempotencyConfig struct {
+	// how long a response is replayed to retries with the same Idempotency-Key
+	Retention     time.Duration `yaml:"retention" env:"IDEMPOTENCY_RETENTION" env-default:"24h"`
+	PruneInterval time.Duration `yaml:"prune_interval" env:"IDEMPOTENCY_PRUNE_INTERVAL" env-default:"1h"`
+}
+
+type ReportsConfig struct {
+	// price of a new report, clients cannot set it
+	// in major units, e.g. "99.90"
+	Price string `yaml:"price" env:"REPORT_PRICE" env-default:"100"`
+	// ISO 4217 code of report prices and wallets
+	Currency string `yaml:"currency" env:"REPORT_CURRENCY" env-default:"RUB"`
+	// how often interrupted purchases are finished or refunded
+	PurchaseRetryInterval time.Duration `yaml:"purchase_retry_interval" env:"REPORT_PURCHASE_RETRY_INTERVAL" env-default:"1m"`
+}
+
+type OAuthConfig struct {
+	// how long the user may take at the provider before the callback
+	StateTTL  time.Duration        `yaml:"state_ttl" env:"OAUTH_STATE_TTL" env-default:"10m"`
+	Providers []OIDCProviderConfig `yaml:"providers"`
+}
+
+// OIDCProviderConfig is an OpenID Connect provider used for social login. The
+// redirect URI to register with it is <public_url>/oauth/<name>/callback.
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name"`
+	IssuerURL    string   `yaml:"issuer_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
 }
 
 func LoadConfig(configPath string) (*Config, error) {
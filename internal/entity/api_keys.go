@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes a personal API key can be limited to, on top of the permissions.
+const (
+	ScopeAccountRead  = "account:read"
+	ScopeAccountWrite = "account:write"
+	ScopeReportsRead  = "reports:read"
+	ScopeReportsWrite = "reports:write"
+)
+
+// IsValidAPIKeyScope accepts the scopes above and permission names.
+func IsValidAPIKeyScope(scope string) bool {
+	switch scope {
+	case ScopeAccountRead, ScopeAccountWrite, ScopeReportsRead, ScopeReportsWrite:
+		return true
+	}
+	for _, perms := range rolePermissions {
+		if slices.Contains(perms, Permission(scope)) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey is a personal key for scripts. Like refresh tokens only the hash is
+// stored; Prefix is kept so users can tell their keys apart.
+type APIKey struct {
+	ID      uuid.UUID `json:"id"`
+	UserID  uuid.UUID `json:"-"`
+	Name    string    `json:"name"`
+	Prefix  string    `json:"prefix"`
+	KeyHash string    `json:"-"`
+	// empty means everything the user can do
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type APIKeyRepository interface {
+	Create(key *APIKey) error
+	GetByHash(keyHash string) (*APIKey, error)
+	ListByUser(userID uuid.UUID) ([]*APIKey, error)
+	Revoke(userID, id uuid.UUID) error
+	// TouchLastUsed skips the write when last_used_at is newer than notBefore
+	TouchLastUsed(id uuid.UUID, at, notBefore time.Time) error
+}
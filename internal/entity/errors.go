@@ -0,0 +1,11 @@
+package entity
+
+import "errors"
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the row was changed by someone else since it was read.
+	ErrConflict = errors.New("conflict")
+	// ErrEmailTaken means another account already uses the address.
+	ErrEmailTaken = errors.New("email is already taken")
+)
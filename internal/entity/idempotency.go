@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// IdempotencyRecord is the outcome of a request made with an Idempotency-Key.
+// Keys are scoped per user; anonymous requests are scoped by their own
+// fingerprint, so clients sharing a key never see each other's responses.
+// StatusCode is 0 while the first request with the key is still running.
+type IdempotencyRecord struct {
+	Scope string
+	Key   string
+	// hash of method, path and body, a key may not be reused for another request
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	// Set-Cookie values, only kept for routes whose response signs the client in
+	Cookies   []string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type IdempotencyRepository interface {
+	// Reserve stores the record if its key is free (or expired) and returns
+	// nil, otherwise it returns the record already holding the key.
+	Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error)
+	// Complete saves the response of a reserved record
+	Complete(record *IdempotencyRecord) error
+	// Release frees a reserved key so the request can be retried
+	Release(scope, key string) error
+	PruneExpired() error
+}
@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalIdentity links an account at an OpenID Connect provider (provider +
+// subject) to a local user.
+type ExternalIdentity struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"-"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityRepository interface {
+	GetByProviderSubject(provider, subject string) (*ExternalIdentity, error)
+	// Create returns ErrConflict when the identity is already linked
+	Create(identity *ExternalIdentity) error
+	ListByUser(userID uuid.UUID) ([]*ExternalIdentity, error)
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// LoginAttemptRepository counts failed logins per key (an account or a client
+// IP). A key's failures start over once the last one is older than the window.
+type LoginAttemptRepository interface {
+	RecordFailure(key string, window time.Duration) (int, error)
+	LockUntil(key string, until time.Time) error
+	LockedUntil(key string) (*time.Time, error)
+	Reset(key string) error
+}
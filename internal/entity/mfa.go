@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Authentication methods recorded in the amr claim (RFC 8176).
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRHardwareKey = "hwk"
+	// AMRFederated is not registered in RFC 8176: login at an external provider
+	AMRFederated = "fed"
+	// AMRMultiFactor marks sessions that passed more than one factor
+	AMRMultiFactor = "mfa"
+)
+
+type TOTPEnrollment struct {
+	UserID       uuid.UUID
+	Secret       string
+	Enabled      bool
+	CreatedAt    time.Time
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+type MFARepository interface {
+	GetTOTP(userID uuid.UUID) (*TOTPEnrollment, error)
+	// SaveTOTP replaces an enrollment that has not been confirmed yet
+	SaveTOTP(enrollment *TOTPEnrollment) error
+	EnableTOTP(userID uuid.UUID) error
+	DeleteTOTP(userID uuid.UUID) error
+	// UseTOTPStep fails when the step (or a later one) was already accepted
+	UseTOTPStep(userID uuid.UUID, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error
+	UseRecoveryCode(userID uuid.UUID, codeHash string) (bool, error)
+}
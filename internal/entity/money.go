@@ -0,0 +1,133 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+
+// Money is an amount in minor units (kopecks, cents) of an ISO 4217 currency.
+// Amounts of different currencies are never added or compared.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// digits after the decimal point of the currencies we accept
+var currencyExponents = map[string]int{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CNY": 2,
+	"KZT": 2,
+	"BYN": 2,
+	"JPY": 0,
+}
+
+func IsValidCurrency(currency string) bool {
+	_, ok := currencyExponents[currency]
+	return ok
+}
+
+// ParseMoney reads a decimal amount in major units, e.g. "100" or "99.90".
+func ParseMoney(amount, currency string) (Money, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+
+	units, fraction, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%s has at most %d decimal places", currency, exponent)
+	}
+	digits := units + fraction + strings.Repeat("0", exponent-len(fraction))
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || strings.Trim(units, "+-") == "" || strings.ContainsAny(fraction, "+-") {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Cmp returns -1, 0 or 1 like cmp.Compare.
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String formats the amount in major units, e.g. "99.90 RUB".
+func (m Money) String() string {
+	exponent := currencyExponents[m.Currency]
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := fmt.Sprintf("%0*d", exponent+1, amount)
+	if exponent == 0 {
+		return sign + digits + " " + m.Currency
+	}
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:] + " " + m.Currency
+}
+
+// Exchange records the conversion applied when an amount was paid in another
+// currency than it was priced in.
+type Exchange struct {
+	// units of the paid currency per unit of Original's, as a decimal
+	Rate     string `json:"rate"`
+	Original Money  `json:"original"`
+}
+
+// Convert returns m in currency at rate (units of currency per unit of m's
+// currency), rounded half away from zero to the minor unit.
+func (m Money) Convert(currency, rate string) (Money, error) {
+	toExponent, ok := currencyExponents[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return Money{}, fmt.Errorf("invalid exchange rate %q", rate)
+	}
+
+	value := new(big.Rat).SetInt64(m.Amount)
+	value.Mul(value, r)
+	value.Mul(value, new(big.Rat).SetFrac(pow10(toExponent), pow10(currencyExponents[m.Currency])))
+
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Abs(remainder).Lsh(remainder, 1).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return Money{}, fmt.Errorf("amount out of range")
+	}
+	return Money{Amount: quotient.Int64(), Currency: currency}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,120 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"100", "RUB", Money{10000, "RUB"}, false},
+		{"99.90", "RUB", Money{9990, "RUB"}, false},
+		{"99.9", "RUB", Money{9990, "RUB"}, false},
+		{" 0.01 ", "USD", Money{1, "USD"}, false},
+		{"-5.50", "EUR", Money{-550, "EUR"}, false},
+		{"500", "JPY", Money{500, "JPY"}, false},
+		{"500.5", "JPY", Money{}, true},
+		{"1.001", "RUB", Money{}, true},
+		{"", "RUB", Money{}, true},
+		{".5", "RUB", Money{}, true},
+		{"1.-5", "RUB", Money{}, true},
+		{"abc", "RUB", Money{}, true},
+		{"100", "XXX", Money{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.amount, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoney(%q, %q) error = %v, wantErr %v", tt.amount, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q, %q) = %v, want %v", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{9990, "RUB"}, "99.90 RUB"},
+		{Money{5, "USD"}, "0.05 USD"},
+		{Money{-150, "EUR"}, "-1.50 EUR"},
+		{Money{0, "RUB"}, "0.00 RUB"},
+		{Money{1500, "JPY"}, "1500 JPY"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyAddCmp(t *testing.T) {
+	sum, err := Money{100, "RUB"}.Add(Money{-30, "RUB"})
+	if err != nil || sum != (Money{70, "RUB"}) {
+		t.Errorf("Add = %v, %v, want 70 RUB", sum, err)
+	}
+	if _, err := (Money{100, "RUB"}).Add(Money{100, "USD"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies error = %v, want ErrCurrencyMismatch", err)
+	}
+
+	tests := []struct {
+		a, b Money
+		want int
+	}{
+		{Money{1, "RUB"}, Money{2, "RUB"}, -1},
+		{Money{2, "RUB"}, Money{2, "RUB"}, 0},
+		{Money{3, "RUB"}, Money{2, "RUB"}, 1},
+	}
+	for _, tt := range tests {
+		if got, err := tt.a.Cmp(tt.b); err != nil || got != tt.want {
+			t.Errorf("%v.Cmp(%v) = %d, %v, want %d", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+	if _, err := (Money{1, "RUB"}).Cmp(Money{1, "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp across currencies error = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		money    Money
+		currency string
+		rate     string
+		want     Money
+		wantErr  bool
+	}{
+		{"exact", Money{10000, "RUB"}, "USD", "0.01", Money{100, "USD"}, false},
+		{"rounds down", Money{10000, "RUB"}, "USD", "0.010104", Money{101, "USD"}, false},
+		{"half rounds up", Money{50, "RUB"}, "USD", "0.01", Money{1, "USD"}, false},
+		{"half away from zero", Money{-50, "RUB"}, "USD", "0.01", Money{-1, "USD"}, false},
+		{"below half", Money{49, "RUB"}, "USD", "0.01", Money{0, "USD"}, false},
+		{"fraction rate", Money{100, "USD"}, "RUB", "1/3", Money{33, "RUB"}, false},
+		{"to zero exponent", Money{12345, "USD"}, "JPY", "150", Money{18518, "JPY"}, false},
+		{"from zero exponent", Money{1000, "JPY"}, "USD", "0.0066", Money{660, "USD"}, false},
+		{"unknown currency", Money{100, "RUB"}, "XXX", "1", Money{}, true},
+		{"zero rate", Money{100, "RUB"}, "USD", "0", Money{}, true},
+		{"negative rate", Money{100, "RUB"}, "USD", "-1", Money{}, true},
+		{"garbage rate", Money{100, "RUB"}, "USD", "abc", Money{}, true},
+		{"out of range", Money{1 << 62, "RUB"}, "USD", "100", Money{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.money.Convert(tt.currency, tt.rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Convert error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Convert = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuth 2.0 grant types supported for registered clients.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthClient is an application that logs users in through this service.
+// Public clients (SPAs, mobile apps) have no secret and must use PKCE.
+type OAuthClient struct {
+	ID           string   `json:"client_id"`
+	SecretHash   string   `json:"-"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	// first-party apps skip the consent screen
+	Trusted   bool      `json:"trusted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+type OAuthClientRepository interface {
+	Create(client *OAuthClient) error
+	GetByID(clientID string) (*OAuthClient, error)
+	List() ([]*OAuthClient, error)
+	Delete(clientID string) error
+}
+
+// AuthorizationCode is single use; FamilyID is the refresh token family the
+// code is redeemed into, so a replayed code can revoke what it issued.
+type AuthorizationCode struct {
+	CodeHash    string
+	ClientID    string
+	UserID      uuid.UUID
+	FamilyID    uuid.UUID
+	RedirectURI string
+	// the client sent redirect_uri to /authorize, so it must send it again
+	RedirectURIExplicit bool
+	Scopes              []string
+	Nonce               string
+	CodeChallenge       string
+	AMR                 []string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+}
+
+type AuthorizationCodeRepository interface {
+	Create(code *AuthorizationCode) error
+	// Consume marks the code of clientID used; fresh is false when it had been
+	// used before. Codes of other clients are ErrNotFound and left untouched.
+	Consume(codeHash, clientID string) (code *AuthorizationCode, fresh bool, err error)
+}
+
+type OAuthConsent struct {
+	UserID    uuid.UUID
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+type OAuthConsentRepository interface {
+	Get(userID uuid.UUID, clientID string) (*OAuthConsent, error)
+	// Grant adds scopes to what the user already granted the client
+	Grant(userID uuid.UUID, clientID string, scopes []string) error
+}
@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// payment intent statuses
+const (
+	PaymentPending   = "pending"
+	PaymentSucceeded = "succeeded"
+	PaymentFailed    = "failed"
+)
+
+// PaymentIntent is a top-up the user started at a payment provider. The wallet
+// is only credited once the provider confirms it through the webhook.
+type PaymentIntent struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"-"`
+	Amount Money     `json:"amount"`
+	// payment provider and its ID for the payment, set once it is created there
+	Provider  string    `json:"provider"`
+	Reference string    `json:"-"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PaymentRepository interface {
+	Create(intent *PaymentIntent) error
+	SetReference(id uuid.UUID, reference string) error
+	GetByReference(provider, reference string) (*PaymentIntent, error)
+	// Succeed credits the wallet and marks the intent succeeded in one
+	// transaction. It returns false if the intent was no longer pending, so
+	// repeated webhooks credit the wallet only once.
+	Succeed(id uuid.UUID) (bool, error)
+	Fail(id uuid.UUID) (bool, error)
+}
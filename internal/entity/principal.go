@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Roles    []string  `json:"roles"`
+
+	EmailVerified bool `json:"email_verified"`
+	// MFARequired is set when privileged roles were withheld because the
+	// session was not authenticated with a second factor
+	MFARequired bool `json:"mfa_required,omitempty"`
+
+	// set when the request was authenticated with a personal API key
+	APIKeyID *uuid.UUID `json:"api_key_id,omitempty"`
+	// Scopes restrict an API key, nil means no restriction
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
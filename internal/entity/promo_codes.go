@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrPromoCodeUnavailable is returned when a code ran out of redemptions,
+// overall or for the user, or expired by the time it was redeemed.
+var ErrPromoCodeUnavailable = errors.New("promo code is no longer available")
+
+// kinds of promo codes
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+// PromoCode discounts report purchases, either by Percent of the price or by a
+// fixed Amount (only on prices in the same currency).
+type PromoCode struct {
+	ID      uuid.UUID `json:"id"`
+	Code    string    `json:"code"`
+	Kind    string    `json:"kind"`
+	Percent int       `json:"percent,omitempty"`
+	Amount  *Money    `json:"amount,omitempty"`
+	// report categories the code applies to, empty means all
+	Categories []string   `json:"categories"`
+	ValidFrom  time.Time  `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	// 0 means unlimited
+	MaxRedemptions int       `json:"max_redemptions"`
+	PerUserLimit   int       `json:"per_user_limit"`
+	Redemptions    int       `json:"redemptions"`
+	CreatedBy      uuid.UUID `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (p *PromoCode) ActiveAt(t time.Time) bool {
+	return !t.Before(p.ValidFrom) && (p.ValidUntil == nil || t.Before(*p.ValidUntil))
+}
+
+func (p *PromoCode) AppliesTo(category string) bool {
+	return len(p.Categories) == 0 || slices.Contains(p.Categories, category)
+}
+
+// Discount returns how much the code takes off price, never more than the
+// price itself.
+func (p *PromoCode) Discount(price Money) (Money, error) {
+	discount := Money{Currency: price.Currency}
+	switch p.Kind {
+	case PromoPercent:
+		// rounded half up to the minor unit
+		discount.Amount = (price.Amount*int64(p.Percent) + 50) / 100
+	case PromoFixed:
+		if p.Amount == nil || p.Amount.Currency != price.Currency {
+			return Money{}, ErrCurrencyMismatch
+		}
+		discount.Amount = p.Amount.Amount
+	}
+	discount.Amount = min(discount.Amount, price.Amount)
+	return discount, nil
+}
+
+type PromoCodeRepository interface {
+	// Create returns ErrConflict if the code is taken
+	Create(code *PromoCode) error
+	GetByCode(code string) (*PromoCode, error)
+	List() ([]*PromoCode, error)
+	// Deactivate ends the validity of the code at the given moment
+	Deactivate(id uuid.UUID, at time.Time) error
+	CountUserRedemptions(codeID, userID uuid.UUID) (int, error)
+}
@@ -0,0 +1,74 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPromoCodeDiscount(t *testing.T) {
+	tests := []struct {
+		name    string
+		promo   PromoCode
+		price   Money
+		want    Money
+		wantErr error
+	}{
+		{"percent", PromoCode{Kind: PromoPercent, Percent: 25}, Money{10000, "RUB"}, Money{2500, "RUB"}, nil},
+		{"percent rounds half up", PromoCode{Kind: PromoPercent, Percent: 50}, Money{5, "RUB"}, Money{3, "RUB"}, nil},
+		{"percent rounds down", PromoCode{Kind: PromoPercent, Percent: 10}, Money{14, "RUB"}, Money{1, "RUB"}, nil},
+		{"full percent", PromoCode{Kind: PromoPercent, Percent: 100}, Money{9990, "RUB"}, Money{9990, "RUB"}, nil},
+		{"fixed", PromoCode{Kind: PromoFixed, Amount: &Money{3000, "RUB"}}, Money{10000, "RUB"}, Money{3000, "RUB"}, nil},
+		{"fixed capped at price", PromoCode{Kind: PromoFixed, Amount: &Money{30000, "RUB"}}, Money{10000, "RUB"}, Money{10000, "RUB"}, nil},
+		{"fixed other currency", PromoCode{Kind: PromoFixed, Amount: &Money{100, "USD"}}, Money{10000, "RUB"}, Money{}, ErrCurrencyMismatch},
+		{"fixed without amount", PromoCode{Kind: PromoFixed}, Money{10000, "RUB"}, Money{}, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.promo.Discount(tt.price)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Discount error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Discount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromoCodeActiveAt(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(24 * time.Hour)
+	tests := []struct {
+		name  string
+		until *time.Time
+		at    time.Time
+		want  bool
+	}{
+		{"before start", &until, from.Add(-time.Second), false},
+		{"at start", &until, from, true},
+		{"inside", &until, from.Add(time.Hour), true},
+		{"at end", &until, until, false},
+		{"open ended", nil, from.Add(365 * 24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		promo := PromoCode{ValidFrom: from, ValidUntil: tt.until}
+		if got := promo.ActiveAt(tt.at); got != tt.want {
+			t.Errorf("%s: ActiveAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPromoCodeAppliesTo(t *testing.T) {
+	all := PromoCode{}
+	if !all.AppliesTo("") || !all.AppliesTo("finance") {
+		t.Error("code without categories should apply to every report")
+	}
+	finance := PromoCode{Categories: []string{"finance", "legal"}}
+	if !finance.AppliesTo("legal") {
+		t.Error("code should apply to a listed category")
+	}
+	if finance.AppliesTo("medical") || finance.AppliesTo("") {
+		t.Error("code should not apply outside its categories")
+	}
+}
@@ -0,0 +1,43 @@
+package entity
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+type Permission string
+
+const (
+	PermUsersRead        Permission = "users:read"
+	PermUsersManage      Permission = "users:manage"
+	PermReportsReadAny   Permission = "reports:read_any"
+	PermReportsRefund    Permission = "reports:refund"
+	PermClientsManage    Permission = "oauth_clients:manage"
+	PermPromoCodesManage Permission = "promo_codes:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleUser:    {},
+	RoleSupport: {PermUsersRead, PermReportsReadAny, PermReportsRefund},
+	RoleAdmin:   {PermUsersRead, PermUsersManage, PermReportsReadAny, PermReportsRefund, PermClientsManage, PermPromoCodesManage},
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func (p *Principal) HasPermission(perm Permission) bool {
+	if !p.HasScope(string(perm)) {
+		return false
+	}
+	for _, role := range p.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
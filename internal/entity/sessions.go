@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one login on one device. Its ID is the family ID of the refresh
+// tokens it rotates through and the "sid" claim of its access tokens.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// ClientInfo describes the device a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type SessionRepository interface {
+	// Record creates the session or, on refresh, updates when and from where it
+	// was last seen. A revoked session stays revoked.
+	Record(session *Session) error
+	ListActiveByUser(userID uuid.UUID) ([]*Session, error)
+	Revoke(userID, id uuid.UUID) error
+	RevokeAllForUser(userID uuid.UUID) error
+}
+
+// SessionDenylistSubject is the denylist subject that revokes every access
+// token of a session.
+func SessionDenylistSubject(sessionID string) string {
+	return "session:" + sessionID
+}
@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is an opaque refresh token stored server-side. Only the hash of
+// the token is persisted; tokens issued by rotation share the same FamilyID.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	// authentication methods of the login that started the family
+	AMR []string
+	// set for tokens issued to OAuth clients, empty for our own sessions
+	ClientID  string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type RefreshTokenRepository interface {
+	Create(token *RefreshToken) error
+	GetByHash(tokenHash string) (*RefreshToken, error)
+	MarkUsed(id uuid.UUID) (bool, error)
+	RevokeFamily(familyID uuid.UUID) error
+	RevokeAllForUser(userID uuid.UUID) error
+}
+
+// TokenDenylist keeps access tokens that must be rejected before they expire:
+// single tokens by jti, and every token of a subject issued before a moment.
+// Token iat has whole seconds, so the moment is truncated to the second and
+// tokens issued within that second stay valid; a login right after the
+// revocation must not be rejected. Entries are only needed until the tokens
+// they cover expire.
+type TokenDenylist interface {
+	Revoke(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+	RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error
+	IsSubjectRevoked(subject string, issuedAt time.Time) (bool, error)
+	PruneExpired() error
+}
+
+// PasswordResetToken is single use; like refresh tokens only its hash is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type PasswordResetRepository interface {
+	Create(token *PasswordResetToken) error
+	GetByHash(tokenHash string) (*PasswordResetToken, error)
+	MarkUsed(id uuid.UUID) (bool, error)
+	InvalidateForUser(userID uuid.UUID) error
+}
@@ -10,28 +10,52 @@ type User struct {
 	ID           uuid.UUID `json:"id"`
 	Username     string    `json:"username"`
 	Email        string    `json:"email"`
-	PasswordHash string    `json:"password_hash"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	PasswordHash string    `json:"-"`
+	Roles        []string  `json:"roles"`
+	// existing accounts are verified by migration, new ones start unverified
+	EmailVerified      bool       `json:"email_verified"`
+	VerificationSentAt *time.Time `json:"-"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 }
 
 type UserRepository interface {
 	Create(user *User) error
 	GetByID(id uuid.UUID) (*User, error)
 	GetByUsername(username string) (*User, error)
+	GetByEmail(email string) (*User, error)
 	Update(user *User) error
 	Delete(id uuid.UUID) error
 	List() ([]*User, error)
 	Exists(username string) (bool, error)
-	UpdateBalance(userID uuid.UUID, balance float64) error
+	UpdateRoles(userID uuid.UUID, roles []string) error
+	UpdatePassword(userID uuid.UUID, passwordHash string) error
+	MarkEmailVerified(userID uuid.UUID, email string) (bool, error)
+	TouchVerificationSent(userID uuid.UUID, notBefore time.Time) (bool, error)
+	TouchPasswordResetSent(userID uuid.UUID, notBefore time.Time) (bool, error)
 }
 
 type ReportRepository interface {
 	CreateReport(report *Report) error
 	GetUserReports(userID uuid.UUID) ([]*Report, error)
-	SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) error
-	GetUserIdAndPriceByReportId(reportID string) (uuid.UUID, float64, error)
+	// SetAnonimousIdReport attaches the still anonymous reports of a client to
+	// the user and returns how many there were
+	SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) (int64, error)
+	// GetReport returns ErrNotFound when there is no such report
+	GetReport(reportID string) (*Report, error)
+	// PurchaseReport marks the report purchased. It is idempotent, so
+	// interrupted purchases can be finished again; ErrNotFound if it is gone.
 	PurchaseReport(reportID string) error
+	// MarkReportRefunded clears is_purchased and adds the refund to the
+	// report's history; applying the same refund twice changes nothing.
+	MarkReportRefunded(refund *ReportRefund) error
+}
+
+// ReportClaimRepository remembers which user claimed a client_generated_id, so
+// nobody else can claim it later.
+type ReportClaimRepository interface {
+	// Claim returns ErrConflict when another user already claimed the ID
+	Claim(clientGeneratedID string, userID uuid.UUID) error
 }
 
 type JWT struct {
@@ -46,5 +70,17 @@ type Report struct {
 	Created_at          time.Time `json:"created_at"`
 	Report_id           string    `json:"report_id"`
 	Is_purchased        bool      `json:"is_purchased"`
-	Price               float64   `json:"price"`
+	Price               Money     `json:"price"`
+	Category            string    `json:"category,omitempty" bson:"category,omitempty"`
+	// refunds of earlier purchases, oldest first
+	Refunds []ReportRefundEntry `json:"refunds,omitempty" bson:"refunds,omitempty"`
+}
+
+// ReportRefundEntry is how a ReportRefund is kept on the report in Mongo.
+type ReportRefundEntry struct {
+	ID        string    `json:"id" bson:"id"`
+	Amount    Money     `json:"amount" bson:"amount"`
+	Reason    string    `json:"reason" bson:"reason"`
+	ActorID   string    `json:"actor_id" bson:"actor_id"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
 }
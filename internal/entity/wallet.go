@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInsufficientFunds is returned when a debit would take a balance below zero.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// kinds of wallet transactions
+const (
+	TransactionOpeningBalance  = "opening_balance"
+	TransactionPurchase        = "purchase"
+	TransactionPurchaseReverse = "purchase_reversal"
+	TransactionTopUp           = "top_up"
+	TransactionRefund          = "refund"
+)
+
+// WalletTransaction is an immutable ledger entry. Amount is negative for
+// debits; a user has a wallet per currency, its balance is the sum of the
+// user's entries in that currency.
+type WalletTransaction struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       uuid.UUID `json:"-"`
+	Amount       Money     `json:"amount"`
+	BalanceAfter Money     `json:"balance_after"`
+	Kind         string    `json:"kind"`
+	// what the transaction is for, e.g. the purchase ID
+	Reference string `json:"reference"`
+	// set when Amount was converted from another currency
+	Exchange  *Exchange `json:"exchange,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// purchase statuses
+const (
+	PurchasePending   = "pending"
+	PurchaseCompleted = "completed"
+	PurchaseFailed    = "failed"
+	PurchaseRefunded  = "refunded"
+)
+
+// ReportPurchase ties the debit in Postgres to the is_purchased flag in Mongo.
+// It is pending from the debit until the report is marked purchased, so
+// purchases interrupted between the two stores can be finished later.
+type ReportPurchase struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"-"`
+	ReportID string    `json:"report_id"`
+	// charged to the wallet in its currency, see Exchange
+	Amount Money `json:"amount"`
+	// set when the wallet currency differs from the report's; only kept on
+	// the debit transaction
+	Exchange *Exchange `json:"exchange,omitempty"`
+	// set when a promo code was redeemed, Discount is in the report's currency
+	PromoCodeID   *uuid.UUID `json:"-"`
+	PromoCode     string     `json:"promo_code,omitempty"`
+	Discount      *Money     `json:"discount,omitempty"`
+	TransactionID uuid.UUID  `json:"transaction_id"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ReportRefund reverses a completed purchase. A purchase is refunded at most
+// once; the report can then be bought again.
+type ReportRefund struct {
+	ID            uuid.UUID `json:"id"`
+	PurchaseID    uuid.UUID `json:"purchase_id"`
+	ReportID      string    `json:"report_id"`
+	UserID        uuid.UUID `json:"-"`
+	Amount        Money     `json:"amount"`
+	Reason        string    `json:"reason"`
+	ActorID       uuid.UUID `json:"actor_id"`
+	TransactionID uuid.UUID `json:"transaction_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type WalletRepository interface {
+	// GetBalances returns the balance of each wallet of the user
+	GetBalances(userID uuid.UUID) ([]Money, error)
+	// ListTransactions returns the latest entries first
+	ListTransactions(userID uuid.UUID, limit int) ([]*WalletTransaction, error)
+	// StartPurchase debits the wallet, redeems the promo code and records the
+	// pending purchase in one transaction. It returns ErrInsufficientFunds,
+	// ErrPromoCodeUnavailable, or ErrConflict when the report already has a
+	// purchase that did not fail.
+	StartPurchase(purchase *ReportPurchase) error
+	CompletePurchase(purchaseID uuid.UUID) error
+	// FailPurchase credits the amount back, releases the promo code and marks
+	// the purchase failed
+	FailPurchase(purchaseID uuid.UUID) error
+	ListPendingPurchases(startedBefore time.Time) ([]*ReportPurchase, error)
+	// RefundPurchase credits back the completed purchase of refund.ReportID,
+	// releases its promo code and records the refund, filling in the rest of it. It returns ErrConflict if
+	// the last purchase was already refunded, ErrNotFound if there is none.
+	RefundPurchase(refund *ReportRefund) error
+	// LastRefund returns the latest refund of the report, ErrNotFound if none
+	LastRefund(reportID string) (*ReportRefund, error)
+}
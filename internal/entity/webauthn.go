@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a passkey registered by a user. Only the public key is
+// stored; SignCount is checked on every assertion to detect cloned keys.
+type WebAuthnCredential struct {
+	ID              uuid.UUID  `json:"id"`
+	UserID          uuid.UUID  `json:"-"`
+	CredentialID    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-"`
+	Transports      []string   `json:"transports"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+}
+
+type WebAuthnCredentialRepository interface {
+	// Create returns ErrConflict when the credential ID is already registered
+	Create(credential *WebAuthnCredential) error
+	ListByUser(userID uuid.UUID) ([]*WebAuthnCredential, error)
+	UpdateUsage(id uuid.UUID, signCount uint32, backupState bool) error
+	Delete(userID, id uuid.UUID) error
+}
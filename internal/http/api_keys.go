@@ -0,0 +1,65 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/usecase"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) CreateAPIKey(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req usecase.APIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	key, err := h.apiKeyUsecase.CreateKey(principal.UserID, req)
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, key)
+}
+
+func (h *Handler) ListAPIKeys(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	keys, err := h.apiKeyUsecase.ListKeys(principal.UserID)
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	if keys == nil {
+		keys = []*entity.APIKey{}
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (h *Handler) RevokeAPIKey(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid api key id"})
+	}
+
+	if err := h.apiKeyUsecase.RevokeKey(principal.UserID, keyID); err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "api key not found"})
+		}
+		return userErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
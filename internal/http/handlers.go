@@ -5,24 +5,48 @@ import (
 	"auth/internal/service"
 	"auth/internal/usecase"
 	"auth/pkg/logger"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
 type Handler struct {
-	userUsecase   usecase.UserUsecase
-	reportUsecase usecase.ReportUsecase
-	jwtService    service.JWTService
+	userUsecase         usecase.UserUsecase
+	reportUsecase       usecase.ReportUsecase
+	passwordUsecase     usecase.PasswordUsecase
+	verificationUsecase usecase.VerificationUsecase
+	mfaUsecase          usecase.MFAUsecase
+	webAuthnUsecase     usecase.WebAuthnUsecase
+	oauthUsecase        usecase.OAuthUsecase
+	oauthServerUsecase  usecase.OAuthServerUsecase
+	apiKeyUsecase       usecase.APIKeyUsecase
+	walletUsecase       usecase.WalletUsecase
+	promoCodeUsecase    usecase.PromoCodeUsecase
+	jwtService          service.JWTService
+	authenticator       *Authenticator
+	idempotency         *Idempotency
 }
 
-func NewHandler(userUsecase usecase.UserUsecase, reportUsecase usecase.ReportUsecase, jwtService service.JWTService) *Handler {
+func NewHandler(usecases Usecases, jwtService service.JWTService, authenticator *Authenticator, idempotency *Idempotency) *Handler {
 	return &Handler{
-		userUsecase:   userUsecase,
-		reportUsecase: reportUsecase,
-		jwtService:    jwtService,
+		userUsecase:         usecases.User,
+		reportUsecase:       usecases.Report,
+		passwordUsecase:     usecases.Password,
+		verificationUsecase: usecases.Verification,
+		mfaUsecase:          usecases.MFA,
+		webAuthnUsecase:     usecases.WebAuthn,
+		oauthUsecase:        usecases.OAuth,
+		oauthServerUsecase:  usecases.OAuthServer,
+		apiKeyUsecase:       usecases.APIKey,
+		walletUsecase:       usecases.Wallet,
+		promoCodeUsecase:    usecases.PromoCode,
+		jwtService:          jwtService,
+		authenticator:       authenticator,
+		idempotency:         idempotency,
 	}
 }
 
@@ -37,12 +61,21 @@ func (h *Handler) Register(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
-	token, err := h.userUsecase.RegisterUser(req.Username, req.Email, req.Password)
+	tokens, err := h.userUsecase.RegisterUser(req.Username, req.Email, req.Password, clientInfo(c))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		var validationErr *usecase.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+		case errors.Is(err, usecase.ErrUserExists):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			logger.Logger.Error().Err(err).Msg("failed to register user")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
 	}
 
-	setAuthCookie(c, token)
+	setAuthCookies(c, tokens)
 
 	return c.JSON(http.StatusCreated, map[string]string{"message": "registered successfully"})
 }
@@ -52,8 +85,9 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
-type loginResponse struct {
-	Token string `json:"token"`
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
 }
 
 func (h *Handler) Login(c echo.Context) error {
@@ -61,56 +95,335 @@ func (h *Handler) Login(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
-	token, err := h.userUsecase.LoginUser(req.Username, req.Password)
+	result, err := h.userUsecase.LoginUser(req.Username, req.Password, clientInfo(c))
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		var lockedErr *usecase.LoginLockedError
+		switch {
+		case errors.As(err, &lockedErr):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(lockedErr.RetryAfter.Seconds())+1))
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": lockedErr.Error()})
+		case errors.Is(err, usecase.ErrInvalidCredentials):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		default:
+			logger.Logger.Error().Err(err).Msg("failed to login")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to login"})
+		}
 	}
-	setAuthCookie(c, token)
+
+	// пароль верный, но куки выдаем только после второго фактора
+	if result.MFAToken != "" {
+		return c.JSON(http.StatusOK, mfaChallengeResponse{MFARequired: true, MFAToken: result.MFAToken})
+	}
+	setAuthCookies(c, result.Tokens)
 
 	return c.JSON(http.StatusCreated, map[string]string{"message": "logged in successfully"})
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh accepts the refresh token from the cookie (browser) or from the body
+// (API clients). API clients get the new pair back in the response body.
+func (h *Handler) Refresh(c echo.Context) error {
+	var req refreshRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	fromCookie := false
+	if req.RefreshToken == "" {
+		cookie, err := c.Cookie(refreshCookieName)
+		if err != nil || cookie.Value == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing refresh token"})
+		}
+		req.RefreshToken = cookie.Value
+		fromCookie = true
+	}
+
+	tokens, err := h.userUsecase.RefreshTokens(req.RefreshToken, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidRefreshToken) || errors.Is(err, usecase.ErrRefreshTokenReused) {
+			clearAuthCookies(c)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		logger.Logger.Error().Err(err).Msg("failed to refresh tokens")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to refresh tokens"})
+	}
+
+	if !fromCookie {
+		return c.JSON(http.StatusOK, tokens)
+	}
+
+	setAuthCookies(c, tokens)
+	return c.JSON(http.StatusOK, map[string]string{"message": "tokens refreshed"})
+}
+
 func (h *Handler) ListUsers(c echo.Context) error {
 	users, err := h.userUsecase.ListUsers()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list users"})
 	}
-	return c.JSON(http.StatusOK, users)
+	resp := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, newUserResponse(user))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) UnlockUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user ID"})
+	}
+
+	if err := h.userUsecase.UnlockUser(userID); err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "user unlocked"})
+}
+
+type setRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+func (h *Handler) SetUserRoles(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user ID"})
+	}
+
+	var req setRolesRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if err := h.userUsecase.SetUserRoles(userID, req.Roles); err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "roles updated"})
+}
+
+// createReportRequest lists everything a client may set; user_id, price,
+// is_purchased and report_id in the body are ignored.
+type createReportRequest struct {
+	ClientGeneratedID string `json:"client_generated_id"`
+	Description       string `json:"description"`
+	Category          string `json:"category"`
 }
 
+// CreateReport attributes the report to the logged in user; anonymous reports
+// are kept under their client_generated_id until claimed.
 func (h *Handler) CreateReport(c echo.Context) error {
-	var report entity.Report
-	if err := c.Bind(&report); err != nil {
+	userID := uuid.Nil
+	if principal, ok := principalFromContext(c); ok {
+		if !principal.HasScope(entity.ScopeReportsWrite) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "api key lacks the " + entity.ScopeReportsWrite + " scope"})
+		}
+		userID = principal.UserID
+	}
+
+	var req createReportRequest
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
-	if err := h.reportUsecase.CreateReport(&report); err != nil {
+
+	report, err := h.reportUsecase.CreateReport(userID, usecase.NewReport{
+		ClientGeneratedID: req.ClientGeneratedID,
+		Description:       req.Description,
+		Category:          req.Category,
+	})
+	if err != nil {
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+		}
+		logger.Logger.Error().Err(err).Msg("failed to create report")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create report"})
 	}
 	return c.JSON(http.StatusCreated, report)
 }
 
-func setAuthCookie(c echo.Context, token string) {
-	cookie := &http.Cookie{
-		Name:     "token",
-		Value:    token,
+// the upload client keeps its anonymous ID in this cookie
+const clientGeneratedIDCookieName = "client_generated_id"
+
+type claimReportsRequest struct {
+	ClientGeneratedID string `json:"client_generated_id"`
+}
+
+// ClaimReports attaches reports made before login to the user, the ID comes
+// from the body or from the upload client's cookie.
+func (h *Handler) ClaimReports(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req claimReportsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.ClientGeneratedID == "" {
+		req.ClientGeneratedID = FromCookie(clientGeneratedIDCookieName)(c)
+	}
+	if req.ClientGeneratedID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "client_generated_id is required"})
+	}
+
+	claimed, err := h.reportUsecase.SetAnonimousIdReport(req.ClientGeneratedID, principal.UserID)
+	if err != nil {
+		var validationErr *usecase.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+		case errors.Is(err, usecase.ErrReportsClaimed):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			logger.Logger.Error().Err(err).Msg("failed to claim reports")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to claim reports"})
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"claimed": claimed})
+}
+
+func (h *Handler) Logout(c echo.Context) error {
+	accessToken := h.authenticator.extract(c)
+	refreshToken := FromCookie(refreshCookieName)(c)
+
+	var req refreshRequest
+	if err := c.Bind(&req); err == nil && req.RefreshToken != "" {
+		refreshToken = req.RefreshToken
+	}
+
+	if err := h.userUsecase.Logout(accessToken, refreshToken); err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to logout")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to logout"})
+	}
+
+	clearAuthCookies(c)
+	return c.JSON(http.StatusOK, map[string]string{"message": "logged out successfully"})
+}
+
+func (h *Handler) RevokeAllSessions(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	if err := h.userUsecase.RevokeAllSessions(principal.UserID); err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to revoke sessions")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke sessions"})
+	}
+
+	clearAuthCookies(c)
+	return c.JSON(http.StatusOK, map[string]string{"message": "all sessions revoked"})
+}
+
+type sessionResponse struct {
+	*entity.Session
+	Current bool `json:"current"`
+}
+
+func (h *Handler) ListSessions(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	sessions, err := h.userUsecase.ListSessions(principal.UserID)
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to list sessions")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list sessions"})
+	}
+
+	currentID := currentSessionID(c)
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, sessionResponse{Session: session, Current: session.ID.String() == currentID})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) TerminateSession(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid session id"})
+	}
+
+	if err := h.userUsecase.TerminateSession(principal.UserID, sessionID); err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+		}
+		logger.Logger.Error().Err(err).Msg("failed to terminate session")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to terminate session"})
+	}
+
+	if sessionID.String() == currentSessionID(c) {
+		clearAuthCookies(c)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// currentSessionID is "" for API keys, they are not sessions.
+func currentSessionID(c echo.Context) string {
+	claims, ok := c.Get(claimsContextKey).(*service.Claims)
+	if !ok {
+		return ""
+	}
+	return claims.SessionID
+}
+
+const (
+	accessCookieName  = "token"
+	refreshCookieName = "refresh_token"
+)
+
+// cookie lifetimes follow the tokens they carry
+func setAuthCookies(c echo.Context, tokens *entity.TokenPair) {
+	c.SetCookie(authCookie(accessCookieName, tokens.AccessToken, time.Until(tokens.AccessExpiresAt)))
+	c.SetCookie(authCookie(refreshCookieName, tokens.RefreshToken, time.Until(tokens.RefreshExpiresAt)))
+	logger.Logger.Info().Msg("sucssesfull set auth cookies")
+}
+
+// clientInfo is recorded on the session a login or refresh starts or continues.
+func clientInfo(c echo.Context) entity.ClientInfo {
+	return entity.ClientInfo{IP: c.RealIP(), UserAgent: c.Request().UserAgent()}
+}
+
+func clearAuthCookies(c echo.Context) {
+	c.SetCookie(authCookie(accessCookieName, "", -time.Second))
+	c.SetCookie(authCookie(refreshCookieName, "", -time.Second))
+}
+
+func authCookie(name, value string, ttl time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 		Path:     "/",
-		MaxAge:   3600,
+		MaxAge:   int(ttl.Seconds()),
 	}
-	c.SetCookie(cookie)
-	mess := fmt.Sprintf("sucssesfull set cookie %s", cookie)
-	logger.Logger.Info().Msg(mess)
+}
 
+// JWKS lets other services verify our tokens without sharing a secret.
+func (h *Handler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.jwtService.JWKS())
 }
 
 func (h *Handler) CheckAuth(c echo.Context) error {
-	username, ok := c.Get("username").(string)
-	if !ok || username == "" {
+	principal, ok := principalFromContext(c)
+	if !ok {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "ok", "username": username})
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "ok", "principal": principal, "username": principal.Username})
 }
 
 func (h *Handler) GetUserReports(c echo.Context) error {
@@ -126,18 +439,113 @@ func (h *Handler) GetUserReports(c echo.Context) error {
 	return c.JSON(http.StatusOK, reports)
 }
 
+type purchaseReportRequest struct {
+	// wallet to pay from, the report's currency if empty
+	Currency string `json:"currency"`
+	Code     string `json:"code"`
+}
+
 func (h *Handler) PurchaseReport(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
 	reportID := c.Param("report_id")
 	if reportID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "report ID is required"})
 	}
 
-	// Call the use case to purchase the report
-	if err := h.reportUsecase.PurchaseReport(reportID); err != nil {
+	var req purchaseReportRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	purchase, err := h.reportUsecase.PurchaseReport(principal.UserID, reportID, usecase.PurchaseOptions{
+		Currency:  req.Currency,
+		PromoCode: req.Code,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, entity.ErrInsufficientFunds):
+			return c.JSON(http.StatusPaymentRequired, map[string]string{"error": err.Error()})
+		case errors.Is(err, usecase.ErrPurchasePending):
+			// the money is taken, the purchase completes in the background
+			return c.JSON(http.StatusAccepted, map[string]string{"message": err.Error()})
+		default:
+			return purchaseErrorResponse(c, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, purchase)
+}
+
+// QuoteReport shows the price of a purchase with the same options, including
+// the promo code discount.
+func (h *Handler) QuoteReport(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	quote, err := h.reportUsecase.QuoteReport(principal.UserID, c.Param("report_id"), usecase.PurchaseOptions{
+		Currency:  c.QueryParam("currency"),
+		PromoCode: c.QueryParam("code"),
+	})
+	if err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, quote)
+}
+
+func purchaseErrorResponse(c echo.Context, err error) error {
+	var validationErr *usecase.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+	case errors.Is(err, entity.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "report not found"})
+	case errors.Is(err, usecase.ErrAlreadyPurchased):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, usecase.ErrInvalidPromoCode):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	default:
+		logger.Logger.Error().Err(err).Msg("failed to purchase report")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to purchase report"})
 	}
+}
 
-	return c.JSON(http.StatusOK, map[string]string{"message": "report purchased successfully"})
+type refundReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) RefundReport(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req refundReportRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	refund, err := h.reportUsecase.RefundReport(principal.UserID, c.Param("report_id"), req.Reason)
+	if err != nil {
+		var validationErr *usecase.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+		case errors.Is(err, entity.ErrNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "report has no purchase to refund"})
+		case errors.Is(err, usecase.ErrAlreadyRefunded):
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		default:
+			logger.Logger.Error().Err(err).Msg("failed to refund report")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to refund report"})
+		}
+	}
+	return c.JSON(http.StatusOK, refund)
 }
 
 /*
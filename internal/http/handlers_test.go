@@ -0,0 +1,53 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/usecase"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// registeringUsecase answers RegisterUser with err; other methods are not
+// implemented.
+type registeringUsecase struct {
+	usecase.UserUsecase
+	err error
+}
+
+func (r registeringUsecase) RegisterUser(string, string, string, entity.ClientInfo) (*entity.TokenPair, error) {
+	return nil, r.err
+}
+
+func TestRegisterErrorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"invalid field", &usecase.ValidationError{Field: "email", Message: "is already taken"}, http.StatusBadRequest, "email: is already taken"},
+		{"duplicate user", usecase.ErrUserExists, http.StatusConflict, usecase.ErrUserExists.Error()},
+		{"store failure", errors.New("failed to create user: connection refused"), http.StatusInternalServerError, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(Usecases{User: registeringUsecase{err: tt.err}}, nil, nil, nil)
+			req := httptest.NewRequest(http.MethodPost, "/register",
+				strings.NewReader(`{"username":"ann","email":"ann@example.com","password":"correct horse"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			if err := h.Register(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.message) {
+				t.Errorf("response = %d %s, want %d with %q", rec.Code, rec.Body, tt.status, tt.message)
+			}
+		})
+	}
+}
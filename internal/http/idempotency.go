@@ -0,0 +1,156 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/pkg/logger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// Idempotency replays the stored response when a request is retried with the
+// same Idempotency-Key, so retries of purchases and the like run only once.
+// Requests without the header are passed through.
+type Idempotency struct {
+	repo      entity.IdempotencyRepository
+	retention time.Duration
+}
+
+func NewIdempotency(repo entity.IdempotencyRepository, retention time.Duration) *Idempotency {
+	return &Idempotency{repo: repo, retention: retention}
+}
+
+// Middleware must run after authentication, keys are scoped to the principal.
+// Anonymous clients cannot be told apart, so their keys are scoped to the
+// request itself: only the identical request gets the stored response, and
+// the same key with another body is simply a new request.
+func (i *Idempotency) Middleware() echo.MiddlewareFunc {
+	return i.middleware(false)
+}
+
+// MiddlewareWithCookies also stores and replays the cookies of the response,
+// for routes like /register whose response is only usable with them. The
+// cookies carry credentials and are kept until the key expires.
+func (i *Idempotency) MiddlewareWithCookies() echo.MiddlewareFunc {
+	return i.middleware(true)
+}
+
+func (i *Idempotency) middleware(storeCookies bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(idempotencyKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Idempotency-Key is too long"})
+			}
+
+			body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxIdempotentRequestBytes+1))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+			}
+			if len(body) > maxIdempotentRequestBytes {
+				return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "request body is too large"})
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			record := &entity.IdempotencyRecord{
+				Key:         key,
+				Fingerprint: requestFingerprint(c.Request(), body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(i.retention),
+			}
+			if principal, ok := principalFromContext(c); ok {
+				record.Scope = principal.UserID.String()
+			} else {
+				record.Scope = "anonymous:" + record.Fingerprint
+			}
+
+			existing, err := i.repo.Reserve(record)
+			if err != nil && !errors.Is(err, entity.ErrConflict) {
+				logger.Logger.Error().Err(err).Msg("failed to reserve idempotency key")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			}
+			switch {
+			case err != nil || (existing != nil && existing.StatusCode == 0):
+				return c.JSON(http.StatusConflict, map[string]string{"error": "a request with this Idempotency-Key is still in progress"})
+			case existing != nil && existing.Fingerprint != record.Fingerprint:
+				return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Idempotency-Key was already used for a different request"})
+			case existing != nil:
+				for _, cookie := range existing.Cookies {
+					c.Response().Header().Add(echo.HeaderSetCookie, cookie)
+				}
+				c.Response().Header().Set(idempotentReplayedHeader, "true")
+				return c.Blob(existing.StatusCode, existing.ContentType, existing.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			// the key is freed again unless a response worth replaying is stored
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := i.repo.Release(record.Scope, record.Key); err != nil {
+					logger.Logger.Error().Err(err).Msg("failed to release idempotency key")
+				}
+			}()
+
+			if err := next(c); err != nil {
+				return err
+			}
+
+			// server errors are not final, the client should be able to retry
+			status := c.Response().Status
+			if !c.Response().Committed || status >= http.StatusInternalServerError {
+				return nil
+			}
+			record.StatusCode = status
+			record.ContentType = c.Response().Header().Get(echo.HeaderContentType)
+			record.Body = recorder.body.Bytes()
+			if storeCookies {
+				record.Cookies = c.Response().Header().Values(echo.HeaderSetCookie)
+			}
+			if err := i.repo.Complete(record); err != nil {
+				logger.Logger.Error().Err(err).Msg("failed to store idempotent response")
+				return nil
+			}
+			completed = true
+			return nil
+		}
+	}
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body for replays.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,215 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type fakeIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[[2]string]*entity.IdempotencyRecord
+}
+
+func newFakeIdempotencyRepo() *fakeIdempotencyRepo {
+	return &fakeIdempotencyRepo{records: make(map[[2]string]*entity.IdempotencyRecord)}
+}
+
+func (f *fakeIdempotencyRepo) Reserve(record *entity.IdempotencyRecord) (*entity.IdempotencyRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := [2]string{record.Scope, record.Key}
+	if existing, ok := f.records[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *record
+	f.records[id] = &copied
+	return nil, nil
+}
+
+func (f *fakeIdempotencyRepo) Complete(record *entity.IdempotencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *record
+	f.records[[2]string{record.Scope, record.Key}] = &copied
+	return nil
+}
+
+func (f *fakeIdempotencyRepo) Release(scope, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.records, [2]string{scope, key})
+	return nil
+}
+
+func (f *fakeIdempotencyRepo) PruneExpired() error { return nil }
+
+// idempotentEcho serves POST /charge behind the middleware, answering with
+// the given status and counting how often the handler really ran. Requests
+// with a testUserHeader act as that user, the rest are anonymous.
+func idempotentEcho(repo entity.IdempotencyRepository, status int, calls *int) *echo.Echo {
+	e := echo.New()
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user := c.Request().Header.Get(testUserHeader); user != "" {
+				c.Set(principalContextKey, &entity.Principal{UserID: uuid.MustParse(user)})
+			}
+			return next(c)
+		}
+	}
+	e.POST("/charge", func(c echo.Context) error {
+		*calls++
+		return c.JSON(status, map[string]int{"call": *calls})
+	}, authenticate, NewIdempotency(repo, time.Hour).Middleware())
+	return e
+}
+
+const testUserHeader = "X-Test-User"
+
+// doIdempotent posts body with the key, as user unless it is uuid.Nil.
+func doIdempotent(e *echo.Echo, user uuid.UUID, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/charge", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(idempotencyKeyHeader, key)
+	if user != uuid.Nil {
+		req.Header.Set(testUserHeader, user.String())
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	calls := 0
+	e := idempotentEcho(newFakeIdempotencyRepo(), http.StatusCreated, &calls)
+	user := uuid.New()
+
+	first := doIdempotent(e, user, "k1", `{"amount":1}`)
+	replay := doIdempotent(e, user, "k1", `{"amount":1}`)
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %q, want %d %q", replay.Code, replay.Body, first.Code, first.Body)
+	}
+	if replay.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Error("replay is missing the Idempotent-Replayed header")
+	}
+	if first.Header().Get(idempotentReplayedHeader) != "" {
+		t.Error("first response is marked as replayed")
+	}
+
+	// keys are per user
+	if rec := doIdempotent(e, uuid.New(), "k1", `{"amount":1}`); rec.Header().Get(idempotentReplayedHeader) != "" || calls != 2 {
+		t.Errorf("another user's request was replayed, handler ran %d times", calls)
+	}
+}
+
+func TestIdempotencyRejectsKeyReuseForAnotherRequest(t *testing.T) {
+	calls := 0
+	e := idempotentEcho(newFakeIdempotencyRepo(), http.StatusCreated, &calls)
+	user := uuid.New()
+
+	doIdempotent(e, user, "k1", `{"amount":1}`)
+	rec := doIdempotent(e, user, "k1", `{"amount":1000}`)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyAnonymousClientsDoNotShareKeys(t *testing.T) {
+	calls := 0
+	e := idempotentEcho(newFakeIdempotencyRepo(), http.StatusCreated, &calls)
+
+	first := doIdempotent(e, uuid.Nil, "k1", `{"username":"alice"}`)
+	other := doIdempotent(e, uuid.Nil, "k1", `{"username":"bob"}`)
+	if other.Code != http.StatusCreated || other.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("other client got %d replayed=%q, want its own 201", other.Code, other.Header().Get(idempotentReplayedHeader))
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want once per client", calls)
+	}
+
+	retry := doIdempotent(e, uuid.Nil, "k1", `{"username":"alice"}`)
+	if retry.Header().Get(idempotentReplayedHeader) != "true" || retry.Body.String() != first.Body.String() {
+		t.Errorf("identical retry = %q replayed=%q, want the first response replayed", retry.Body, retry.Header().Get(idempotentReplayedHeader))
+	}
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	repo := newFakeIdempotencyRepo()
+	user := uuid.New()
+	repo.Reserve(&entity.IdempotencyRecord{Scope: user.String(), Key: "k1", ExpiresAt: time.Now().Add(time.Hour)})
+	calls := 0
+	e := idempotentEcho(repo, http.StatusCreated, &calls)
+
+	if rec := doIdempotent(e, user, "k1", `{}`); rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", rec.Code)
+	}
+	if calls != 0 {
+		t.Errorf("handler ran %d times, want 0", calls)
+	}
+}
+
+func TestIdempotencyServerErrorIsNotStored(t *testing.T) {
+	calls := 0
+	e := idempotentEcho(newFakeIdempotencyRepo(), http.StatusServiceUnavailable, &calls)
+	user := uuid.New()
+
+	doIdempotent(e, user, "k1", `{}`)
+	rec := doIdempotent(e, user, "k1", `{}`)
+
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want the retry to run again", calls)
+	}
+	if rec.Header().Get(idempotentReplayedHeader) != "" {
+		t.Error("server error was replayed")
+	}
+}
+
+func TestIdempotencyReplaysCookiesWhereStored(t *testing.T) {
+	repo := newFakeIdempotencyRepo()
+	idempotency := NewIdempotency(repo, time.Hour)
+	e := echo.New()
+	signIn := func(c echo.Context) error {
+		c.SetCookie(&http.Cookie{Name: "refresh_token", Value: uuid.NewString(), HttpOnly: true})
+		return c.JSON(http.StatusCreated, map[string]string{"status": "ok"})
+	}
+	e.POST("/register", signIn, idempotency.MiddlewareWithCookies())
+	e.POST("/charge", signIn, idempotency.Middleware())
+
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"username":"alice"}`))
+		req.Header.Set(idempotencyKeyHeader, "k1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("/register")
+	replay := post("/register")
+	if replay.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Fatal("registration was not replayed")
+	}
+	if got, want := replay.Header().Values(echo.HeaderSetCookie), first.Header().Values(echo.HeaderSetCookie); len(want) != 1 || len(got) != 1 || got[0] != want[0] {
+		t.Errorf("replayed cookies = %q, want %q", got, want)
+	}
+
+	post("/charge")
+	if replay := post("/charge"); len(replay.Header().Values(echo.HeaderSetCookie)) != 0 {
+		t.Errorf("cookies replayed on a route that does not store them: %q", replay.Header().Values(echo.HeaderSetCookie))
+	}
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginMFA is the second step of a login for accounts with TOTP enabled. The
+// code may also be one of the recovery codes.
+func (h *Handler) LoginMFA(c echo.Context) error {
+	var req mfaLoginRequest
+	if err := c.Bind(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "mfa_token and code are required"})
+	}
+
+	tokens, err := h.userUsecase.CompleteMFALogin(req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		var lockedErr *usecase.LoginLockedError
+		switch {
+		case errors.As(err, &lockedErr):
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(lockedErr.RetryAfter.Seconds())+1))
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": lockedErr.Error()})
+		case errors.Is(err, usecase.ErrInvalidMFAChallenge), errors.Is(err, usecase.ErrInvalidMFACode):
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		default:
+			logger.Logger.Error().Err(err).Msg("failed to complete MFA login")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to login"})
+		}
+	}
+	setAuthCookies(c, tokens)
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "logged in successfully"})
+}
+
+func (h *Handler) EnrollTOTP(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	setup, err := h.mfaUsecase.BeginTOTPEnrollment(principal.UserID)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, setup)
+}
+
+func (h *Handler) ConfirmTOTP(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req mfaCodeRequest
+	if err := c.Bind(&req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code is required"})
+	}
+
+	codes, err := h.mfaUsecase.ConfirmTOTP(principal.UserID, req.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *Handler) DisableTOTP(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req mfaCodeRequest
+	if err := c.Bind(&req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code is required"})
+	}
+
+	if err := h.mfaUsecase.DisableTOTP(principal.UserID, req.Code); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "two-factor authentication disabled"})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req mfaCodeRequest
+	if err := c.Bind(&req); err != nil || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code is required"})
+	}
+
+	codes, err := h.mfaUsecase.RegenerateRecoveryCodes(principal.UserID, req.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func mfaErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidMFACode):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	case errors.Is(err, usecase.ErrMFAAlreadyEnabled):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, usecase.ErrMFANotEnabled), errors.Is(err, usecase.ErrMFAEnrollmentAbsent):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		return userErrorResponse(c, err)
+	}
+}
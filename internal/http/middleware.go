@@ -1,66 +1,376 @@
 package http
 
 import (
+	"auth/internal/entity"
 	"auth/internal/service"
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
-func JWTMiddleware(jwtService service.JWTService) echo.MiddlewareFunc {
+const (
+	claimsContextKey    = "claims"
+	principalContextKey = "principal"
+)
+
+// TokenExtractor pulls a raw token out of the request, "" if there is none.
+type TokenExtractor func(c echo.Context) string
+
+func FromAuthHeader(scheme string) TokenExtractor {
+	prefix := scheme + " "
+	return func(c echo.Context) string {
+		authHeader := c.Request().Header.Get(echo.HeaderAuthorization)
+		if !strings.HasPrefix(authHeader, prefix) {
+			return ""
+		}
+		return strings.TrimPrefix(authHeader, prefix)
+	}
+}
+
+func FromHeader(name string) TokenExtractor {
+	return func(c echo.Context) string {
+		return c.Request().Header.Get(name)
+	}
+}
+
+func FromCookie(name string) TokenExtractor {
+	return func(c echo.Context) string {
+		cookie, err := c.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// FromQuery is only honoured for websocket upgrades, where browsers cannot set
+// headers; elsewhere tokens in URLs end up in logs.
+func FromQuery(param string) TokenExtractor {
+	return func(c echo.Context) string {
+		if !strings.EqualFold(c.Request().Header.Get(echo.HeaderUpgrade), "websocket") {
+			return ""
+		}
+		return c.QueryParam(param)
+	}
+}
+
+// Authenticator validates the first token found by its extractors, in order,
+// and stores the principal in the context.
+type Authenticator struct {
+	jwtService      service.JWTService
+	denylist        entity.TokenDenylist
+	limitUnverified bool
+	mfaRoles        []string
+	extractors      []TokenExtractor
+
+	apiKeys          usecase.APIKeyUsecase
+	apiKeyExtractors []TokenExtractor
+}
+
+// mfaRoles are only granted to sessions that passed a second factor.
+func NewAuthenticator(jwtService service.JWTService, denylist entity.TokenDenylist, limitUnverified bool, mfaRoles []string, extractors ...TokenExtractor) *Authenticator {
+	return &Authenticator{
+		jwtService:      jwtService,
+		denylist:        denylist,
+		limitUnverified: limitUnverified,
+		mfaRoles:        mfaRoles,
+		extractors:      extractors,
+	}
+}
+
+// WithAPIKeys also accepts personal API keys, found by their own extractors
+// and checked before any token.
+func (a *Authenticator) WithAPIKeys(apiKeys usecase.APIKeyUsecase, extractors ...TokenExtractor) *Authenticator {
+	a.apiKeys = apiKeys
+	a.apiKeyExtractors = extractors
+	return a
+}
+
+func (a *Authenticator) Middleware() echo.MiddlewareFunc {
+	return a.middleware(false)
+}
+
+// AllowAnonymous lets requests without credentials through with no principal.
+// Credentials that are sent still have to be valid, so a client with an
+// expired token refreshes instead of silently becoming anonymous.
+func (a *Authenticator) AllowAnonymous() echo.MiddlewareFunc {
+	return a.middleware(true)
+}
+
+func (a *Authenticator) middleware(allowAnonymous bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing or invalid Authorization header"})
+			if rawKey := a.extractAPIKey(c); rawKey != "" {
+				if reason := a.authenticateAPIKey(c, rawKey); reason != "" {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": reason})
+				}
+				return next(c)
 			}
 
-			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwtService.ValidateJWT(tokenStr)
-			if err != nil || !token.Valid {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
+			tokenStr := a.extract(c)
+			if tokenStr == "" {
+				if allowAnonymous {
+					return next(c)
+				}
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing auth token"})
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token claims"})
+			if reason := a.authenticate(c, tokenStr); reason != "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": reason})
 			}
+			return next(c)
+		}
+	}
+}
 
-			// можно положить username в контекст
-			c.Set("uusername", claims["username"])
+// Optional sets the principal when the request carries a valid token and lets
+// anonymous requests through; a bad token counts as no token.
+func (a *Authenticator) Optional() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if rawKey := a.extractAPIKey(c); rawKey != "" {
+				a.authenticateAPIKey(c, rawKey)
+			} else if tokenStr := a.extract(c); tokenStr != "" {
+				a.authenticate(c, tokenStr)
+			}
 			return next(c)
 		}
 	}
 }
 
-func AuthMiddleware(jwtService service.JWTService) echo.MiddlewareFunc {
+// authenticate validates the token and stores claims and principal in the
+// context. It returns why the token was refused, "" if it was accepted.
+func (a *Authenticator) authenticate(c echo.Context, tokenStr string) string {
+	claims, err := a.jwtService.ValidateJWT(tokenStr)
+	if err != nil {
+		return "invalid or expired token"
+	}
+
+	// tokens of OAuth clients are scoped for their own APIs, not ours
+	if claims.ClientID != "" {
+		return "token was issued to an OAuth client"
+	}
+
+	userID, err := claims.UserID()
+	if err != nil || claims.Username == "" {
+		return "invalid token claims"
+	}
+
+	if tokenRevoked(a.denylist, claims) {
+		return "token has been revoked"
+	}
+
+	roles, mfaRequired := a.grantedRoles(claims.Roles, claims.AMR)
+	c.Set(claimsContextKey, claims)
+	c.Set(principalContextKey, &entity.Principal{
+		UserID:   userID,
+		Username: claims.Username,
+		Roles:    roles,
+
+		EmailVerified: claims.EmailVerified,
+		MFARequired:   mfaRequired,
+	})
+	return ""
+}
+
+// authenticateAPIKey resolves the key to the same principal as a login of its
+// owner. A key is a single factor, so roles that need MFA are withheld.
+func (a *Authenticator) authenticateAPIKey(c echo.Context, rawKey string) string {
+	key, user, err := a.apiKeys.Authenticate(rawKey)
+	if err != nil {
+		if !errors.Is(err, usecase.ErrInvalidAPIKey) {
+			logger.Logger.Error().Err(err).Msg("failed to check api key")
+		}
+		return "invalid or expired api key"
+	}
+
+	roles, mfaRequired := a.grantedRoles(user.Roles, nil)
+	principal := &entity.Principal{
+		UserID:   user.ID,
+		Username: user.Username,
+		Roles:    roles,
+
+		EmailVerified: user.EmailVerified,
+		MFARequired:   mfaRequired,
+		APIKeyID:      &key.ID,
+	}
+	if len(key.Scopes) > 0 {
+		principal.Scopes = key.Scopes
+	}
+	c.Set(principalContextKey, principal)
+	return ""
+}
+
+// RequireVerifiedEmail keeps users with an unverified email out of the routes
+// behind it when access for them is limited.
+func (a *Authenticator) RequireVerifiedEmail() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			cookie, err := c.Cookie("token")
-			if err != nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing auth token"})
+			if !a.limitUnverified {
+				return next(c)
+			}
+			principal, ok := principalFromContext(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			}
+			if !principal.EmailVerified {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "email is not verified"})
 			}
-			tokenStr := cookie.Value
+			return next(c)
+		}
+	}
+}
+
+// grantedRoles drops the roles that need a second factor when the session was
+// not authenticated with more than one factor.
+func (a *Authenticator) grantedRoles(userRoles, amr []string) ([]string, bool) {
+	if slices.Contains(amr, entity.AMRMultiFactor) {
+		return userRoles, false
+	}
+
+	roles := make([]string, 0, len(userRoles))
+	withheld := false
+	for _, role := range userRoles {
+		if slices.Contains(a.mfaRoles, role) {
+			withheld = true
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles, withheld
+}
+
+func (a *Authenticator) extract(c echo.Context) string {
+	for _, extractor := range a.extractors {
+		if tokenStr := extractor(c); tokenStr != "" {
+			return tokenStr
+		}
+	}
+	return ""
+}
 
-			token, err := jwtService.ValidateJWT(tokenStr)
-			if err != nil || !token.Valid {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired token"})
+func (a *Authenticator) extractAPIKey(c echo.Context) string {
+	if a.apiKeys == nil {
+		return ""
+	}
+	for _, extractor := range a.apiKeyExtractors {
+		if rawKey := extractor(c); rawKey != "" {
+			return rawKey
+		}
+	}
+	return ""
+}
+
+func principalFromContext(c echo.Context) (*entity.Principal, bool) {
+	principal, ok := c.Get(principalContextKey).(*entity.Principal)
+	return principal, ok
+}
+
+func RequirePermission(perm entity.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := principalFromContext(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 			}
+			if !principal.HasPermission(perm) {
+				return forbidden(c, principal)
+			}
+			return next(c)
+		}
+	}
+}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
+// RequireOwnerOrPermission lets a user through when the route parameter is
+// their own user ID, anybody else needs perm.
+func RequireOwnerOrPermission(param string, perm entity.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := principalFromContext(c)
 			if !ok {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token claims"})
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 			}
+			if c.Param(param) != principal.UserID.String() && !principal.HasPermission(perm) {
+				return forbidden(c, principal)
+			}
+			return next(c)
+		}
+	}
+}
 
-			username, ok := claims["username"].(string)
-			if !ok || username == "" {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "username not found in token"})
+// RequireScope limits API keys created with scopes to the routes marked with
+// one of them; logins and unscoped keys pass.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := principalFromContext(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 			}
+			if !principal.HasScope(scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "api key lacks the " + scope + " scope"})
+			}
+			return next(c)
+		}
+	}
+}
 
-			c.Set("username", username) //  username в контексте
+// RequireInteractive keeps API keys away from account security: a leaked key
+// must not be able to change the password, MFA or mint more keys.
+func RequireInteractive() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := principalFromContext(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			}
+			if principal.APIKeyID != nil {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "not available with an api key, log in instead"})
+			}
 			return next(c)
 		}
 	}
 }
+
+// forbidden tells privileged users without a second factor why they were
+// refused, so the UI can send them to enroll.
+func forbidden(c echo.Context, principal *entity.Principal) error {
+	if principal.MFARequired {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "multi-factor authentication is required for your role"})
+	}
+	return c.JSON(http.StatusForbidden, map[string]string{"error": "forbidden"})
+}
+
+// tokenRevoked fails closed: denylist errors are treated as revoked.
+func tokenRevoked(denylist entity.TokenDenylist, claims *service.Claims) bool {
+	revoked, err := denylist.IsRevoked(claims.ID)
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to check token denylist")
+		return true
+	}
+	if revoked {
+		return true
+	}
+
+	revoked, err = denylist.IsSubjectRevoked(claims.Subject, claims.IssuedAt.Time)
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to check token denylist")
+		return true
+	}
+	if revoked || claims.SessionID == "" {
+		return revoked
+	}
+
+	// the session was terminated from another device
+	revoked, err = denylist.IsSubjectRevoked(entity.SessionDenylistSubject(claims.SessionID), claims.IssuedAt.Time)
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to check token denylist")
+		return true
+	}
+	return revoked
+}
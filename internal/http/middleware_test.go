@@ -0,0 +1,212 @@
+package http
+
+import (
+	"auth/config"
+	"auth/internal/entity"
+	"auth/internal/repository/memory"
+	"auth/internal/service"
+	"auth/internal/usecase"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestJWTService() service.JWTService {
+	return service.NewJWTService(service.NewHMACKeySet("test-secret"), config.AuthConfig{
+		Issuer: "freeze-auth", Audience: "freeze-api", AccessTokenTTL: time.Minute,
+	})
+}
+
+// authenticatedEcho serves GET /me behind the authenticator, answering with
+// the username of the principal.
+func authenticatedEcho(authenticator *Authenticator) *echo.Echo {
+	e := echo.New()
+	e.GET("/me", func(c echo.Context) error {
+		principal, ok := principalFromContext(c)
+		if !ok {
+			return c.String(http.StatusOK, "anonymous")
+		}
+		return c.String(http.StatusOK, principal.Username)
+	}, authenticator.Middleware())
+	return e
+}
+
+func TestAuthenticatorRejectsRevokedTokens(t *testing.T) {
+	jwtService := newTestJWTService()
+	user := &entity.User{ID: uuid.New(), Username: "ann", EmailVerified: true}
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		revoke func(denylist *memory.Denylist, claims *service.Claims)
+		status int
+	}{
+		{"not revoked", func(*memory.Denylist, *service.Claims) {}, http.StatusOK},
+		{"jti", func(denylist *memory.Denylist, claims *service.Claims) {
+			denylist.Revoke(claims.ID, later)
+		}, http.StatusUnauthorized},
+		{"subject", func(denylist *memory.Denylist, claims *service.Claims) {
+			denylist.RevokeSubject(claims.Subject, time.Now().Add(2*time.Second), later)
+		}, http.StatusUnauthorized},
+		{"session", func(denylist *memory.Denylist, claims *service.Claims) {
+			denylist.RevokeSubject(entity.SessionDenylistSubject(claims.SessionID), time.Now().Add(2*time.Second), later)
+		}, http.StatusUnauthorized},
+		// iat has whole seconds, a login right after a logout everywhere must work
+		{"subject revoked in the second it was issued", func(denylist *memory.Denylist, claims *service.Claims) {
+			denylist.RevokeSubject(claims.Subject, claims.IssuedAt.Time, later)
+		}, http.StatusOK},
+		{"other subject", func(denylist *memory.Denylist, claims *service.Claims) {
+			denylist.RevokeSubject(uuid.NewString(), time.Now().Add(2*time.Second), later)
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := jwtService.CreateJWT(user, uuid.NewString(), []string{entity.AMRPassword})
+			if err != nil {
+				t.Fatalf("CreateJWT: %v", err)
+			}
+			claims, err := jwtService.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("ValidateJWT: %v", err)
+			}
+			denylist := memory.NewDenylist()
+			tt.revoke(denylist, claims)
+
+			e := authenticatedEcho(NewAuthenticator(jwtService, denylist, false, nil, FromAuthHeader("Bearer")))
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorExtractors(t *testing.T) {
+	jwtService := newTestJWTService()
+	user := &entity.User{ID: uuid.New(), Username: "ann", Roles: []string{entity.RoleUser}, EmailVerified: true}
+	token, _, err := jwtService.CreateJWT(user, uuid.NewString(), []string{entity.AMRPassword})
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+	clientToken, _, err := jwtService.CreateClientAccessToken(user, "reports-app", []string{service.ScopeOpenID}, nil)
+	if err != nil {
+		t.Fatalf("CreateClientAccessToken: %v", err)
+	}
+	e := authenticatedEcho(NewAuthenticator(jwtService, memory.NewDenylist(), false, nil,
+		FromAuthHeader("Bearer"), FromCookie(accessCookieName), FromQuery("access_token")))
+
+	tests := []struct {
+		name   string
+		send   func(req *http.Request)
+		status int
+	}{
+		{"bearer header", func(req *http.Request) {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}, http.StatusOK},
+		{"cookie", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: accessCookieName, Value: token})
+		}, http.StatusOK},
+		{"query on websocket upgrade", func(req *http.Request) {
+			req.URL.RawQuery = "access_token=" + token
+			req.Header.Set(echo.HeaderUpgrade, "websocket")
+		}, http.StatusOK},
+		// the header is tried first, a bad one is not rescued by a good cookie
+		{"bad header before good cookie", func(req *http.Request) {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer not-a-token")
+			req.AddCookie(&http.Cookie{Name: accessCookieName, Value: token})
+		}, http.StatusUnauthorized},
+		{"query without upgrade", func(req *http.Request) {
+			req.URL.RawQuery = "access_token=" + token
+		}, http.StatusUnauthorized},
+		{"token of an OAuth client", func(req *http.Request) {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+clientToken)
+		}, http.StatusUnauthorized},
+		{"no token", func(*http.Request) {}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			tt.send(req)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != "ann" {
+				t.Errorf("principal = %q, want ann", rec.Body)
+			}
+		})
+	}
+}
+
+// staticAPIKey authenticates one raw key as the given key of user.
+type staticAPIKey struct {
+	usecase.APIKeyUsecase
+	raw  string
+	key  *entity.APIKey
+	user *entity.User
+}
+
+func (s staticAPIKey) Authenticate(rawKey string) (*entity.APIKey, *entity.User, error) {
+	if rawKey != s.raw {
+		return nil, nil, usecase.ErrInvalidAPIKey
+	}
+	return s.key, s.user, nil
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	admin := &entity.User{ID: uuid.New(), Username: "root", Roles: []string{entity.RoleAdmin}, EmailVerified: true}
+	tests := []struct {
+		name   string
+		scopes []string
+		path   string
+		status int
+	}{
+		{"scoped key on its scope", []string{entity.ScopeReportsRead}, "/reports", http.StatusOK},
+		{"scoped key on another scope", []string{entity.ScopeReportsRead}, "/reports/new", http.StatusForbidden},
+		{"scoped key on a permission it was not given", []string{entity.ScopeReportsRead}, "/users", http.StatusForbidden},
+		{"key scoped to the permission", []string{string(entity.PermUsersRead)}, "/users", http.StatusOK},
+		{"unscoped key", []string{}, "/reports/new", http.StatusOK},
+		{"unscoped key with a permission", []string{}, "/users", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeys := staticAPIKey{raw: "frz_test", key: &entity.APIKey{ID: uuid.New(), Scopes: tt.scopes}, user: admin}
+			authenticator := NewAuthenticator(newTestJWTService(), memory.NewDenylist(), false, nil).
+				WithAPIKeys(apiKeys, FromHeader("X-API-Key"))
+			ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+			e := echo.New()
+			e.GET("/reports", ok, authenticator.Middleware(), RequireScope(entity.ScopeReportsRead))
+			e.GET("/reports/new", ok, authenticator.Middleware(), RequireScope(entity.ScopeReportsWrite))
+			e.GET("/users", ok, authenticator.Middleware(), RequirePermission(entity.PermUsersRead))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-API-Key", "frz_test")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+		})
+	}
+
+	authenticator := NewAuthenticator(newTestJWTService(), memory.NewDenylist(), false, nil).
+		WithAPIKeys(staticAPIKey{raw: "frz_test"}, FromHeader("X-API-Key"))
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("X-API-Key", "frz_expired")
+	rec := httptest.NewRecorder()
+	authenticatedEcho(authenticator).ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("rejected key: status = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const oauthStateCookieName = "oauth_state"
+
+func (h *Handler) OAuthProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string][]string{"providers": h.oauthUsecase.Providers()})
+}
+
+// OAuthStart redirects the browser to the provider. State, nonce and the PKCE
+// verifier wait in a cookie scoped to this provider's callback.
+func (h *Handler) OAuthStart(c echo.Context) error {
+	provider := c.Param("provider")
+	start, err := h.oauthUsecase.StartLogin(provider)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownOIDCProvider) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		logger.Logger.Error().Err(err).Str("provider", provider).Msg("failed to start oauth login")
+		return c.Redirect(http.StatusSeeOther, "/?oauth_error=failed")
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oauthStateCookieName,
+		Value:    start.StateToken,
+		HttpOnly: true,
+		// the callback is a top-level navigation from the provider
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/oauth/" + provider,
+		MaxAge:   int(time.Until(start.StateExpiresAt).Seconds()),
+	})
+	return c.Redirect(http.StatusFound, start.RedirectURL)
+}
+
+// OAuthCallback answers with redirects to the login page, which shows errors
+// and asks for the TOTP code when needed.
+func (h *Handler) OAuthCallback(c echo.Context) error {
+	provider := c.Param("provider")
+
+	stateToken := ""
+	if cookie, err := c.Cookie(oauthStateCookieName); err == nil {
+		stateToken = cookie.Value
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oauthStateCookieName,
+		Value:    "",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/oauth/" + provider,
+		MaxAge:   -1,
+	})
+
+	if c.QueryParam("error") != "" || stateToken == "" {
+		return c.Redirect(http.StatusSeeOther, "/?oauth_error=failed")
+	}
+
+	result, err := h.userUsecase.LoginWithOIDC(provider, stateToken, c.QueryParam("state"), c.QueryParam("code"), clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrOAuthAccountExists):
+			return c.Redirect(http.StatusSeeOther, "/?oauth_error=account_exists")
+		case errors.Is(err, usecase.ErrOAuthEmailRequired):
+			return c.Redirect(http.StatusSeeOther, "/?oauth_error=email_required")
+		case errors.Is(err, usecase.ErrInvalidOAuthState), errors.Is(err, usecase.ErrOAuthFailed),
+			errors.Is(err, service.ErrUnknownOIDCProvider):
+			return c.Redirect(http.StatusSeeOther, "/?oauth_error=failed")
+		default:
+			logger.Logger.Error().Err(err).Str("provider", provider).Msg("failed to complete oauth login")
+			return c.Redirect(http.StatusSeeOther, "/?oauth_error=failed")
+		}
+	}
+
+	if result.MFAToken != "" {
+		return c.Redirect(http.StatusSeeOther, "/?mfa_token="+url.QueryEscape(result.MFAToken))
+	}
+	setAuthCookies(c, result.Tokens)
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+func (h *Handler) ListIdentities(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	identities, err := h.oauthUsecase.ListIdentities(principal.UserID)
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	if identities == nil {
+		identities = []*entity.ExternalIdentity{}
+	}
+	return c.JSON(http.StatusOK, identities)
+}
@@ -0,0 +1,203 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) OpenIDConfiguration(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.oauthServerUsecase.Discovery())
+}
+
+// Authorize is reached by the browser of a user the client sent to us. Who is
+// logged in comes from our own session cookie.
+func (h *Handler) Authorize(c echo.Context) error {
+	req := &usecase.AuthorizationRequest{
+		ClientID:            c.QueryParam("client_id"),
+		RedirectURI:         c.QueryParam("redirect_uri"),
+		ResponseType:        c.QueryParam("response_type"),
+		Scope:               c.QueryParam("scope"),
+		State:               c.QueryParam("state"),
+		Nonce:               c.QueryParam("nonce"),
+		CodeChallenge:       c.QueryParam("code_challenge"),
+		CodeChallengeMethod: c.QueryParam("code_challenge_method"),
+		Prompt:              c.QueryParam("prompt"),
+	}
+
+	var session *usecase.AuthorizationSession
+	if claims, ok := c.Get(claimsContextKey).(*service.Claims); ok {
+		userID, _ := claims.UserID()
+		session = &usecase.AuthorizationSession{UserID: userID, AMR: claims.AMR}
+	}
+
+	decision, err := h.oauthServerUsecase.Authorize(req, session)
+	if err != nil {
+		if errors.Is(err, usecase.ErrUnknownOAuthClient) || errors.Is(err, usecase.ErrInvalidRedirectURI) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		logger.Logger.Error().Err(err).Str("client_id", req.ClientID).Msg("failed to authorize oauth client")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	switch {
+	case decision.LoginRequired:
+		return c.Redirect(http.StatusFound, "/?return_to="+url.QueryEscape(c.Request().URL.RequestURI()))
+	case decision.ConsentToken != "":
+		return c.Redirect(http.StatusFound, "/consent.html?request="+url.QueryEscape(decision.ConsentToken))
+	default:
+		return c.Redirect(http.StatusFound, decision.RedirectURL)
+	}
+}
+
+func (h *Handler) ConsentDetails(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	prompt, err := h.oauthServerUsecase.ConsentDetails(c.QueryParam("request"), principal.UserID)
+	if err != nil {
+		return consentErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, prompt)
+}
+
+type consentRequest struct {
+	Request  string `json:"request"`
+	Approved bool   `json:"approved"`
+}
+
+// Consent answers with the URL to send the browser to, the page does the navigation.
+func (h *Handler) Consent(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req consentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	redirectURL, err := h.oauthServerUsecase.Consent(req.Request, principal.UserID, req.Approved)
+	if err != nil {
+		return consentErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"redirect_to": redirectURL})
+}
+
+func consentErrorResponse(c echo.Context, err error) error {
+	if errors.Is(err, usecase.ErrInvalidConsentRequest) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	logger.Logger.Error().Err(err).Msg("oauth consent failed")
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+}
+
+// Token takes a form post as RFC 6749 requires. Clients authenticate with HTTP
+// Basic or with client_id/client_secret in the form; public clients send only client_id.
+func (h *Handler) Token(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+
+	req := &usecase.TokenRequest{
+		GrantType:    c.FormValue("grant_type"),
+		ClientID:     c.FormValue("client_id"),
+		ClientSecret: c.FormValue("client_secret"),
+		Code:         c.FormValue("code"),
+		RedirectURI:  c.FormValue("redirect_uri"),
+		CodeVerifier: c.FormValue("code_verifier"),
+		RefreshToken: c.FormValue("refresh_token"),
+		Scope:        c.FormValue("scope"),
+	}
+	if clientID, clientSecret, ok := c.Request().BasicAuth(); ok {
+		// RFC 6749 2.3.1: credentials are form-encoded before going into the header
+		req.ClientID, _ = url.QueryUnescape(clientID)
+		req.ClientSecret, _ = url.QueryUnescape(clientSecret)
+	}
+
+	resp, err := h.oauthServerUsecase.Token(req)
+	if err != nil {
+		var oauthErr *usecase.OAuthError
+		if !errors.As(err, &oauthErr) {
+			logger.Logger.Error().Err(err).Str("client_id", req.ClientID).Msg("failed to issue oauth tokens")
+			return c.JSON(http.StatusInternalServerError, &usecase.OAuthError{Code: "server_error"})
+		}
+		if oauthErr.Code == "invalid_client" {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="token"`)
+			return c.JSON(http.StatusUnauthorized, oauthErr)
+		}
+		return c.JSON(http.StatusBadRequest, oauthErr)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) UserInfo(c echo.Context) error {
+	info, err := h.oauthServerUsecase.UserInfo(FromAuthHeader("Bearer")(c))
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidOAuthAccessToken) {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		}
+		logger.Logger.Error().Err(err).Msg("failed to load userinfo")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+type registeredClientResponse struct {
+	*entity.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (h *Handler) RegisterOAuthClient(c echo.Context) error {
+	var req usecase.ClientRegistration
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	client, secret, err := h.oauthServerUsecase.RegisterClient(req)
+	if err != nil {
+		return oauthClientErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, registeredClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+func (h *Handler) ListOAuthClients(c echo.Context) error {
+	clients, err := h.oauthServerUsecase.ListClients()
+	if err != nil {
+		return oauthClientErrorResponse(c, err)
+	}
+	if clients == nil {
+		clients = []*entity.OAuthClient{}
+	}
+	return c.JSON(http.StatusOK, clients)
+}
+
+func (h *Handler) DeleteOAuthClient(c echo.Context) error {
+	if err := h.oauthServerUsecase.DeleteClient(c.Param("id")); err != nil {
+		return oauthClientErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func oauthClientErrorResponse(c echo.Context, err error) error {
+	var validationErr *usecase.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+	case errors.Is(err, entity.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "client not found"})
+	default:
+		logger.Logger.Error().Err(err).Msg("oauth client request failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// passkeyFinishRequest carries the PublicKeyCredential from the browser as is,
+// it is parsed by the webauthn library.
+type passkeyFinishRequest struct {
+	CeremonyToken string          `json:"ceremony_token"`
+	Name          string          `json:"name"`
+	Credential    json.RawMessage `json:"credential"`
+}
+
+func (h *Handler) BeginPasskeyRegistration(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	ceremony, err := h.webAuthnUsecase.BeginRegistration(principal.UserID)
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, ceremony)
+}
+
+func (h *Handler) FinishPasskeyRegistration(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req passkeyFinishRequest
+	if err := c.Bind(&req); err != nil || req.CeremonyToken == "" || len(req.Credential) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ceremony_token and credential are required"})
+	}
+
+	credential, err := h.webAuthnUsecase.FinishRegistration(principal.UserID, req.CeremonyToken, req.Name, req.Credential)
+	if err != nil {
+		return passkeyErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, credential)
+}
+
+func (h *Handler) ListPasskeys(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	credentials, err := h.webAuthnUsecase.ListCredentials(principal.UserID)
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	if credentials == nil {
+		credentials = []*entity.WebAuthnCredential{}
+	}
+	return c.JSON(http.StatusOK, credentials)
+}
+
+func (h *Handler) DeletePasskey(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid passkey id"})
+	}
+
+	if err := h.webAuthnUsecase.DeleteCredential(principal.UserID, credentialID); err != nil {
+		return passkeyErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) BeginPasskeyLogin(c echo.Context) error {
+	ceremony, err := h.webAuthnUsecase.BeginLogin()
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to begin passkey login")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to login"})
+	}
+	return c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyLogin sets the same cookies as a password login.
+func (h *Handler) FinishPasskeyLogin(c echo.Context) error {
+	var req passkeyFinishRequest
+	if err := c.Bind(&req); err != nil || req.CeremonyToken == "" || len(req.Credential) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ceremony_token and credential are required"})
+	}
+
+	tokens, err := h.userUsecase.LoginWithPasskey(req.CeremonyToken, req.Credential, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidPasskeyCeremony) || errors.Is(err, usecase.ErrPasskeyRejected) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		}
+		logger.Logger.Error().Err(err).Msg("failed to login with passkey")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to login"})
+	}
+	setAuthCookies(c, tokens)
+
+	return c.JSON(http.StatusCreated, map[string]string{"message": "logged in successfully"})
+}
+
+func passkeyErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidPasskeyCeremony), errors.Is(err, usecase.ErrPasskeyRejected):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, usecase.ErrPasskeyAlreadyExists):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, entity.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "passkey not found"})
+	default:
+		return userErrorResponse(c, err)
+	}
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (h *Handler) ChangePassword(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req changePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	err := h.passwordUsecase.ChangePassword(principal.UserID, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, usecase.ErrInvalidCredentials) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "current password is wrong"})
+	}
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+
+	clearAuthCookies(c)
+	return c.JSON(http.StatusOK, map[string]string{"message": "password changed, please log in again"})
+}
+
+func (h *Handler) ForgotPassword(c echo.Context) error {
+	var req forgotPasswordRequest
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	err := h.passwordUsecase.RequestPasswordReset(req.Email, c.RealIP())
+	if errors.Is(err, usecase.ErrTooManyResetRequests) {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to request password reset")
+	}
+
+	// same answer whether or not the account exists
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "if the email is registered, a reset link has been sent"})
+}
+
+func (h *Handler) ResetPassword(c echo.Context) error {
+	var req resetPasswordRequest
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	err := h.passwordUsecase.ResetPassword(req.Token, req.NewPassword)
+	if errors.Is(err, usecase.ErrInvalidResetToken) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+
+	clearAuthCookies(c)
+	return c.JSON(http.StatusOK, map[string]string{"message": "password has been reset, please log in"})
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/usecase"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *Handler) CreatePromoCode(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	var req usecase.PromoCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	promo, err := h.promoCodeUsecase.CreatePromoCode(principal.UserID, req)
+	if err != nil {
+		if errors.Is(err, usecase.ErrPromoCodeTaken) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusCreated, promo)
+}
+
+func (h *Handler) ListPromoCodes(c echo.Context) error {
+	codes, err := h.promoCodeUsecase.ListPromoCodes()
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	if codes == nil {
+		codes = []*entity.PromoCode{}
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
+func (h *Handler) DeactivatePromoCode(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid promo code id"})
+	}
+
+	if err := h.promoCodeUsecase.DeactivatePromoCode(id); err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "promo code not found"})
+		}
+		return userErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
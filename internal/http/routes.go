@@ -1,6 +1,8 @@
 package http
 
 import (
+	"auth/internal/entity"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -8,27 +10,94 @@ import (
 func RegisterRoutes(e *echo.Echo, h *Handler) {
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"http://192.169.208.1:8085"}, // upload-сервер
-		AllowMethods:     []string{echo.GET, echo.POST},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, idempotencyKeyHeader},
 		AllowCredentials: true,
 	}))
 	e.File("/", "web/auth.html")
 	e.Static("/", "web")
+	e.GET("/.well-known/jwks.json", h.JWKS)
 	e.POST("/login", h.Login)
-	e.POST("/register", h.Register)
-	e.POST("/reports", h.CreateReport) //mongodb
+	e.POST("/login/mfa", h.LoginMFA)
+	e.POST("/login/passkey/begin", h.BeginPasskeyLogin)
+	e.POST("/login/passkey/finish", h.FinishPasskeyLogin)
+	e.POST("/register", h.Register, h.idempotency.MiddlewareWithCookies())
+	e.POST("/refresh", h.Refresh)
+	e.POST("/logout", h.Logout)
+	e.POST("/password/forgot", h.ForgotPassword)
+	e.POST("/password/reset", h.ResetPassword)
+	e.GET("/verify-email", h.VerifyEmail)
+	e.GET("/oauth/providers", h.OAuthProviders)
+	e.GET("/oauth/:provider/start", h.OAuthStart)
+	e.GET("/oauth/:provider/callback", h.OAuthCallback)
+	e.POST("/payments/webhook", h.PaymentWebhook)
+	e.POST("/reports", h.CreateReport, h.authenticator.AllowAnonymous(), h.idempotency.Middleware()) //mongodb
+	if h.oauthServerUsecase != nil {
+		e.GET("/.well-known/openid-configuration", h.OpenIDConfiguration)
+		e.GET("/authorize", h.Authorize, h.authenticator.Optional())
+		e.POST("/token", h.Token)
+		e.GET("/userinfo", h.UserInfo)
+		e.POST("/userinfo", h.UserInfo)
+	}
+
+	api := e.Group("/api", h.authenticator.Middleware())
+
+	// API-ключам со scope доступны только маршруты с этим scope,
+	// а управление безопасностью аккаунта — только после входа
+	interactive := RequireInteractive()
+
+	// доступно и с неподтверждённым email
+	api.GET("/check", h.CheckAuth, RequireScope(entity.ScopeAccountRead))
+	api.GET("/me", h.GetMe, RequireScope(entity.ScopeAccountRead))
+	api.PATCH("/me", h.UpdateMe, RequireScope(entity.ScopeAccountWrite))
+	api.DELETE("/me", h.DeleteMe, interactive)
+	api.POST("/me/email/verification", h.ResendVerification, RequireScope(entity.ScopeAccountWrite))
+	api.POST("/sessions/revoke-all", h.RevokeAllSessions, interactive)
+	api.GET("/me/sessions", h.ListSessions, interactive)
+	api.DELETE("/me/sessions/:id", h.TerminateSession, interactive)
+	// привилегированным ролям MFA обязателен, поэтому подключить его можно до подтверждения email
+	api.POST("/me/mfa/totp", h.EnrollTOTP, interactive)
+	api.POST("/me/mfa/totp/confirm", h.ConfirmTOTP, interactive)
+	api.DELETE("/me/mfa/totp", h.DisableTOTP, interactive)
+	api.POST("/me/mfa/recovery-codes", h.RegenerateRecoveryCodes, interactive)
+	api.GET("/me/passkeys", h.ListPasskeys, interactive)
+	api.POST("/me/passkeys/register/begin", h.BeginPasskeyRegistration, interactive)
+	api.POST("/me/passkeys/register/finish", h.FinishPasskeyRegistration, interactive)
+	api.DELETE("/me/passkeys/:id", h.DeletePasskey, interactive)
+	api.GET("/me/identities", h.ListIdentities, RequireScope(entity.ScopeAccountRead))
+	api.GET("/wallet", h.GetWallet, RequireScope(entity.ScopeAccountRead))
+	// сразу после регистрации email ещё не подтверждён
+	api.POST("/reports/claim", h.ClaimReports, RequireScope(entity.ScopeReportsWrite)) //mongodb
+	api.GET("/me/api-keys", h.ListAPIKeys, interactive)
+	api.POST("/me/api-keys", h.CreateAPIKey, interactive)
+	api.DELETE("/me/api-keys/:id", h.RevokeAPIKey, interactive)
+	if h.oauthServerUsecase != nil {
+		api.GET("/oauth/consent", h.ConsentDetails, interactive)
+		api.POST("/oauth/consent", h.Consent, interactive)
+	}
 
-	api := e.Group("/api", AuthMiddleware(h.jwtService))
+	verified := api.Group("", h.authenticator.RequireVerifiedEmail())
 
-	api.GET("/check", h.CheckAuth)
-	api.GET("/users", h.ListUsers)
+	verified.POST("/me/password", h.ChangePassword, interactive)
+	verified.POST("/wallet/topup", h.TopUpWallet, interactive, h.idempotency.Middleware())
 
-	api.GET("/:id/reports", h.GetUserReports)                      //mongodb
-	api.POST("/api/reports/:report_id/purchase", h.PurchaseReport) //mongodb
+	verified.GET("/users", h.ListUsers, RequirePermission(entity.PermUsersRead))
+	verified.GET("/users/:id", h.GetUser, RequirePermission(entity.PermUsersRead))
+	verified.PATCH("/users/:id", h.UpdateUser, RequirePermission(entity.PermUsersManage))
+	verified.DELETE("/users/:id", h.DeleteUser, RequirePermission(entity.PermUsersManage))
+	verified.PUT("/users/:id/roles", h.SetUserRoles, RequirePermission(entity.PermUsersManage))
+	verified.POST("/users/:id/unlock", h.UnlockUser, RequirePermission(entity.PermUsersManage))
+	verified.GET("/promo-codes", h.ListPromoCodes, RequirePermission(entity.PermPromoCodesManage))
+	verified.POST("/promo-codes", h.CreatePromoCode, RequirePermission(entity.PermPromoCodesManage))
+	verified.DELETE("/promo-codes/:id", h.DeactivatePromoCode, RequirePermission(entity.PermPromoCodesManage))
+	if h.oauthServerUsecase != nil {
+		verified.GET("/oauth/clients", h.ListOAuthClients, RequirePermission(entity.PermClientsManage))
+		verified.POST("/oauth/clients", h.RegisterOAuthClient, RequirePermission(entity.PermClientsManage))
+		verified.DELETE("/oauth/clients/:id", h.DeleteOAuthClient, RequirePermission(entity.PermClientsManage))
+	}
 
-	//api.GET("")
-	//e.GET("/users", ListUsers)
-	//e.GET("/users/:id", GetUser)
-	//e.PUT("/users/:id", UpdateUser)
-	//e.DELETE("/users/:id", DeleteUser)
+	verified.GET("/:id/reports", h.GetUserReports, RequireScope(entity.ScopeReportsRead), RequireOwnerOrPermission("id", entity.PermReportsReadAny)) //mongodb
+	verified.POST("/reports/:report_id/purchase", h.PurchaseReport, RequireScope(entity.ScopeReportsWrite), h.idempotency.Middleware())              //mongodb
+	verified.GET("/reports/:report_id/quote", h.QuoteReport, RequireScope(entity.ScopeReportsRead))                                                  //mongodb
+	verified.POST("/reports/:report_id/refund", h.RefundReport, RequirePermission(entity.PermReportsRefund))                                         //mongodb
 }
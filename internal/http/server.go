@@ -2,6 +2,7 @@ package http
 
 import (
 	"auth/config"
+	"auth/internal/entity"
 	"auth/internal/service"
 	"auth/internal/usecase"
 	"fmt"
@@ -9,11 +10,40 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func StartServer(cfg *config.Config, userUC usecase.UserUsecase, reportUC usecase.ReportUsecase) error {
+type Usecases struct {
+	User         usecase.UserUsecase
+	Report       usecase.ReportUsecase
+	Password     usecase.PasswordUsecase
+	Verification usecase.VerificationUsecase
+	MFA          usecase.MFAUsecase
+	WebAuthn     usecase.WebAuthnUsecase
+	OAuth        usecase.OAuthUsecase
+	APIKey       usecase.APIKeyUsecase
+	Wallet       usecase.WalletUsecase
+	PromoCode    usecase.PromoCodeUsecase
+	// nil unless the identity provider is enabled
+	OAuthServer usecase.OAuthServerUsecase
+}
+
+func StartServer(cfg *config.Config, usecases Usecases, jwtService service.JWTService, denylist entity.TokenDenylist, idempotencyRepo entity.IdempotencyRepository) error {
 	e := echo.New()
-	jwtService := service.NewJWTService(cfg.Auth.JWTSecret)
+	// c.RealIP() feeds login throttling, so proxy headers are only trusted on request
+	if cfg.TrustProxy {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	// порядок важен: API-клиенты шлют заголовок, браузер — куку
+	authenticator := NewAuthenticator(jwtService, denylist, cfg.Auth.UnverifiedAccess == "limited", cfg.Auth.MFA.RequiredRoles,
+		FromAuthHeader("Bearer"),
+		FromCookie(accessCookieName),
+		FromQuery("access_token"),
+	).WithAPIKeys(usecases.APIKey, FromHeader("X-API-Key"), FromAuthHeader("ApiKey"))
+
+	idempotency := NewIdempotency(idempotencyRepo, cfg.Idempotency.Retention)
 
-	handler := NewHandler(userUC, reportUC, jwtService)
+	handler := NewHandler(usecases, jwtService, authenticator, idempotency)
 	RegisterRoutes(e, handler)
 
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type userResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newUserResponse(user *entity.User) userResponse {
+	return userResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Roles:     user.Roles,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+// updated_at is the version the client has seen, it is required so that
+// concurrent edits do not silently overwrite each other.
+type updateUserRequest struct {
+	Username  *string    `json:"username"`
+	Email     *string    `json:"email"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+func (h *Handler) GetMe(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+	return h.getUser(c, principal.UserID)
+}
+
+func (h *Handler) UpdateMe(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+	return h.updateUser(c, principal.UserID)
+}
+
+func (h *Handler) DeleteMe(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+	if err := h.userUsecase.DeleteUser(principal.UserID); err != nil {
+		return userErrorResponse(c, err)
+	}
+	clearAuthCookies(c)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) GetUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user ID"})
+	}
+	return h.getUser(c, userID)
+}
+
+func (h *Handler) UpdateUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user ID"})
+	}
+	return h.updateUser(c, userID)
+}
+
+func (h *Handler) DeleteUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid user ID"})
+	}
+	if err := h.userUsecase.DeleteUser(userID); err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) getUser(c echo.Context, userID uuid.UUID) error {
+	user, err := h.userUsecase.GetUser(userID)
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (h *Handler) updateUser(c echo.Context, userID uuid.UUID) error {
+	var req updateUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.UpdatedAt == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "updated_at is required"})
+	}
+
+	user, err := h.userUsecase.UpdateUser(userID, usecase.UserUpdate{
+		Username:  req.Username,
+		Email:     req.Email,
+		UpdatedAt: *req.UpdatedAt,
+	})
+	if err != nil {
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func userErrorResponse(c echo.Context, err error) error {
+	var validationErr *usecase.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+	case errors.Is(err, entity.ErrNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	case errors.Is(err, entity.ErrConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "user was modified by another request, reload and retry"})
+	default:
+		logger.Logger.Error().Err(err).Msg("user request failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"auth/internal/usecase"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// VerifyEmail is opened from the mail, so it answers with a redirect to the UI
+// instead of JSON.
+func (h *Handler) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.Redirect(http.StatusSeeOther, "/?email_verified=false")
+	}
+
+	if err := h.verificationUsecase.VerifyEmail(token); err != nil {
+		if !errors.Is(err, usecase.ErrInvalidVerificationToken) {
+			return userErrorResponse(c, err)
+		}
+		return c.Redirect(http.StatusSeeOther, "/?email_verified=false")
+	}
+	return c.Redirect(http.StatusSeeOther, "/?email_verified=true")
+}
+
+func (h *Handler) ResendVerification(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	err := h.verificationUsecase.ResendVerification(principal.UserID)
+	switch {
+	case errors.Is(err, usecase.ErrVerificationThrottled):
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+	case errors.Is(err, usecase.ErrEmailAlreadyVerified):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		return userErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusAccepted, map[string]string{"message": "verification email sent"})
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"auth/internal/entity"
+	"auth/internal/usecase"
+	"auth/pkg/logger"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxWebhookBytes = 64 << 10
+
+func (h *Handler) GetWallet(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	wallet, err := h.walletUsecase.GetWallet(principal.UserID)
+	if err != nil {
+		logger.Logger.Error().Err(err).Msg("failed to get wallet")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get wallet"})
+	}
+	return c.JSON(http.StatusOK, wallet)
+}
+
+func (h *Handler) TopUpWallet(c echo.Context) error {
+	principal, ok := principalFromContext(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	}
+
+	// {"amount": <minor units>, "currency": "RUB"}
+	var req entity.Money
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	topUp, err := h.walletUsecase.TopUp(principal.UserID, req)
+	if err != nil {
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": validationErr.Error()})
+		}
+		logger.Logger.Error().Err(err).Msg("failed to start top-up")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to start top-up"})
+	}
+	return c.JSON(http.StatusCreated, topUp)
+}
+
+// PaymentWebhook is called by the payment provider, it authenticates with the
+// signature of the body instead of a session.
+func (h *Handler) PaymentWebhook(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBytes))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	if err := h.walletUsecase.HandlePaymentWebhook(c.Request().Header, body); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidPaymentWebhook):
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		case errors.Is(err, entity.ErrNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "payment not found"})
+		default:
+			// the provider retries on errors
+			logger.Logger.Error().Err(err).Msg("failed to handle payment webhook")
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+type subjectRevocation struct {
+	revokedBefore time.Time
+	expiresAt     time.Time
+}
+
+// Denylist is an in-process TokenDenylist, suitable for a single instance or
+// local development. Its contents are lost on restart.
+type Denylist struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]subjectRevocation
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]subjectRevocation),
+	}
+}
+
+func (d *Denylist) Revoke(jti string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokens[jti] = expiresAt
+	return nil
+}
+
+func (d *Denylist) IsRevoked(jti string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiresAt, ok := d.tokens[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (d *Denylist) RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := d.subjects[subject]
+	issuedBefore = issuedBefore.Truncate(time.Second)
+	if issuedBefore.After(current.revokedBefore) {
+		current.revokedBefore = issuedBefore
+	}
+	if expiresAt.After(current.expiresAt) {
+		current.expiresAt = expiresAt
+	}
+	d.subjects[subject] = current
+	return nil
+}
+
+func (d *Denylist) IsSubjectRevoked(subject string, issuedAt time.Time) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	revocation, ok := d.subjects[subject]
+	if !ok || !time.Now().Before(revocation.expiresAt) {
+		return false, nil
+	}
+	return revocation.revokedBefore.After(issuedAt), nil
+}
+
+func (d *Denylist) PruneExpired() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for jti, expiresAt := range d.tokens {
+		if !now.Before(expiresAt) {
+			delete(d.tokens, jti)
+		}
+	}
+	for subject, revocation := range d.subjects {
+		if !now.Before(revocation.expiresAt) {
+			delete(d.subjects, subject)
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package mongodb
 import (
 	"auth/internal/entity"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -36,7 +37,8 @@ func (r *ReportMongo) CreateReport(report *entity.Report) error {
 func (r *ReportMongo) GetUserReports(userID uuid.UUID) ([]*entity.Report, error) {
 	collection := r.db.Collection("reports")
 
-	filter := map[string]interface{}{"user_id": userID}
+	// user_id is stored as a string, see CreateReport
+	filter := bson.M{"user_id": userID.String()}
 	cursor, err := collection.Find(context.Background(), filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find reports: %w", err)
@@ -59,56 +61,51 @@ func (r *ReportMongo) GetUserReports(userID uuid.UUID) ([]*entity.Report, error)
 	return reports, nil
 }
 
-func (r *ReportMongo) SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) error {
+func (r *ReportMongo) SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) (int64, error) {
 	collection := r.db.Collection("reports")
 
 	filter := bson.M{
 		"client_generated_id": clientGeneratedID,
-		"user_id":             nil, // чтобы не тронуть уже привязанные
+		// чтобы не тронуть уже привязанные; анонимные сохраняются с пустой строкой
+		"user_id": bson.M{"$in": bson.A{nil, ""}},
 	}
 
 	update := bson.M{
 		"$set": bson.M{
-			"user_id": userID,
+			"user_id": userID.String(),
 		},
 	}
 
-	_, err := collection.UpdateMany(context.Background(), filter, update)
+	result, err := collection.UpdateMany(context.Background(), filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to set anonymous ID: %w", err)
+		return 0, fmt.Errorf("failed to set anonymous ID: %w", err)
 	}
 
-	return nil
+	return result.ModifiedCount, nil
 }
 
-func (r *ReportMongo) GetUserIdAndPriceByReportId(reportID string) (uuid.UUID, float64, error) {
+func (r *ReportMongo) GetReport(reportID string) (*entity.Report, error) {
 	collection := r.db.Collection("reports")
 
 	filter := bson.M{"report_id": reportID}
 	var report entity.Report
 	err := collection.FindOne(context.Background(), filter).Decode(&report)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return uuid.Nil, 0, fmt.Errorf("no report found with ID %s", reportID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, entity.ErrNotFound
 		}
-		return uuid.Nil, 0, fmt.Errorf("failed to find report: %w", err)
+		return nil, fmt.Errorf("failed to find report: %w", err)
 	}
 
-	userID, err := uuid.Parse(report.User_id)
-	if err != nil {
-		return uuid.Nil, 0, fmt.Errorf("invalid user ID in report: %w", err)
-	}
-
-	return userID, report.Price, nil
+	return &report, nil
 }
 
 func (r *ReportMongo) PurchaseReport(reportID string) error {
 	collection := r.db.Collection("reports")
 
-	filter := bson.M{
-		"report_id":    reportID,
-		"is_purchased": false, // <--- защита от повторной покупки
-	}
+	// повторная покупка не проходит раньше, в Postgres (report_purchases),
+	// поэтому здесь флаг просто выставляется и повтор безопасен
+	filter := bson.M{"report_id": reportID}
 	update := bson.M{"$set": bson.M{"is_purchased": true}}
 
 	result, err := collection.UpdateOne(context.Background(), filter, update)
@@ -117,8 +114,33 @@ func (r *ReportMongo) PurchaseReport(reportID string) error {
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("no report found with ID %s", reportID)
+		return entity.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *ReportMongo) MarkReportRefunded(refund *entity.ReportRefund) error {
+	collection := r.db.Collection("reports")
+
+	// уже записанный возврат не совпадёт с фильтром, повтор ничего не меняет
+	filter := bson.M{
+		"report_id":  refund.ReportID,
+		"refunds.id": bson.M{"$ne": refund.ID.String()},
+	}
+	update := bson.M{
+		"$set": bson.M{"is_purchased": false},
+		"$push": bson.M{"refunds": entity.ReportRefundEntry{
+			ID:        refund.ID.String(),
+			Amount:    refund.Amount,
+			Reason:    refund.Reason,
+			ActorID:   refund.ActorID.String(),
+			CreatedAt: refund.CreatedAt,
+		}},
 	}
 
+	if _, err := collection.UpdateOne(context.Background(), filter, update); err != nil {
+		return fmt.Errorf("failed to mark report refunded: %w", err)
+	}
 	return nil
 }
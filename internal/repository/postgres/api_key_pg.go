@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type APIKeyPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewAPIKeyPostgres(pool *pgxpool.Pool) *APIKeyPostgres {
+	return &APIKeyPostgres{pool: pool}
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*entity.APIKey, error) {
+	var key entity.APIKey
+	err := row.Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (a *APIKeyPostgres) Create(key *entity.APIKey) error {
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	query := `
+	INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := a.pool.Exec(context.Background(), query,
+		key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, scopes, key.CreatedAt, key.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+func (a *APIKeyPostgres) GetByHash(keyHash string) (*entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	key, err := scanAPIKey(a.pool.QueryRow(context.Background(), query, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+func (a *APIKeyPostgres) ListByUser(userID uuid.UUID) ([]*entity.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = $1 ORDER BY created_at`
+	rows, err := a.pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*entity.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke keeps the row so the key still shows up with its last use.
+func (a *APIKeyPostgres) Revoke(userID, id uuid.UUID) error {
+	query := `
+	UPDATE api_keys
+	SET revoked_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+	cmdTag, err := a.pool.Exec(context.Background(), query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
+
+func (a *APIKeyPostgres) TouchLastUsed(id uuid.UUID, at, notBefore time.Time) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = $2
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)
+	`
+	if _, err := a.pool.Exec(context.Background(), query, id, at, notBefore); err != nil {
+		return fmt.Errorf("failed to update api key usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type AuthorizationCodePostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuthorizationCodePostgres(pool *pgxpool.Pool) *AuthorizationCodePostgres {
+	return &AuthorizationCodePostgres{pool: pool}
+}
+
+func (ac *AuthorizationCodePostgres) Create(code *entity.AuthorizationCode) error {
+	query := `
+	INSERT INTO oauth_authorization_codes (
+		code_hash, client_id, user_id, family_id, redirect_uri, redirect_uri_explicit, scopes, nonce, code_challenge, amr,
+		created_at, expires_at
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := ac.pool.Exec(context.Background(), query,
+		code.CodeHash, code.ClientID, code.UserID, code.FamilyID, code.RedirectURI, code.RedirectURIExplicit, code.Scopes,
+		code.Nonce, code.CodeChallenge, code.AMR, code.CreatedAt, code.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create authorization code: %w", err)
+	}
+	return nil
+}
+
+// Consume marks the code used. A code that was redeemed before is still
+// returned, with fresh set to false, so the caller can revoke what it issued.
+// Only the client the code was issued to can consume it.
+func (ac *AuthorizationCodePostgres) Consume(codeHash, clientID string) (*entity.AuthorizationCode, bool, error) {
+	ctx := context.Background()
+
+	code, err := scanAuthorizationCode(ac.pool.QueryRow(ctx, `
+	UPDATE oauth_authorization_codes
+	SET used_at = NOW()
+	WHERE code_hash = $1 AND client_id = $2 AND used_at IS NULL
+	RETURNING `+authorizationCodeColumns, codeHash, clientID))
+	if err == nil {
+		return code, true, nil
+	}
+	if !errors.Is(err, entity.ErrNotFound) {
+		return nil, false, err
+	}
+
+	code, err = scanAuthorizationCode(ac.pool.QueryRow(ctx,
+		`SELECT `+authorizationCodeColumns+` FROM oauth_authorization_codes WHERE code_hash = $1 AND client_id = $2`,
+		codeHash, clientID))
+	if err != nil {
+		return nil, false, err
+	}
+	return code, false, nil
+}
+
+const authorizationCodeColumns = "code_hash, client_id, user_id, family_id, redirect_uri, redirect_uri_explicit, scopes, nonce, code_challenge, amr, created_at, expires_at, used_at"
+
+func scanAuthorizationCode(row pgx.Row) (*entity.AuthorizationCode, error) {
+	var code entity.AuthorizationCode
+	err := row.Scan(
+		&code.CodeHash, &code.ClientID, &code.UserID, &code.FamilyID, &code.RedirectURI, &code.RedirectURIExplicit, &code.Scopes,
+		&code.Nonce, &code.CodeChallenge, &code.AMR, &code.CreatedAt, &code.ExpiresAt, &code.UsedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan authorization code: %w", err)
+	}
+	return &code, nil
+}
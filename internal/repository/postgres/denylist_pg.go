@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type DenylistPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewDenylistPostgres(pool *pgxpool.Pool) *DenylistPostgres {
+	return &DenylistPostgres{pool: pool}
+}
+
+func (d *DenylistPostgres) Revoke(jti string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO revoked_tokens (jti, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (jti) DO NOTHING
+	`
+	_, err := d.pool.Exec(context.Background(), query, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (d *DenylistPostgres) IsRevoked(jti string) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > NOW())
+	`
+	var revoked bool
+	err := d.pool.QueryRow(context.Background(), query, jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check revoked token: %w", err)
+	}
+	return revoked, nil
+}
+
+func (d *DenylistPostgres) RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error {
+	query := `
+	INSERT INTO revoked_subjects (subject, revoked_before, expires_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (subject) DO UPDATE
+	SET revoked_before = GREATEST(revoked_subjects.revoked_before, EXCLUDED.revoked_before),
+		expires_at = GREATEST(revoked_subjects.expires_at, EXCLUDED.expires_at)
+	`
+	_, err := d.pool.Exec(context.Background(), query, subject, issuedBefore.Truncate(time.Second), expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke subject tokens: %w", err)
+	}
+	return nil
+}
+
+func (d *DenylistPostgres) IsSubjectRevoked(subject string, issuedAt time.Time) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM revoked_subjects
+		WHERE subject = $1 AND revoked_before > $2 AND expires_at > NOW()
+	)
+	`
+	var revoked bool
+	err := d.pool.QueryRow(context.Background(), query, subject, issuedAt).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check revoked subject: %w", err)
+	}
+	return revoked, nil
+}
+
+func (d *DenylistPostgres) PruneExpired() error {
+	ctx := context.Background()
+	if _, err := d.pool.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("failed to prune revoked tokens: %w", err)
+	}
+	if _, err := d.pool.Exec(ctx, `DELETE FROM revoked_subjects WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("failed to prune revoked subjects: %w", err)
+	}
+	return nil
+}
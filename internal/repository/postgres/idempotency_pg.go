@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type IdempotencyPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyPostgres(pool *pgxpool.Pool) *IdempotencyPostgres {
+	return &IdempotencyPostgres{pool: pool}
+}
+
+func (i *IdempotencyPostgres) Reserve(record *entity.IdempotencyRecord) (*entity.IdempotencyRecord, error) {
+	ctx := context.Background()
+
+	// an expired record is overwritten as if the key was free
+	query := `
+	INSERT INTO idempotency_keys (scope, key, fingerprint, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (scope, key) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint,
+		status_code = 0,
+		content_type = '',
+		body = NULL,
+		cookies = NULL,
+		created_at = EXCLUDED.created_at,
+		expires_at = EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= NOW()
+	`
+	tag, err := i.pool.Exec(ctx, query, record.Scope, record.Key, record.Fingerprint, record.CreatedAt, record.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	query = `
+	SELECT scope, key, fingerprint, status_code, content_type, body, cookies, created_at, expires_at
+	FROM idempotency_keys
+	WHERE scope = $1 AND key = $2
+	`
+	var existing entity.IdempotencyRecord
+	err = i.pool.QueryRow(ctx, query, record.Scope, record.Key).Scan(
+		&existing.Scope, &existing.Key, &existing.Fingerprint, &existing.StatusCode,
+		&existing.ContentType, &existing.Body, &existing.Cookies, &existing.CreatedAt, &existing.ExpiresAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// pruned in between, the caller may simply retry
+		return nil, entity.ErrConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return &existing, nil
+}
+
+func (i *IdempotencyPostgres) Complete(record *entity.IdempotencyRecord) error {
+	query := `
+	UPDATE idempotency_keys
+	SET status_code = $3, content_type = $4, body = $5, cookies = $6
+	WHERE scope = $1 AND key = $2
+	`
+	_, err := i.pool.Exec(context.Background(), query,
+		record.Scope, record.Key, record.StatusCode, record.ContentType, record.Body, record.Cookies)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (i *IdempotencyPostgres) Release(scope, key string) error {
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE scope = $1 AND key = $2 AND status_code = 0
+	`
+	if _, err := i.pool.Exec(context.Background(), query, scope, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (i *IdempotencyPostgres) PruneExpired() error {
+	if _, err := i.pool.Exec(context.Background(), `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("failed to prune idempotency keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type IdentityPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdentityPostgres(pool *pgxpool.Pool) *IdentityPostgres {
+	return &IdentityPostgres{pool: pool}
+}
+
+func (i *IdentityPostgres) GetByProviderSubject(provider, subject string) (*entity.ExternalIdentity, error) {
+	query := `
+	SELECT id, user_id, provider, subject, email, created_at
+	FROM user_identities
+	WHERE provider = $1 AND subject = $2
+	`
+	var identity entity.ExternalIdentity
+	err := i.pool.QueryRow(context.Background(), query, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get external identity: %w", err)
+	}
+	return &identity, nil
+}
+
+func (i *IdentityPostgres) Create(identity *entity.ExternalIdentity) error {
+	query := `
+	INSERT INTO user_identities (id, user_id, provider, subject, email, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (provider, subject) DO NOTHING
+	`
+	cmdTag, err := i.pool.Exec(context.Background(), query,
+		identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create external identity: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrConflict
+	}
+	return nil
+}
+
+func (i *IdentityPostgres) ListByUser(userID uuid.UUID) ([]*entity.ExternalIdentity, error) {
+	query := `
+	SELECT id, user_id, provider, subject, email, created_at
+	FROM user_identities
+	WHERE user_id = $1
+	ORDER BY created_at
+	`
+	rows, err := i.pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list external identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*entity.ExternalIdentity
+	for rows.Next() {
+		var identity entity.ExternalIdentity
+		if err := rows.Scan(
+			&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan external identity: %w", err)
+		}
+		identities = append(identities, &identity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list external identities: %w", err)
+	}
+	return identities, nil
+}
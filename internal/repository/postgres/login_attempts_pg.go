@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type LoginAttemptPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoginAttemptPostgres(pool *pgxpool.Pool) *LoginAttemptPostgres {
+	return &LoginAttemptPostgres{pool: pool}
+}
+
+func (la *LoginAttemptPostgres) RecordFailure(key string, window time.Duration) (int, error) {
+	query := `
+	INSERT INTO login_failures (key, failures, last_failed_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE
+	SET failures = CASE
+			WHEN login_failures.last_failed_at < NOW() - make_interval(secs => $2) THEN 1
+			ELSE login_failures.failures + 1
+		END,
+		last_failed_at = NOW()
+	RETURNING failures
+	`
+	var failures int
+	err := la.pool.QueryRow(context.Background(), query, key, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return failures, nil
+}
+
+func (la *LoginAttemptPostgres) LockUntil(key string, until time.Time) error {
+	query := `UPDATE login_failures SET locked_until = $2 WHERE key = $1`
+	_, err := la.pool.Exec(context.Background(), query, key, until)
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+func (la *LoginAttemptPostgres) LockedUntil(key string) (*time.Time, error) {
+	query := `SELECT locked_until FROM login_failures WHERE key = $1 AND locked_until > NOW()`
+	var until time.Time
+	err := la.pool.QueryRow(context.Background(), query, key).Scan(&until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check login lock: %w", err)
+	}
+	return &until, nil
+}
+
+func (la *LoginAttemptPostgres) Reset(key string) error {
+	_, err := la.pool.Exec(context.Background(), `DELETE FROM login_failures WHERE key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type MFAPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewMFAPostgres(pool *pgxpool.Pool) *MFAPostgres {
+	return &MFAPostgres{pool: pool}
+}
+
+func (m *MFAPostgres) GetTOTP(userID uuid.UUID) (*entity.TOTPEnrollment, error) {
+	query := `
+	SELECT user_id, secret, enabled, created_at, confirmed_at, last_used_step
+	FROM user_totp WHERE user_id = $1
+	`
+	var enrollment entity.TOTPEnrollment
+	err := m.pool.QueryRow(context.Background(), query, userID).Scan(
+		&enrollment.UserID, &enrollment.Secret, &enrollment.Enabled,
+		&enrollment.CreatedAt, &enrollment.ConfirmedAt, &enrollment.LastUsedStep,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TOTP enrollment: %w", err)
+	}
+	return &enrollment, nil
+}
+
+func (m *MFAPostgres) SaveTOTP(enrollment *entity.TOTPEnrollment) error {
+	query := `
+	INSERT INTO user_totp (user_id, secret, enabled, created_at, last_used_step)
+	VALUES ($1, $2, FALSE, $3, 0)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret,
+		created_at = EXCLUDED.created_at,
+		last_used_step = 0
+	WHERE user_totp.enabled = FALSE
+	`
+	cmdTag, err := m.pool.Exec(context.Background(), query, enrollment.UserID, enrollment.Secret, enrollment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP enrollment: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrConflict
+	}
+	return nil
+}
+
+func (m *MFAPostgres) EnableTOTP(userID uuid.UUID) error {
+	query := `
+	UPDATE user_totp
+	SET enabled = TRUE,
+		confirmed_at = NOW()
+	WHERE user_id = $1
+	`
+	cmdTag, err := m.pool.Exec(context.Background(), query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
+
+func (m *MFAPostgres) DeleteTOTP(userID uuid.UUID) error {
+	ctx := context.Background()
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP enrollment: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+func (m *MFAPostgres) UseTOTPStep(userID uuid.UUID, step int64) (bool, error) {
+	query := `
+	UPDATE user_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND last_used_step < $2
+	`
+	cmdTag, err := m.pool.Exec(context.Background(), query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+func (m *MFAPostgres) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	ctx := context.Background()
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, codeHash := range codeHashes {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO mfa_recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)`,
+			uuid.New(), userID, codeHash,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (m *MFAPostgres) UseRecoveryCode(userID uuid.UUID, codeHash string) (bool, error) {
+	query := `
+	UPDATE mfa_recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	cmdTag, err := m.pool.Exec(context.Background(), query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
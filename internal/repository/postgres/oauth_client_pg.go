@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type OAuthClientPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewOAuthClientPostgres(pool *pgxpool.Pool) *OAuthClientPostgres {
+	return &OAuthClientPostgres{pool: pool}
+}
+
+const oauthClientColumns = "id, secret_hash, name, redirect_uris, grant_types, scopes, trusted, created_at"
+
+func scanOAuthClient(row pgx.Row) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	err := row.Scan(
+		&client.ID, &client.SecretHash, &client.Name, &client.RedirectURIs,
+		&client.GrantTypes, &client.Scopes, &client.Trusted, &client.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan oauth client: %w", err)
+	}
+	return &client, nil
+}
+
+func (oc *OAuthClientPostgres) Create(client *entity.OAuthClient) error {
+	query := `
+	INSERT INTO oauth_clients (` + oauthClientColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (id) DO NOTHING
+	`
+	cmdTag, err := oc.pool.Exec(context.Background(), query,
+		client.ID, client.SecretHash, client.Name, client.RedirectURIs,
+		client.GrantTypes, client.Scopes, client.Trusted, client.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth client: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrConflict
+	}
+	return nil
+}
+
+func (oc *OAuthClientPostgres) GetByID(clientID string) (*entity.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE id = $1`
+	return scanOAuthClient(oc.pool.QueryRow(context.Background(), query, clientID))
+}
+
+func (oc *OAuthClientPostgres) List() ([]*entity.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at`
+	rows, err := oc.pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []*entity.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", err)
+	}
+	return clients, nil
+}
+
+func (oc *OAuthClientPostgres) Delete(clientID string) error {
+	cmdTag, err := oc.pool.Exec(context.Background(), `DELETE FROM oauth_clients WHERE id = $1`, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
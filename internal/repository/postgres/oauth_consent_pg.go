@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type OAuthConsentPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewOAuthConsentPostgres(pool *pgxpool.Pool) *OAuthConsentPostgres {
+	return &OAuthConsentPostgres{pool: pool}
+}
+
+func (ocs *OAuthConsentPostgres) Get(userID uuid.UUID, clientID string) (*entity.OAuthConsent, error) {
+	query := `
+	SELECT user_id, client_id, scopes, granted_at
+	FROM oauth_consents
+	WHERE user_id = $1 AND client_id = $2
+	`
+	var consent entity.OAuthConsent
+	err := ocs.pool.QueryRow(context.Background(), query, userID, clientID).Scan(
+		&consent.UserID, &consent.ClientID, &consent.Scopes, &consent.GrantedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth consent: %w", err)
+	}
+	return &consent, nil
+}
+
+func (ocs *OAuthConsentPostgres) Grant(userID uuid.UUID, clientID string, scopes []string) error {
+	query := `
+	INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at)
+	VALUES ($1, $2, $3, NOW())
+	ON CONFLICT (user_id, client_id) DO UPDATE
+	SET scopes = ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)),
+		granted_at = NOW()
+	`
+	if _, err := ocs.pool.Exec(context.Background(), query, userID, clientID, scopes); err != nil {
+		return fmt.Errorf("failed to save oauth consent: %w", err)
+	}
+	return nil
+}
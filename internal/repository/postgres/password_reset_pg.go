@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PasswordResetPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasswordResetPostgres(pool *pgxpool.Pool) *PasswordResetPostgres {
+	return &PasswordResetPostgres{pool: pool}
+}
+
+func (pr *PasswordResetPostgres) Create(token *entity.PasswordResetToken) error {
+	query := `
+	INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := pr.pool.Exec(context.Background(),
+		query, token.ID, token.UserID, token.TokenHash, token.CreatedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+func (pr *PasswordResetPostgres) GetByHash(tokenHash string) (*entity.PasswordResetToken, error) {
+	query := `
+	SELECT id, user_id, token_hash, created_at, expires_at, used_at
+	FROM password_reset_tokens WHERE token_hash = $1
+	`
+	var token entity.PasswordResetToken
+	err := pr.pool.QueryRow(context.Background(), query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password reset token: %w", err)
+	}
+	return &token, nil
+}
+
+func (pr *PasswordResetPostgres) MarkUsed(id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE password_reset_tokens
+	SET used_at = NOW()
+	WHERE id = $1 AND used_at IS NULL AND expires_at > NOW()
+	`
+	cmdTag, err := pr.pool.Exec(context.Background(), query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark password reset token as used: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+// InvalidateForUser spends every outstanding token of the user, so only the
+// most recent reset mail works.
+func (pr *PasswordResetPostgres) InvalidateForUser(userID uuid.UUID) error {
+	query := `
+	UPDATE password_reset_tokens
+	SET used_at = NOW()
+	WHERE user_id = $1 AND used_at IS NULL
+	`
+	_, err := pr.pool.Exec(context.Background(), query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+	}
+	return nil
+}
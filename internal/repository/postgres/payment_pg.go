@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PaymentPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewPaymentPostgres(pool *pgxpool.Pool) *PaymentPostgres {
+	return &PaymentPostgres{pool: pool}
+}
+
+func (p *PaymentPostgres) Create(intent *entity.PaymentIntent) error {
+	query := `
+	INSERT INTO payment_intents (id, user_id, amount, currency, provider, reference, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := p.pool.Exec(context.Background(), query,
+		intent.ID, intent.UserID, intent.Amount.Amount, intent.Amount.Currency, intent.Provider, intent.Reference,
+		intent.Status, intent.CreatedAt, intent.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create payment intent: %w", err)
+	}
+	return nil
+}
+
+func (p *PaymentPostgres) SetReference(id uuid.UUID, reference string) error {
+	query := `
+	UPDATE payment_intents
+	SET reference = $2, updated_at = NOW()
+	WHERE id = $1
+	`
+	cmdTag, err := p.pool.Exec(context.Background(), query, id, reference)
+	if err != nil {
+		return fmt.Errorf("failed to set payment reference: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
+
+func (p *PaymentPostgres) GetByReference(provider, reference string) (*entity.PaymentIntent, error) {
+	query := `
+	SELECT id, user_id, amount, currency, provider, reference, status, created_at, updated_at
+	FROM payment_intents
+	WHERE provider = $1 AND reference = $2
+	`
+	var intent entity.PaymentIntent
+	err := p.pool.QueryRow(context.Background(), query, provider, reference).Scan(
+		&intent.ID, &intent.UserID, &intent.Amount.Amount, &intent.Amount.Currency, &intent.Provider, &intent.Reference,
+		&intent.Status, &intent.CreatedAt, &intent.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment intent: %w", err)
+	}
+	return &intent, nil
+}
+
+func (p *PaymentPostgres) Succeed(id uuid.UUID) (bool, error) {
+	ctx := context.Background()
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the status check serializes concurrent webhooks on the row lock
+	query := `
+	UPDATE payment_intents
+	SET status = 'succeeded', updated_at = NOW()
+	WHERE id = $1 AND status = 'pending'
+	RETURNING user_id, amount, currency
+	`
+	var userID uuid.UUID
+	var amount entity.Money
+	err = tx.QueryRow(ctx, query, id).Scan(&userID, &amount.Amount, &amount.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to confirm payment intent: %w", err)
+	}
+
+	err = postTransaction(ctx, tx, &entity.WalletTransaction{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Amount:    amount,
+		Kind:      entity.TransactionTopUp,
+		Reference: id.String(),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit top-up: %w", err)
+	}
+	return true, nil
+}
+
+func (p *PaymentPostgres) Fail(id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE payment_intents
+	SET status = 'failed', updated_at = NOW()
+	WHERE id = $1 AND status = 'pending'
+	`
+	cmdTag, err := p.pool.Exec(context.Background(), query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to fail payment intent: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+)
+
+// SQLSTATE codes the repositories turn into entity errors
+const (
+	pgCheckViolation  = "23514"
+	pgUniqueViolation = "23505"
+)
+
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+// isUniqueViolationOn tells a violation of one unique index apart from
+// others on the same table.
+func isUniqueViolationOn(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && pgErr.ConstraintName == constraint
+}
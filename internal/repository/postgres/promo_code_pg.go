@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PromoCodePostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewPromoCodePostgres(pool *pgxpool.Pool) *PromoCodePostgres {
+	return &PromoCodePostgres{pool: pool}
+}
+
+const promoCodeColumns = `id, code, kind, percent, amount, currency, categories, valid_from, valid_until,
+	max_redemptions, per_user_limit, redemptions, created_by, created_at`
+
+func scanPromoCode(row pgx.Row) (*entity.PromoCode, error) {
+	var code entity.PromoCode
+	var amount *int64
+	var currency *string
+	err := row.Scan(
+		&code.ID, &code.Code, &code.Kind, &code.Percent, &amount, &currency, &code.Categories,
+		&code.ValidFrom, &code.ValidUntil, &code.MaxRedemptions, &code.PerUserLimit,
+		&code.Redemptions, &code.CreatedBy, &code.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if amount != nil && currency != nil {
+		code.Amount = &entity.Money{Amount: *amount, Currency: *currency}
+	}
+	return &code, nil
+}
+
+func (p *PromoCodePostgres) Create(code *entity.PromoCode) error {
+	categories := code.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	var amount *int64
+	var currency *string
+	if code.Amount != nil {
+		amount, currency = &code.Amount.Amount, &code.Amount.Currency
+	}
+
+	query := `
+	INSERT INTO promo_codes (id, code, kind, percent, amount, currency, categories, valid_from, valid_until,
+		max_redemptions, per_user_limit, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err := p.pool.Exec(context.Background(), query,
+		code.ID, code.Code, code.Kind, code.Percent, amount, currency, categories, code.ValidFrom, code.ValidUntil,
+		code.MaxRedemptions, code.PerUserLimit, code.CreatedBy, code.CreatedAt,
+	)
+	if isPgError(err, pgUniqueViolation) {
+		return entity.ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create promo code: %w", err)
+	}
+	return nil
+}
+
+func (p *PromoCodePostgres) GetByCode(code string) (*entity.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes WHERE code = $1`
+	promo, err := scanPromoCode(p.pool.QueryRow(context.Background(), query, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promo code: %w", err)
+	}
+	return promo, nil
+}
+
+func (p *PromoCodePostgres) List() ([]*entity.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes ORDER BY created_at DESC`
+	rows, err := p.pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promo codes: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []*entity.PromoCode
+	for rows.Next() {
+		code, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan promo code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list promo codes: %w", err)
+	}
+	return codes, nil
+}
+
+func (p *PromoCodePostgres) Deactivate(id uuid.UUID, at time.Time) error {
+	query := `
+	UPDATE promo_codes
+	SET valid_until = LEAST(COALESCE(valid_until, $2), $2)
+	WHERE id = $1
+	`
+	cmdTag, err := p.pool.Exec(context.Background(), query, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate promo code: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
+
+func (p *PromoCodePostgres) CountUserRedemptions(codeID, userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM promo_redemptions WHERE promo_code_id = $1 AND user_id = $2`
+	var count int
+	if err := p.pool.QueryRow(context.Background(), query, codeID, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count promo redemptions: %w", err)
+	}
+	return count, nil
+}
+
+// redeemPromoCode counts the purchase against its promo code inside the
+// purchase transaction. The row lock on the code serializes concurrent
+// redemptions, so neither limit can be overrun.
+func redeemPromoCode(ctx context.Context, tx pgx.Tx, purchase *entity.ReportPurchase) error {
+	query := `
+	UPDATE promo_codes
+	SET redemptions = redemptions + 1
+	WHERE id = $1
+		AND valid_from <= NOW() AND (valid_until IS NULL OR valid_until > NOW())
+		AND (max_redemptions = 0 OR redemptions < max_redemptions)
+	RETURNING per_user_limit
+	`
+	var perUserLimit int
+	err := tx.QueryRow(ctx, query, purchase.PromoCodeID).Scan(&perUserLimit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.ErrPromoCodeUnavailable
+	}
+	if err != nil {
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+
+	if perUserLimit > 0 {
+		var used int
+		query = `SELECT COUNT(*) FROM promo_redemptions WHERE promo_code_id = $1 AND user_id = $2`
+		if err := tx.QueryRow(ctx, query, purchase.PromoCodeID, purchase.UserID).Scan(&used); err != nil {
+			return fmt.Errorf("failed to count promo redemptions: %w", err)
+		}
+		if used >= perUserLimit {
+			return entity.ErrPromoCodeUnavailable
+		}
+	}
+
+	query = `
+	INSERT INTO promo_redemptions (id, promo_code_id, user_id, purchase_id, discount, currency, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = tx.Exec(ctx, query,
+		uuid.New(), purchase.PromoCodeID, purchase.UserID, purchase.ID,
+		purchase.Discount.Amount, purchase.Discount.Currency, purchase.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record promo redemption: %w", err)
+	}
+	return nil
+}
+
+// releasePromoCode gives the redemption of a failed or refunded purchase back.
+func releasePromoCode(ctx context.Context, tx pgx.Tx, purchaseID uuid.UUID) error {
+	query := `
+	WITH released AS (
+		DELETE FROM promo_redemptions WHERE purchase_id = $1 RETURNING promo_code_id
+	)
+	UPDATE promo_codes
+	SET redemptions = redemptions - 1
+	WHERE id IN (SELECT promo_code_id FROM released)
+	`
+	if _, err := tx.Exec(ctx, query, purchaseID); err != nil {
+		return fmt.Errorf("failed to release promo code: %w", err)
+	}
+	return nil
+}
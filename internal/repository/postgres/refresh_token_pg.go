@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type RefreshTokenPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewRefreshTokenPostgres(pool *pgxpool.Pool) *RefreshTokenPostgres {
+	return &RefreshTokenPostgres{pool: pool}
+}
+
+func (rt *RefreshTokenPostgres) Create(token *entity.RefreshToken) error {
+	query := `
+	INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, amr, client_id, scopes, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	scopes := token.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	_, err := rt.pool.Exec(context.Background(),
+		query, token.ID, token.UserID, token.FamilyID, token.TokenHash, token.AMR, token.ClientID, scopes,
+		token.CreatedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+func (rt *RefreshTokenPostgres) GetByHash(tokenHash string) (*entity.RefreshToken, error) {
+	query := `
+	SELECT id, user_id, family_id, token_hash, amr, client_id, scopes, created_at, expires_at, used_at, revoked_at
+	FROM refresh_tokens WHERE token_hash = $1
+	`
+	var token entity.RefreshToken
+	err := rt.pool.QueryRow(context.Background(), query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.AMR, &token.ClientID, &token.Scopes,
+		&token.CreatedAt, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// MarkUsed returns false when the token was already used or revoked, which
+// means somebody is replaying it.
+func (rt *RefreshTokenPostgres) MarkUsed(id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE refresh_tokens
+	SET used_at = NOW()
+	WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+	cmdTag, err := rt.pool.Exec(context.Background(), query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+func (rt *RefreshTokenPostgres) RevokeFamily(familyID uuid.UUID) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = NOW()
+	WHERE family_id = $1 AND revoked_at IS NULL
+	`
+	_, err := rt.pool.Exec(context.Background(), query, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func (rt *RefreshTokenPostgres) RevokeAllForUser(userID uuid.UUID) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	_, err := rt.pool.Exec(context.Background(), query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+	return nil
+}
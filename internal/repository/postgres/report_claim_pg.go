@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ReportClaimPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewReportClaimPostgres(pool *pgxpool.Pool) *ReportClaimPostgres {
+	return &ReportClaimPostgres{pool: pool}
+}
+
+func (r *ReportClaimPostgres) Claim(clientGeneratedID string, userID uuid.UUID) error {
+	// the no-op update makes RETURNING give the owner of an existing claim
+	query := `
+	INSERT INTO report_claims (client_generated_id, user_id, claimed_at)
+	VALUES ($1, $2, NOW())
+	ON CONFLICT (client_generated_id) DO UPDATE
+	SET claimed_at = report_claims.claimed_at
+	RETURNING user_id
+	`
+	var owner uuid.UUID
+	if err := r.pool.QueryRow(context.Background(), query, clientGeneratedID, userID).Scan(&owner); err != nil {
+		return fmt.Errorf("failed to claim reports: %w", err)
+	}
+	if owner != userID {
+		return entity.ErrConflict
+	}
+	return nil
+}
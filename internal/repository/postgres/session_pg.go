@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type SessionPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewSessionPostgres(pool *pgxpool.Pool) *SessionPostgres {
+	return &SessionPostgres{pool: pool}
+}
+
+func (s *SessionPostgres) Record(session *entity.Session) error {
+	query := `
+	INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO UPDATE
+	SET user_agent = EXCLUDED.user_agent,
+		ip = EXCLUDED.ip,
+		last_seen_at = EXCLUDED.last_seen_at,
+		expires_at = EXCLUDED.expires_at
+	WHERE sessions.user_id = EXCLUDED.user_id
+	`
+	_, err := s.pool.Exec(context.Background(), query,
+		session.ID, session.UserID, session.UserAgent, session.IP,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionPostgres) ListActiveByUser(userID uuid.UUID) ([]*entity.Session, error) {
+	query := `
+	SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at
+	FROM sessions
+	WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	ORDER BY last_seen_at DESC
+	`
+	rows, err := s.pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*entity.Session
+	for rows.Next() {
+		var session entity.Session
+		if err := rows.Scan(
+			&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (s *SessionPostgres) Revoke(userID, id uuid.UUID) error {
+	query := `
+	UPDATE sessions
+	SET revoked_at = NOW()
+	WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+	cmdTag, err := s.pool.Exec(context.Background(), query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
+
+func (s *SessionPostgres) RevokeAllForUser(userID uuid.UUID) error {
+	query := `
+	UPDATE sessions
+	SET revoked_at = NOW()
+	WHERE user_id = $1 AND revoked_at IS NULL
+	`
+	if _, err := s.pool.Exec(context.Background(), query, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
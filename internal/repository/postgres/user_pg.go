@@ -3,9 +3,12 @@ package postgres
 import (
 	"auth/internal/entity"
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -19,6 +22,9 @@ List() ([]*User, error)
 Exists(username string) (bool, error)
 */
 
+// unique index on lower(email), see migrations/022_unique_user_email.sql
+const usersEmailIndex = "users_lower_email_key"
+
 type UserPostgres struct {
 	pool *pgxpool.Pool
 }
@@ -29,76 +35,91 @@ func NewUserPostgres(pool *pgxpool.Pool) *UserPostgres {
 
 func (pu *UserPostgres) Create(user *entity.User) error {
 	query := `
-	INSERT INTO users (id, username, email, password_hash, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6)
+	INSERT INTO users (id, username, email, password_hash, roles, email_verified, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 	_, err := pu.pool.Exec(context.Background(),
-		query, user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt,
+		query, user.ID, user.Username, user.Email, user.PasswordHash, user.Roles, user.EmailVerified, user.CreatedAt, user.UpdatedAt,
 	)
+	if isUniqueViolationOn(err, usersEmailIndex) {
+		return entity.ErrEmailTaken
+	}
 	if err != nil {
 		return fmt.Errorf("cannot create user %v", err)
 	}
 	return nil
 }
 
-func (pu *UserPostgres) GetByUsername(username string) (*entity.User, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE username = $1`
-
-	row := pu.pool.QueryRow(context.Background(), query, username)
+const userColumns = `id, username, email, password_hash, roles, email_verified, verification_sent_at, created_at, updated_at`
 
+func scanUser(row pgx.Row) (*entity.User, error) {
 	var user entity.User
 	err := row.Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Roles,
+		&user.EmailVerified, &user.VerificationSentAt, &user.CreatedAt, &user.UpdatedAt,
 	)
-
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (pu *UserPostgres) GetByID(id uuid.UUID) (*entity.User, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE id = $1`
+func (pu *UserPostgres) GetByUsername(username string) (*entity.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+	return scanUser(pu.pool.QueryRow(context.Background(), query, username))
+}
 
-	row := pu.pool.QueryRow(context.Background(), query, id)
+func (pu *UserPostgres) GetByEmail(email string) (*entity.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1)`
+	return scanUser(pu.pool.QueryRow(context.Background(), query, email))
+}
 
-	var user entity.User
-	err := row.Scan(
-		&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
-	)
-	//можно добавить обработку ошибок
-	if err != nil {
-		return nil, err
-	}
-	return &user, nil
+func (pu *UserPostgres) GetByID(id uuid.UUID) (*entity.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	return scanUser(pu.pool.QueryRow(context.Background(), query, id))
 }
 
+// Update uses user.UpdatedAt as the expected version of the row: if the row
+// was modified since, entity.ErrConflict is returned. On success UpdatedAt is
+// set to the new version.
 func (pu *UserPostgres) Update(user *entity.User) error {
 	query := `
 		UPDATE users
 		SET username = $1,
 			email = $2,
 			password_hash = $3,
+			email_verified = $4,
 			updated_at = NOW()
-		WHERE id = $4
+		WHERE id = $5 AND updated_at = $6
+		RETURNING updated_at
 	`
 
-	cmdTag, err := pu.pool.Exec(
+	err := pu.pool.QueryRow(
 		context.Background(),
 		query,
 		user.Username,
 		user.Email,
 		user.PasswordHash,
+		user.EmailVerified,
 		user.ID,
-	)
+		user.UpdatedAt,
+	).Scan(&user.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, getErr := pu.GetByID(user.ID); getErr != nil {
+			return getErr
+		}
+		return entity.ErrConflict
+	}
+	if isUniqueViolationOn(err, usersEmailIndex) {
+		return entity.ErrEmailTaken
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("no user found with id %s", user.ID)
-	}
-
 	return nil
 }
 
@@ -111,14 +132,14 @@ func (pu *UserPostgres) Delete(id uuid.UUID) error {
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("no user found with id %s", id)
+		return entity.ErrNotFound
 	}
 
 	return nil
 }
 
 func (pu *UserPostgres) List() ([]*entity.User, error) {
-	query := `SELECT username, email FROM users`
+	query := `SELECT ` + userColumns + ` FROM users`
 	rows, err := pu.pool.Query(context.Background(), query)
 	if err != nil {
 		return nil, fmt.Errorf("we cannot list users, pls check database %v", err)
@@ -128,12 +149,11 @@ func (pu *UserPostgres) List() ([]*entity.User, error) {
 	var users []*entity.User
 
 	for rows.Next() {
-		var user entity.User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
-		users = append(users, &user)
+		users = append(users, user)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows iteration error: %w", err)
@@ -155,20 +175,85 @@ func (pu *UserPostgres) Exists(username string) (bool, error) {
 	return exists, nil
 }
 
-func (pu *UserPostgres) UpdateBalance(userID uuid.UUID, balance float64) error {
+func (pu *UserPostgres) UpdateRoles(userID uuid.UUID, roles []string) error {
 	query := `
 	UPDATE users
-	SET balance = $1
+	SET roles = $1,
+		updated_at = NOW()
 	WHERE id = $2
 	`
-	cmdTag, err := pu.pool.Exec(context.Background(), query, balance, userID)
+	cmdTag, err := pu.pool.Exec(context.Background(), query, roles, userID)
 	if err != nil {
-		return fmt.Errorf("failed to update user balance: %w", err)
+		return fmt.Errorf("failed to update user roles: %w", err)
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return fmt.Errorf("no user found with id %s", userID)
+		return entity.ErrNotFound
 	}
 
 	return nil
 }
+
+func (pu *UserPostgres) UpdatePassword(userID uuid.UUID, passwordHash string) error {
+	query := `
+	UPDATE users
+	SET password_hash = $1,
+		updated_at = NOW()
+	WHERE id = $2
+	`
+	cmdTag, err := pu.pool.Exec(context.Background(), query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user password: %w", err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailVerified only succeeds while the address is still the one the link
+// was sent to.
+func (pu *UserPostgres) MarkEmailVerified(userID uuid.UUID, email string) (bool, error) {
+	query := `
+	UPDATE users
+	SET email_verified = TRUE,
+		updated_at = NOW()
+	WHERE id = $1 AND email = $2
+	`
+	cmdTag, err := pu.pool.Exec(context.Background(), query, userID, email)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark email as verified: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+// TouchVerificationSent records a verification mail unless one was sent after
+// notBefore, so concurrent resend requests cannot both pass the throttle.
+func (pu *UserPostgres) TouchVerificationSent(userID uuid.UUID, notBefore time.Time) (bool, error) {
+	query := `
+	UPDATE users
+	SET verification_sent_at = NOW()
+	WHERE id = $1 AND (verification_sent_at IS NULL OR verification_sent_at < $2)
+	`
+	cmdTag, err := pu.pool.Exec(context.Background(), query, userID, notBefore)
+	if err != nil {
+		return false, fmt.Errorf("failed to update verification timestamp: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+// TouchPasswordResetSent is TouchVerificationSent for password reset mails.
+func (pu *UserPostgres) TouchPasswordResetSent(userID uuid.UUID, notBefore time.Time) (bool, error) {
+	query := `
+	UPDATE users
+	SET password_reset_sent_at = NOW()
+	WHERE id = $1 AND (password_reset_sent_at IS NULL OR password_reset_sent_at < $2)
+	`
+	cmdTag, err := pu.pool.Exec(context.Background(), query, userID, notBefore)
+	if err != nil {
+		return false, fmt.Errorf("failed to update password reset timestamp: %w", err)
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,356 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type WalletPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewWalletPostgres(pool *pgxpool.Pool) *WalletPostgres {
+	return &WalletPostgres{pool: pool}
+}
+
+func (w *WalletPostgres) GetBalances(userID uuid.UUID) ([]entity.Money, error) {
+	rows, err := w.pool.Query(context.Background(),
+		`SELECT balance, currency FROM wallets WHERE user_id = $1 ORDER BY currency`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []entity.Money
+	for rows.Next() {
+		var balance entity.Money
+		if err := rows.Scan(&balance.Amount, &balance.Currency); err != nil {
+			return nil, fmt.Errorf("failed to scan wallet balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get wallet balances: %w", err)
+	}
+	return balances, nil
+}
+
+func (w *WalletPostgres) ListTransactions(userID uuid.UUID, limit int) ([]*entity.WalletTransaction, error) {
+	query := `
+	SELECT id, user_id, amount, balance_after, currency, kind, reference,
+		exchange_rate, original_amount, original_currency, created_at
+	FROM wallet_transactions
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	LIMIT $2
+	`
+	rows, err := w.pool.Query(context.Background(), query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallet transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []*entity.WalletTransaction
+	for rows.Next() {
+		var transaction entity.WalletTransaction
+		var rate, originalCurrency *string
+		var originalAmount *int64
+		if err := rows.Scan(
+			&transaction.ID, &transaction.UserID, &transaction.Amount.Amount, &transaction.BalanceAfter.Amount,
+			&transaction.Amount.Currency, &transaction.Kind, &transaction.Reference,
+			&rate, &originalAmount, &originalCurrency, &transaction.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan wallet transaction: %w", err)
+		}
+		if rate != nil && originalAmount != nil && originalCurrency != nil {
+			transaction.Exchange = &entity.Exchange{
+				Rate:     *rate,
+				Original: entity.Money{Amount: *originalAmount, Currency: *originalCurrency},
+			}
+		}
+		transactions = append(transactions, &transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list wallet transactions: %w", err)
+	}
+	for _, transaction := range transactions {
+		transaction.BalanceAfter.Currency = transaction.Amount.Currency
+	}
+	return transactions, nil
+}
+
+func (w *WalletPostgres) StartPurchase(purchase *entity.ReportPurchase) error {
+	ctx := context.Background()
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	debit := &entity.WalletTransaction{
+		ID:        uuid.New(),
+		UserID:    purchase.UserID,
+		Amount:    purchase.Amount.Neg(),
+		Kind:      entity.TransactionPurchase,
+		Reference: purchase.ID.String(),
+		Exchange:  purchase.Exchange,
+		CreatedAt: purchase.CreatedAt,
+	}
+	purchase.TransactionID = debit.ID
+	purchase.Status = entity.PurchasePending
+
+	query := `
+	INSERT INTO report_purchases (id, user_id, report_id, amount, currency, transaction_id, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+	`
+	_, err = tx.Exec(ctx, query,
+		purchase.ID, purchase.UserID, purchase.ReportID, purchase.Amount.Amount, purchase.Amount.Currency,
+		purchase.TransactionID, purchase.Status, purchase.CreatedAt,
+	)
+	if isPgError(err, pgUniqueViolation) {
+		return entity.ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record purchase: %w", err)
+	}
+
+	if purchase.PromoCodeID != nil {
+		if err := redeemPromoCode(ctx, tx, purchase); err != nil {
+			return err
+		}
+	}
+
+	if err := postTransaction(ctx, tx, debit); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (w *WalletPostgres) CompletePurchase(purchaseID uuid.UUID) error {
+	query := `
+	UPDATE report_purchases
+	SET status = 'completed', updated_at = NOW()
+	WHERE id = $1 AND status = 'pending'
+	`
+	if _, err := w.pool.Exec(context.Background(), query, purchaseID); err != nil {
+		return fmt.Errorf("failed to complete purchase: %w", err)
+	}
+	return nil
+}
+
+func (w *WalletPostgres) FailPurchase(purchaseID uuid.UUID) error {
+	ctx := context.Background()
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	UPDATE report_purchases
+	SET status = 'failed', updated_at = NOW()
+	WHERE id = $1 AND status = 'pending'
+	RETURNING user_id, amount, currency
+	`
+	var userID uuid.UUID
+	var amount entity.Money
+	err = tx.QueryRow(ctx, query, purchaseID).Scan(&userID, &amount.Amount, &amount.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fail purchase: %w", err)
+	}
+	if err := releasePromoCode(ctx, tx, purchaseID); err != nil {
+		return err
+	}
+
+	err = postTransaction(ctx, tx, &entity.WalletTransaction{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Amount:    amount,
+		Kind:      entity.TransactionPurchaseReverse,
+		Reference: purchaseID.String(),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (w *WalletPostgres) ListPendingPurchases(startedBefore time.Time) ([]*entity.ReportPurchase, error) {
+	query := `
+	SELECT id, user_id, report_id, amount, currency, transaction_id, status, created_at, updated_at
+	FROM report_purchases
+	WHERE status = 'pending' AND created_at < $1
+	ORDER BY created_at
+	`
+	rows, err := w.pool.Query(context.Background(), query, startedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []*entity.ReportPurchase
+	for rows.Next() {
+		var purchase entity.ReportPurchase
+		if err := rows.Scan(
+			&purchase.ID, &purchase.UserID, &purchase.ReportID, &purchase.Amount.Amount, &purchase.Amount.Currency,
+			&purchase.TransactionID, &purchase.Status, &purchase.CreatedAt, &purchase.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan purchase: %w", err)
+		}
+		purchases = append(purchases, &purchase)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending purchases: %w", err)
+	}
+	return purchases, nil
+}
+
+func (w *WalletPostgres) RefundPurchase(refund *entity.ReportRefund) error {
+	ctx := context.Background()
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the row lock makes a concurrent refund of the same purchase find nothing
+	query := `
+	UPDATE report_purchases
+	SET status = 'refunded', updated_at = NOW()
+	WHERE report_id = $1 AND status = 'completed'
+	RETURNING id, user_id, amount, currency
+	`
+	err = tx.QueryRow(ctx, query, refund.ReportID).Scan(&refund.PurchaseID, &refund.UserID, &refund.Amount.Amount, &refund.Amount.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var refunded bool
+		query = `SELECT EXISTS (SELECT 1 FROM report_purchases WHERE report_id = $1 AND status = 'refunded')`
+		if err := tx.QueryRow(ctx, query, refund.ReportID).Scan(&refunded); err != nil {
+			return fmt.Errorf("failed to check refunded purchase: %w", err)
+		}
+		if refunded {
+			return entity.ErrConflict
+		}
+		return entity.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to refund purchase: %w", err)
+	}
+	if err := releasePromoCode(ctx, tx, refund.PurchaseID); err != nil {
+		return err
+	}
+
+	credit := &entity.WalletTransaction{
+		ID:        uuid.New(),
+		UserID:    refund.UserID,
+		Amount:    refund.Amount,
+		Kind:      entity.TransactionRefund,
+		Reference: refund.ID.String(),
+		CreatedAt: refund.CreatedAt,
+	}
+	if err := postTransaction(ctx, tx, credit); err != nil {
+		return err
+	}
+	refund.TransactionID = credit.ID
+
+	query = `
+	INSERT INTO report_refunds (id, purchase_id, report_id, user_id, amount, currency, reason, actor_id, transaction_id, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.Exec(ctx, query,
+		refund.ID, refund.PurchaseID, refund.ReportID, refund.UserID, refund.Amount.Amount, refund.Amount.Currency,
+		refund.Reason, refund.ActorID, refund.TransactionID, refund.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record refund: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+func (w *WalletPostgres) LastRefund(reportID string) (*entity.ReportRefund, error) {
+	query := `
+	SELECT id, purchase_id, report_id, user_id, amount, currency, reason, actor_id, transaction_id, created_at
+	FROM report_refunds
+	WHERE report_id = $1
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+	var refund entity.ReportRefund
+	err := w.pool.QueryRow(context.Background(), query, reportID).Scan(
+		&refund.ID, &refund.PurchaseID, &refund.ReportID, &refund.UserID, &refund.Amount.Amount, &refund.Amount.Currency,
+		&refund.Reason, &refund.ActorID, &refund.TransactionID, &refund.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, entity.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund: %w", err)
+	}
+	return &refund, nil
+}
+
+// postTransaction moves the balance of the wallet in the transaction's currency
+// and appends the ledger entry inside tx. Credits create the wallet on first use;
+// debits only update an existing one, and a missing wallet or the CHECK on
+// wallets.balance turns an overdraft into ErrInsufficientFunds. Debits cannot
+// use the upsert: Postgres checks the proposed insert row, negative balance
+// included, before it takes the ON CONFLICT path.
+func postTransaction(ctx context.Context, tx pgx.Tx, transaction *entity.WalletTransaction) error {
+	query := `
+	INSERT INTO wallets (user_id, balance, currency, updated_at)
+	VALUES ($1, $2, $3, NOW())
+	ON CONFLICT (user_id, currency) DO UPDATE
+	SET balance = wallets.balance + EXCLUDED.balance,
+		updated_at = NOW()
+	RETURNING balance
+	`
+	if transaction.Amount.Amount < 0 {
+		query = `
+		UPDATE wallets
+		SET balance = balance + $2,
+			updated_at = NOW()
+		WHERE user_id = $1 AND currency = $3
+		RETURNING balance
+		`
+	}
+	transaction.BalanceAfter.Currency = transaction.Amount.Currency
+	err := tx.QueryRow(ctx, query, transaction.UserID, transaction.Amount.Amount, transaction.Amount.Currency).
+		Scan(&transaction.BalanceAfter.Amount)
+	if errors.Is(err, pgx.ErrNoRows) || isPgError(err, pgCheckViolation) {
+		return entity.ErrInsufficientFunds
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update wallet balance: %w", err)
+	}
+
+	var rate, originalCurrency *string
+	var originalAmount *int64
+	if exchange := transaction.Exchange; exchange != nil {
+		rate, originalAmount, originalCurrency = &exchange.Rate, &exchange.Original.Amount, &exchange.Original.Currency
+	}
+
+	query = `
+	INSERT INTO wallet_transactions (id, user_id, amount, balance_after, currency, kind, reference,
+		exchange_rate, original_amount, original_currency, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err = tx.Exec(ctx, query,
+		transaction.ID, transaction.UserID, transaction.Amount.Amount, transaction.BalanceAfter.Amount,
+		transaction.Amount.Currency, transaction.Kind, transaction.Reference,
+		rate, originalAmount, originalCurrency, transaction.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record wallet transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"auth/internal/entity"
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type WebAuthnCredentialPostgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebAuthnCredentialPostgres(pool *pgxpool.Pool) *WebAuthnCredentialPostgres {
+	return &WebAuthnCredentialPostgres{pool: pool}
+}
+
+func (w *WebAuthnCredentialPostgres) Create(credential *entity.WebAuthnCredential) error {
+	query := `
+	INSERT INTO webauthn_credentials (
+		id, user_id, credential_id, public_key, attestation_type, transports, aaguid,
+		sign_count, backup_eligible, backup_state, name, created_at
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	ON CONFLICT (credential_id) DO NOTHING
+	`
+	cmdTag, err := w.pool.Exec(context.Background(), query,
+		credential.ID, credential.UserID, credential.CredentialID, credential.PublicKey,
+		credential.AttestationType, credential.Transports, credential.AAGUID,
+		int64(credential.SignCount), credential.BackupEligible, credential.BackupState,
+		credential.Name, credential.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create webauthn credential: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrConflict
+	}
+	return nil
+}
+
+func (w *WebAuthnCredentialPostgres) ListByUser(userID uuid.UUID) ([]*entity.WebAuthnCredential, error) {
+	query := `
+	SELECT id, user_id, credential_id, public_key, attestation_type, transports, aaguid,
+		sign_count, backup_eligible, backup_state, name, created_at, last_used_at
+	FROM webauthn_credentials
+	WHERE user_id = $1
+	ORDER BY created_at
+	`
+	rows, err := w.pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []*entity.WebAuthnCredential
+	for rows.Next() {
+		var credential entity.WebAuthnCredential
+		var signCount int64
+		if err := rows.Scan(
+			&credential.ID, &credential.UserID, &credential.CredentialID, &credential.PublicKey,
+			&credential.AttestationType, &credential.Transports, &credential.AAGUID,
+			&signCount, &credential.BackupEligible, &credential.BackupState,
+			&credential.Name, &credential.CreatedAt, &credential.LastUsedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webauthn credential: %w", err)
+		}
+		credential.SignCount = uint32(signCount)
+		credentials = append(credentials, &credential)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+func (w *WebAuthnCredentialPostgres) UpdateUsage(id uuid.UUID, signCount uint32, backupState bool) error {
+	query := `
+	UPDATE webauthn_credentials
+	SET sign_count = $2,
+		backup_state = $3,
+		last_used_at = NOW()
+	WHERE id = $1
+	`
+	cmdTag, err := w.pool.Exec(context.Background(), query, id, int64(signCount), backupState)
+	if err != nil {
+		return fmt.Errorf("failed to update webauthn credential: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
+
+func (w *WebAuthnCredentialPostgres) Delete(userID, id uuid.UUID) error {
+	cmdTag, err := w.pool.Exec(context.Background(),
+		`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return entity.ErrNotFound
+	}
+	return nil
+}
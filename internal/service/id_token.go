@@ -0,0 +1,142 @@
+package service
+
+import (
+	"auth/internal/entity"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OpenID Connect scopes we understand.
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// ProfileClaims are the standard claims released for the granted scopes, in
+// ID tokens and from the userinfo endpoint.
+type ProfileClaims struct {
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+func NewProfileClaims(user *entity.User, scopes []string) ProfileClaims {
+	var claims ProfileClaims
+	if slices.Contains(scopes, ScopeProfile) {
+		claims.PreferredUsername = user.Username
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		verified := user.EmailVerified
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+	return claims
+}
+
+type IDTokenClaims struct {
+	Nonce  string   `json:"nonce,omitempty"`
+	AMR    []string `json:"amr,omitempty"`
+	AtHash string   `json:"at_hash,omitempty"`
+	ProfileClaims
+	jwt.RegisteredClaims
+}
+
+// CreateClientAccessToken issues an access token to an OAuth client, for the
+// user or, with client credentials (user is nil), for the client itself. The
+// audience is the client, so the token never passes ValidateJWT as one of ours.
+func (j *jwtService) CreateClientAccessToken(user *entity.User, clientID string, scopes, amr []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(j.ttl)
+	claims := &Claims{
+		AMR:      amr,
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   clientID,
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	if user != nil {
+		claims.Subject = user.ID.String()
+		claims.Username = user.Username
+		claims.EmailVerified = user.EmailVerified
+	}
+
+	signed, err := j.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ValidateClientAccessToken accepts only tokens from CreateClientAccessToken:
+// the audience must be the client_id claim. ID tokens carry no client_id and
+// our own access tokens have the first-party audience, so neither passes.
+func (j *jwtService) ValidateClientAccessToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	if err := j.parse(tokenStr, claims, ""); err != nil {
+		return nil, err
+	}
+
+	if claims.ClientID == "" || !slices.Equal(claims.Audience, jwt.ClaimStrings{claims.ClientID}) {
+		return nil, fmt.Errorf("token was not issued to an OAuth client")
+	}
+	if claims.ID == "" || claims.Subject == "" {
+		return nil, fmt.Errorf("token is missing jti or sub")
+	}
+	return claims, nil
+}
+
+func (j *jwtService) CreateIDToken(user *entity.User, clientID, nonce string, scopes, amr []string, accessToken string) (string, error) {
+	now := time.Now()
+	return j.sign(&IDTokenClaims{
+		Nonce:         nonce,
+		AMR:           amr,
+		AtHash:        j.accessTokenHash(accessToken),
+		ProfileClaims: NewProfileClaims(user, scopes),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID.String(),
+			Issuer:    j.idTokenIssuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.ttl)),
+		},
+	})
+}
+
+func (j *jwtService) SigningAlgorithm() string {
+	return j.keys.active.method.Alg()
+}
+
+// accessTokenHash is the at_hash claim: the left half of the access token
+// hash, with the hash the signing algorithm uses (SHA-512 for Ed25519).
+func (j *jwtService) accessTokenHash(accessToken string) string {
+	if accessToken == "" {
+		return ""
+	}
+	var sum []byte
+	if j.SigningAlgorithm() == jwt.SigningMethodEdDSA.Alg() {
+		full := sha512.Sum512([]byte(accessToken))
+		sum = full[:]
+	} else {
+		full := sha256.Sum256([]byte(accessToken))
+		sum = full[:]
+	}
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"auth/config"
+	"auth/internal/entity"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestClientAccessTokensAreNotFirstPartyTokens(t *testing.T) {
+	jwtService := NewJWTService(NewHMACKeySet("test-secret"), config.AuthConfig{
+		Issuer: "freeze-auth", Audience: "freeze-api", AccessTokenTTL: time.Minute,
+	})
+	user := &entity.User{ID: uuid.New(), Username: "ann"}
+
+	clientToken, _, err := jwtService.CreateClientAccessToken(user, "reports-app", []string{ScopeOpenID}, nil)
+	if err != nil {
+		t.Fatalf("CreateClientAccessToken: %v", err)
+	}
+	claims, err := jwtService.ValidateClientAccessToken(clientToken)
+	if err != nil {
+		t.Fatalf("ValidateClientAccessToken: %v", err)
+	}
+	if claims.ClientID != "reports-app" || claims.Subject != user.ID.String() {
+		t.Errorf("claims = client %q, subject %q", claims.ClientID, claims.Subject)
+	}
+	if _, err := jwtService.ValidateJWT(clientToken); err == nil {
+		t.Error("client access token passed as a first-party access token")
+	}
+
+	ownToken, _, err := jwtService.CreateJWT(user, uuid.NewString(), nil)
+	if err != nil {
+		t.Fatalf("CreateJWT: %v", err)
+	}
+	if _, err := jwtService.ValidateClientAccessToken(ownToken); err == nil {
+		t.Error("first-party access token passed as a client access token")
+	}
+}
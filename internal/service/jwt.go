@@ -1,41 +1,177 @@
 package service
 
 import (
+	"auth/config"
 	"auth/internal/entity"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// Claims are the claims of our access tokens. Subject is the user UUID.
+type Claims struct {
+	Username      string   `json:"username"`
+	Roles         []string `json:"roles,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
+	AMR           []string `json:"amr,omitempty"`
+	// session the token belongs to, see entity.Session
+	SessionID string `json:"sid,omitempty"`
+	// set on tokens issued to OAuth clients (RFC 9068)
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// PurposeClaims are carried by single-purpose tokens (email links, login
+// challenges). The purpose is the audience, so they never pass as access tokens.
+type PurposeClaims struct {
+	Data map[string]string `json:"data,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
 type JWTService interface {
-	CreateJWT(user *entity.User) (string, error)
-	ValidateJWT(token string) (*jwt.Token, error)
+	CreateJWT(user *entity.User, sessionID string, amr []string) (string, time.Time, error)
+	ValidateJWT(token string) (*Claims, error)
+	CreatePurposeToken(purpose, subject string, data map[string]string, ttl time.Duration) (string, error)
+	ValidatePurposeToken(purpose, token string) (*PurposeClaims, error)
+	CreateClientAccessToken(user *entity.User, clientID string, scopes, amr []string) (string, time.Time, error)
+	ValidateClientAccessToken(token string) (*Claims, error)
+	CreateIDToken(user *entity.User, clientID, nonce string, scopes, amr []string, accessToken string) (string, error)
+	SigningAlgorithm() string
+	AccessTokenTTL() time.Duration
+	JWKS() JWKSet
 }
 
 type jwtService struct {
-	secret []byte
+	keys     *KeySet
+	issuer   string
+	audience string
+	ttl      time.Duration
+	leeway   time.Duration
+	// ID tokens are issued under the OpenID Connect issuer URL
+	idTokenIssuer string
+}
+
+func NewJWTService(keys *KeySet, cfg config.AuthConfig) JWTService {
+	return &jwtService{
+		keys:          keys,
+		issuer:        cfg.Issuer,
+		audience:      cfg.Audience,
+		ttl:           cfg.AccessTokenTTL,
+		leeway:        cfg.ClockSkew,
+		idTokenIssuer: cfg.IdentityProvider.Issuer,
+	}
 }
 
-func NewJWTService(secret string) JWTService {
-	return &jwtService{secret: []byte(secret)}
+func (j *jwtService) CreateJWT(user *entity.User, sessionID string, amr []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(j.ttl)
+	claims := &Claims{
+		Username:      user.Username,
+		Roles:         user.Roles,
+		EmailVerified: user.EmailVerified,
+		AMR:           amr,
+		SessionID:     sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID.String(),
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{j.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := j.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
-func (j *jwtService) CreateJWT(user *entity.User) (string, error) {
-	claims := jwt.MapClaims{
-		"username": user.Username,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
-		"iat":      time.Now().Unix(),
+func (j *jwtService) ValidateJWT(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	if err := j.parse(tokenStr, claims, j.audience); err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secret)
+
+	if claims.ID == "" || claims.Subject == "" {
+		return nil, fmt.Errorf("token is missing jti or sub")
+	}
+	return claims, nil
 }
 
-func (j *jwtService) ValidateJWT(tokenStr string) (*jwt.Token, error) {
-	return jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+func (j *jwtService) CreatePurposeToken(purpose, subject string, data map[string]string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return j.sign(&PurposeClaims{
+		Data: data,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   subject,
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{purpose},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+}
+
+func (j *jwtService) ValidatePurposeToken(purpose, tokenStr string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+	if err := j.parse(tokenStr, claims, purpose); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (j *jwtService) sign(claims jwt.Claims) (string, error) {
+	active := j.keys.active
+	token := jwt.NewWithClaims(active.method, claims)
+	if active.kid != "" {
+		token.Header["kid"] = active.kid
+	}
+	return token.SignedString(active.private)
+}
+
+// parse checks signature, issuer and lifetime. An empty audience is not
+// checked here, the caller has to check it against the claims.
+func (j *jwtService) parse(tokenStr string, claims jwt.Claims, audience string) error {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(j.keys.methods()),
+		jwt.WithIssuer(j.issuer),
+		jwt.WithLeeway(j.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := j.keys.lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
-		return j.secret, nil
-	})
+		return key.public, nil
+	}, options...)
+	return err
+}
+
+func (j *jwtService) AccessTokenTTL() time.Duration {
+	return j.ttl
+}
+
+func (j *jwtService) JWKS() JWKSet {
+	return j.keys.JWKS()
 }
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"auth/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey // nil for retired keys that are only kept to verify
+	public  crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens and every key whose tokens are
+// still accepted. Without configured keys it falls back to the HS256 secret.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewHMACKeySet(secret string) *KeySet {
+	key := &signingKey{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	return &KeySet{active: key, keys: map[string]*signingKey{"": key}}
+}
+
+func LoadKeySet(cfg config.AuthConfig) (*KeySet, error) {
+	if len(cfg.SigningKeys) == 0 {
+		return NewHMACKeySet(cfg.JWTSecret), nil
+	}
+
+	set := &KeySet{keys: make(map[string]*signingKey)}
+	for _, keyCfg := range cfg.SigningKeys {
+		key, err := loadSigningKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing key %q: %w", keyCfg.Kid, err)
+		}
+		if _, dup := set.keys[key.kid]; dup {
+			return nil, fmt.Errorf("duplicate signing key id %q", key.kid)
+		}
+		set.keys[key.kid] = key
+	}
+
+	active, ok := set.keys[cfg.ActiveKeyID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", cfg.ActiveKeyID)
+	}
+	if active.private == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", cfg.ActiveKeyID)
+	}
+	set.active = active
+
+	return set, nil
+}
+
+func loadSigningKey(cfg config.SigningKeyConfig) (*signingKey, error) {
+	if cfg.Kid == "" {
+		return nil, fmt.Errorf("kid is required")
+	}
+
+	path := cfg.PrivateKeyPath
+	if path == "" {
+		path = cfg.PublicKeyPath
+	}
+	if path == "" {
+		return nil, fmt.Errorf("private_key_path or public_key_path is required")
+	}
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: cfg.Kid}
+	switch cfg.Algorithm {
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyPath != "" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, &private.PublicKey
+		} else if key.public, err = jwt.ParseRSAPublicKeyFromPEM(pemBytes); err != nil {
+			return nil, err
+		}
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyPath != "" {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes)
+			if err != nil {
+				return nil, err
+			}
+			key.private, key.public = private, private.(ed25519.PrivateKey).Public()
+		} else if key.public, err = jwt.ParseEdPublicKeyFromPEM(pemBytes); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	return key, nil
+}
+
+func (ks *KeySet) lookup(kid string) (*signingKey, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *KeySet) methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, key := range ks.keys {
+		if alg := key.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWKS publishes the public half of every asymmetric key. HMAC secrets are
+// never published.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
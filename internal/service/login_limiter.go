@@ -0,0 +1,78 @@
+package service
+
+import (
+	"auth/config"
+	"auth/internal/entity"
+	"strings"
+	"time"
+)
+
+// LoginLimiter locks an account or an IP after too many failed logins. Each
+// failure past the threshold doubles the lockout, up to MaxLockout.
+type LoginLimiter struct {
+	repo entity.LoginAttemptRepository
+	cfg  config.LoginProtectionConfig
+}
+
+func NewLoginLimiter(repo entity.LoginAttemptRepository, cfg config.LoginProtectionConfig) *LoginLimiter {
+	return &LoginLimiter{repo: repo, cfg: cfg}
+}
+
+func AccountKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter returns how long the caller has to wait, zero if not locked.
+func (l *LoginLimiter) RetryAfter(username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{AccountKey(username), IPKey(ip)} {
+		until, err := l.repo.LockedUntil(key)
+		if err != nil {
+			return 0, err
+		}
+		if until != nil && time.Until(*until) > wait {
+			wait = time.Until(*until)
+		}
+	}
+	return wait, nil
+}
+
+func (l *LoginLimiter) Fail(username, ip string) error {
+	if err := l.fail(AccountKey(username), l.cfg.MaxAccountFailures); err != nil {
+		return err
+	}
+	return l.fail(IPKey(ip), l.cfg.MaxIPFailures)
+}
+
+// Succeed only clears the account counter: resetting the IP as well would let
+// an attacker clear it by logging into an account of their own.
+func (l *LoginLimiter) Succeed(username string) error {
+	return l.repo.Reset(AccountKey(username))
+}
+
+func (l *LoginLimiter) Unlock(username string) error {
+	return l.repo.Reset(AccountKey(username))
+}
+
+func (l *LoginLimiter) fail(key string, threshold int) error {
+	failures, err := l.repo.RecordFailure(key, l.cfg.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if failures < threshold {
+		return nil
+	}
+
+	lockout := l.cfg.BaseLockout
+	for i := threshold; i < failures && lockout < l.cfg.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.cfg.MaxLockout {
+		lockout = l.cfg.MaxLockout
+	}
+	return l.repo.LockUntil(key, time.Now().Add(lockout))
+}
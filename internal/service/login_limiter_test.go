@@ -0,0 +1,73 @@
+package service
+
+import (
+	"auth/config"
+	"testing"
+	"time"
+)
+
+// loginAttempts counts failures without a window, enough for one test.
+type loginAttempts struct {
+	failures    map[string]int
+	lockedUntil map[string]time.Time
+}
+
+func newLoginAttempts() *loginAttempts {
+	return &loginAttempts{failures: map[string]int{}, lockedUntil: map[string]time.Time{}}
+}
+
+func (l *loginAttempts) RecordFailure(key string, _ time.Duration) (int, error) {
+	l.failures[key]++
+	return l.failures[key], nil
+}
+
+func (l *loginAttempts) LockUntil(key string, until time.Time) error {
+	l.lockedUntil[key] = until
+	return nil
+}
+
+func (l *loginAttempts) LockedUntil(key string) (*time.Time, error) {
+	until, ok := l.lockedUntil[key]
+	if !ok {
+		return nil, nil
+	}
+	return &until, nil
+}
+
+func (l *loginAttempts) Reset(key string) error {
+	delete(l.failures, key)
+	delete(l.lockedUntil, key)
+	return nil
+}
+
+func TestLoginLimiterDoublesLockout(t *testing.T) {
+	limiter := NewLoginLimiter(newLoginAttempts(), config.LoginProtectionConfig{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      100,
+		FailureWindow:      time.Hour,
+		BaseLockout:        30 * time.Second,
+		MaxLockout:         2 * time.Minute,
+	})
+
+	// lockout after each failure: none below the threshold, then doubling up to the cap
+	want := []time.Duration{0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute}
+	for i, lockout := range want {
+		if err := limiter.Fail("Ann", "192.0.2.1"); err != nil {
+			t.Fatalf("Fail: %v", err)
+		}
+		wait, err := limiter.RetryAfter("ann", "192.0.2.2")
+		if err != nil {
+			t.Fatalf("RetryAfter: %v", err)
+		}
+		if wait > lockout || wait < lockout-5*time.Second {
+			t.Errorf("after %d failures wait %s, want %s", i+1, wait.Round(time.Second), lockout)
+		}
+	}
+
+	if err := limiter.Succeed("ann"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	if wait, _ := limiter.RetryAfter("ann", "192.0.2.2"); wait != 0 {
+		t.Errorf("account still locked for %s after a successful login", wait)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"auth/config"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+
+// OIDCIdentity is what we take from a verified ID token.
+type OIDCIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+// OIDCProvider is an OpenID Connect client for one provider. Discovery runs on
+// first use, so a provider that is down does not keep the service from starting.
+type OIDCProvider struct {
+	cfg         config.OIDCProviderConfig
+	redirectURL string
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCProviders(cfgs []config.OIDCProviderConfig, publicURL string) map[string]*OIDCProvider {
+	providers := make(map[string]*OIDCProvider, len(cfgs))
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = &OIDCProvider{
+			cfg:         cfg,
+			redirectURL: strings.TrimRight(publicURL, "/") + "/oauth/" + cfg.Name + "/callback",
+		}
+	}
+	return providers
+}
+
+// AuthCodeURL is where the browser is sent to log in, with PKCE (S256).
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	oauthCfg, _, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	return oauthCfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code and verifies the ID token, including
+// its signature against the provider JWKS and the nonce sent in AuthCodeURL.
+func (p *OIDCProvider) Exchange(code, verifier, nonce string) (*OIDCIdentity, error) {
+	oauthCfg, idVerifier, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	token, err := oauthCfg.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	idToken, err := idVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id_token claims: %w", err)
+	}
+
+	return &OIDCIdentity{
+		Provider:          p.cfg.Name,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *OIDCProvider) discover() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, p.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover %s: %w", p.cfg.Name, err)
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.redirectURL,
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	return p.oauth, p.verifier, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"auth/config"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrRateUnavailable = errors.New("no exchange rate for these currencies")
+
+// RateProvider tells how many units of currency to one unit of from is worth,
+// as a decimal string suitable for entity.Money.Convert.
+type RateProvider interface {
+	Rate(from, to string) (string, error)
+}
+
+func NewRateProvider(cfg config.ExchangeRatesConfig) (RateProvider, error) {
+	switch cfg.Provider {
+	case "static":
+		return LoadStaticRates(cfg.File)
+	default:
+		return nil, fmt.Errorf("unknown exchange rate provider %q", cfg.Provider)
+	}
+}
+
+// StaticRateProvider serves rates from a file, for offline use. The file maps
+// "FROM/TO" pairs to the rate; the reverse pair is derived when missing.
+//
+//	USD/RUB: '92.50'
+//	EUR/RUB: '100.10'
+type StaticRateProvider struct {
+	rates map[string]string
+}
+
+func LoadStaticRates(path string) (*StaticRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	var raw map[string]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+
+	for pair, value := range raw {
+		from, to, ok := strings.Cut(pair, "/")
+		rate, valid := new(big.Rat).SetString(value)
+		if !ok || from == "" || to == "" || !valid || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %s: %q", pair, value)
+		}
+	}
+	return &StaticRateProvider{rates: raw}, nil
+}
+
+func (s *StaticRateProvider) Rate(from, to string) (string, error) {
+	if from == to {
+		return "1", nil
+	}
+	if rate, ok := s.rates[from+"/"+to]; ok {
+		return rate, nil
+	}
+	if rate, ok := s.rates[to+"/"+from]; ok {
+		// validated on load; 10 decimals is well below a minor unit
+		reverse, _ := new(big.Rat).SetString(rate)
+		inverse := new(big.Rat).Inv(reverse).FloatString(10)
+		return strings.TrimRight(strings.TrimRight(inverse, "0"), "."), nil
+	}
+	return "", ErrRateUnavailable
+}
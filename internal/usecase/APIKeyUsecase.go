@@ -0,0 +1,152 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/pkg/logger"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+type APIKeyUsecase interface {
+	CreateKey(userID uuid.UUID, req APIKeyRequest) (*CreatedAPIKey, error)
+	ListKeys(userID uuid.UUID) ([]*entity.APIKey, error)
+	RevokeKey(userID, keyID uuid.UUID) error
+	Authenticate(rawKey string) (*entity.APIKey, *entity.User, error)
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey carries the key itself, which is only shown once.
+type CreatedAPIKey struct {
+	*entity.APIKey
+	Key string `json:"key"`
+}
+
+const (
+	// the prefix makes leaked keys easy to find with secret scanners
+	apiKeyPrefix        = "frz_"
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	maxAPIKeyNameLength = 64
+	maxAPIKeysPerUser   = 20
+	// last_used_at is informational, one write a minute per key is enough
+	apiKeyUsageResolution = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked api key")
+
+type apiKeyUsecase struct {
+	keyRepo  entity.APIKeyRepository
+	userRepo entity.UserRepository
+}
+
+func NewAPIKeyUsecase(keyRepo entity.APIKeyRepository, userRepo entity.UserRepository) *apiKeyUsecase {
+	return &apiKeyUsecase{
+		keyRepo:  keyRepo,
+		userRepo: userRepo,
+	}
+}
+
+func (a *apiKeyUsecase) CreateKey(userID uuid.UUID, req APIKeyRequest) (*CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return nil, &ValidationError{Field: "name", Message: fmt.Sprintf("must be 1-%d characters long", maxAPIKeyNameLength)}
+	}
+	for _, scope := range req.Scopes {
+		if !entity.IsValidAPIKeyScope(scope) {
+			return nil, &ValidationError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q", scope)}
+		}
+	}
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, &ValidationError{Field: "expires_at", Message: "must be in the future"}
+	}
+
+	existing, err := a.keyRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	active := 0
+	for _, key := range existing {
+		if key.RevokedAt == nil && (key.ExpiresAt == nil || key.ExpiresAt.After(now)) {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, &ValidationError{Field: "name", Message: fmt.Sprintf("at most %d active keys are allowed, revoke one first", maxAPIKeysPerUser)}
+	}
+
+	secret, err := service.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	rawKey := apiKeyPrefix + secret
+
+	key := &entity.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    rawKey[:apiKeyDisplayLength],
+		KeyHash:   service.HashToken(rawKey),
+		Scopes:    req.Scopes,
+		CreatedAt: now,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if err := a.keyRepo.Create(key); err != nil {
+		return nil, err
+	}
+	return &CreatedAPIKey{APIKey: key, Key: rawKey}, nil
+}
+
+func (a *apiKeyUsecase) ListKeys(userID uuid.UUID) ([]*entity.APIKey, error) {
+	return a.keyRepo.ListByUser(userID)
+}
+
+func (a *apiKeyUsecase) RevokeKey(userID, keyID uuid.UUID) error {
+	return a.keyRepo.Revoke(userID, keyID)
+}
+
+// Authenticate resolves a key to its owner. The user is loaded on every call,
+// so role changes and deleted accounts take effect immediately.
+func (a *apiKeyUsecase) Authenticate(rawKey string) (*entity.APIKey, *entity.User, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := a.keyRepo.GetByHash(service.HashToken(rawKey))
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := a.userRepo.GetByID(key.UserID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := a.keyRepo.TouchLastUsed(key.ID, now, now.Add(-apiKeyUsageResolution)); err != nil {
+		logger.Logger.Error().Err(err).Str("api_key_id", key.ID.String()).Msg("failed to record api key usage")
+	}
+	return key, user, nil
+}
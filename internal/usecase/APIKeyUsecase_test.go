@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Second)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name  string
+		key   func(key *entity.APIKey, users *fakeUserRepo)
+		raw   func(raw string) string
+		valid bool
+	}{
+		{"valid", func(*entity.APIKey, *fakeUserRepo) {}, nil, true},
+		{"not yet expired", func(key *entity.APIKey, _ *fakeUserRepo) { key.ExpiresAt = &future }, nil, true},
+		{"expired", func(key *entity.APIKey, _ *fakeUserRepo) { key.ExpiresAt = &past }, nil, false},
+		{"revoked", func(key *entity.APIKey, _ *fakeUserRepo) { key.RevokedAt = &past }, nil, false},
+		{"owner deleted", func(key *entity.APIKey, users *fakeUserRepo) { users.Delete(key.UserID) }, nil, false},
+		{"unknown key", func(*entity.APIKey, *fakeUserRepo) {}, func(raw string) string { return raw + "x" }, false},
+		{"without prefix", func(*entity.APIKey, *fakeUserRepo) {}, func(raw string) string { return raw[len(apiKeyPrefix):] }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &entity.User{ID: uuid.New(), Username: "ann"}
+			users := newFakeUserRepo(user)
+			keys := &fakeAPIKeyRepo{}
+			uc := NewAPIKeyUsecase(keys, users)
+			created, err := uc.CreateKey(user.ID, APIKeyRequest{Name: "ci", Scopes: []string{entity.ScopeReportsRead}})
+			if err != nil {
+				t.Fatalf("CreateKey: %v", err)
+			}
+			tt.key(keys.keys[0], users)
+			raw := created.Key
+			if tt.raw != nil {
+				raw = tt.raw(raw)
+			}
+
+			key, owner, err := uc.Authenticate(raw)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidAPIKey) {
+					t.Errorf("Authenticate error = %v, want ErrInvalidAPIKey", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if owner.ID != user.ID || len(key.Scopes) != 1 || key.Scopes[0] != entity.ScopeReportsRead {
+				t.Errorf("Authenticate = key scopes %v, owner %s", key.Scopes, owner.ID)
+			}
+		})
+	}
+}
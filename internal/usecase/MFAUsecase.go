@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MFAUsecase interface {
+	BeginTOTPEnrollment(userID uuid.UUID) (*TOTPSetup, error)
+	ConfirmTOTP(userID uuid.UUID, code string) ([]string, error)
+	DisableTOTP(userID uuid.UUID, code string) error
+	RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error)
+	IsEnabled(userID uuid.UUID) (bool, error)
+	Verify(userID uuid.UUID, code string) error
+}
+
+type TOTPSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid authentication code")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFAEnrollmentAbsent = errors.New("start two-factor enrollment first")
+)
+
+const (
+	recoveryCodeCount = 10
+	// no 0/O or 1/l, codes get read off paper
+	recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+type mfaUsecase struct {
+	mfaRepo  entity.MFARepository
+	userRepo entity.UserRepository
+	issuer   string
+}
+
+func NewMFAUsecase(mfaRepo entity.MFARepository, userRepo entity.UserRepository, issuer string) *mfaUsecase {
+	return &mfaUsecase{
+		mfaRepo:  mfaRepo,
+		userRepo: userRepo,
+		issuer:   issuer,
+	}
+}
+
+// BeginTOTPEnrollment creates a pending secret. It only becomes active once a
+// code generated from it is confirmed.
+func (m *mfaUsecase) BeginTOTPEnrollment(userID uuid.UUID) (*TOTPSetup, error) {
+	user, err := m.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := service.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.mfaRepo.SaveTOTP(&entity.TOTPEnrollment{UserID: userID, Secret: secret, CreatedAt: time.Now()})
+	if errors.Is(err, entity.ErrConflict) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret:          secret,
+		ProvisioningURI: service.TOTPProvisioningURI(m.issuer, user.Username, secret),
+	}, nil
+}
+
+func (m *mfaUsecase) ConfirmTOTP(userID uuid.UUID, code string) ([]string, error) {
+	enrollment, err := m.mfaRepo.GetTOTP(userID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, ErrMFAEnrollmentAbsent
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := m.verifyTOTP(enrollment, code); err != nil {
+		return nil, err
+	}
+
+	if err := m.mfaRepo.EnableTOTP(userID); err != nil {
+		return nil, err
+	}
+	return m.newRecoveryCodes(userID)
+}
+
+func (m *mfaUsecase) DisableTOTP(userID uuid.UUID, code string) error {
+	if err := m.Verify(userID, code); err != nil {
+		return err
+	}
+	return m.mfaRepo.DeleteTOTP(userID)
+}
+
+func (m *mfaUsecase) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	if err := m.Verify(userID, code); err != nil {
+		return nil, err
+	}
+	return m.newRecoveryCodes(userID)
+}
+
+func (m *mfaUsecase) IsEnabled(userID uuid.UUID) (bool, error) {
+	enrollment, err := m.mfaRepo.GetTOTP(userID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enrollment.Enabled, nil
+}
+
+// Verify accepts a current TOTP code or one of the unused recovery codes.
+func (m *mfaUsecase) Verify(userID uuid.UUID, code string) error {
+	enrollment, err := m.mfaRepo.GetTOTP(userID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if !enrollment.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if strings.Contains(code, "-") {
+		used, err := m.mfaRepo.UseRecoveryCode(userID, service.HashToken(strings.ToLower(code)))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	return m.verifyTOTP(enrollment, code)
+}
+
+func (m *mfaUsecase) verifyTOTP(enrollment *entity.TOTPEnrollment, code string) error {
+	step, ok := service.ValidateTOTP(enrollment.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	// a code seen once (e.g. shoulder-surfed) must not work a second time
+	fresh, err := m.mfaRepo.UseTOTPStep(enrollment.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (m *mfaUsecase) newRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, service.HashToken(code))
+	}
+
+	if err := m.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns codes like "k3x9p-7mq2a"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	for i := range b {
+		b[i] = recoveryCodeAlphabet[int(b[i])%len(recoveryCodeAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
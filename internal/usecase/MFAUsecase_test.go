@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// totpAt is what an authenticator app shows at the given time (RFC 6238,
+// HMAC-SHA1, 6 digits, 30 second steps).
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("bad TOTP secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestVerifyRejectsReusedTOTPStep(t *testing.T) {
+	userID := uuid.New()
+	// RFC 6238 test secret "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if code := totpAt(t, secret, time.Unix(59, 0)); code != "287082" {
+		t.Fatalf("totpAt does not match the RFC 6238 test vector: %s", code)
+	}
+	uc := NewMFAUsecase(newFakeMFARepo(&entity.TOTPEnrollment{UserID: userID, Secret: secret, Enabled: true}), nil, "freeze")
+
+	now := time.Now()
+	code := totpAt(t, secret, now)
+	if err := uc.Verify(userID, code); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := uc.Verify(userID, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("same code again = %v, want ErrInvalidMFACode", err)
+	}
+	// the previous step is still within the drift window, but older than the accepted one
+	if err := uc.Verify(userID, totpAt(t, secret, now.Add(-30*time.Second))); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("code of an earlier step = %v, want ErrInvalidMFACode", err)
+	}
+	if err := uc.Verify(userID, totpAt(t, secret, now.Add(30*time.Second))); err != nil {
+		t.Errorf("code of the next step = %v, want nil", err)
+	}
+}
@@ -0,0 +1,762 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthServerUsecase makes this service an OAuth 2.0 / OpenID Connect provider
+// for our other apps.
+type OAuthServerUsecase interface {
+	Discovery() *DiscoveryDocument
+	RegisterClient(registration ClientRegistration) (*entity.OAuthClient, string, error)
+	ListClients() ([]*entity.OAuthClient, error)
+	DeleteClient(clientID string) error
+	Authorize(req *AuthorizationRequest, session *AuthorizationSession) (*AuthorizationDecision, error)
+	ConsentDetails(consentToken string, userID uuid.UUID) (*ConsentPrompt, error)
+	Consent(consentToken string, userID uuid.UUID, approved bool) (string, error)
+	Token(req *TokenRequest) (*TokenResponse, error)
+	UserInfo(accessToken string) (*UserInfo, error)
+}
+
+// OAuthError is an error response defined by RFC 6749, sent to the client's
+// redirect_uri from /authorize or as JSON from /token.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// errors shown to the user instead of being sent to an unverified redirect_uri
+var (
+	ErrUnknownOAuthClient      = errors.New("unknown client_id")
+	ErrInvalidRedirectURI      = errors.New("redirect_uri is not registered for this client")
+	ErrInvalidConsentRequest   = errors.New("invalid or expired authorization request, start again from the application")
+	ErrInvalidOAuthAccessToken = errors.New("invalid access token")
+)
+
+const oauthConsentPurpose = "oauth-consent"
+
+type DiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type ClientRegistration struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	Trusted      bool     `json:"trusted"`
+}
+
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+// AuthorizationSession is the logged in user at /authorize, nil if nobody is.
+type AuthorizationSession struct {
+	UserID uuid.UUID
+	AMR    []string
+}
+
+// AuthorizationDecision says where to send the browser next: back to the
+// client, to the login page or to the consent screen.
+type AuthorizationDecision struct {
+	RedirectURL   string
+	LoginRequired bool
+	ConsentToken  string
+}
+
+type ConsentPrompt struct {
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+}
+
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type UserInfo struct {
+	Subject string `json:"sub"`
+	service.ProfileClaims
+}
+
+var (
+	supportedScopes     = []string{service.ScopeOpenID, service.ScopeProfile, service.ScopeEmail, service.ScopeOfflineAccess}
+	supportedGrantTypes = []string{entity.GrantAuthorizationCode, entity.GrantRefreshToken, entity.GrantClientCredentials}
+)
+
+type oauthServerUsecase struct {
+	clientRepo       entity.OAuthClientRepository
+	codeRepo         entity.AuthorizationCodeRepository
+	consentRepo      entity.OAuthConsentRepository
+	refreshTokenRepo entity.RefreshTokenRepository
+	userRepo         entity.UserRepository
+	denylist         entity.TokenDenylist
+	jwtService       service.JWTService
+	issuer           string
+	codeTTL          time.Duration
+	consentTTL       time.Duration
+	refreshTokenTTL  time.Duration
+}
+
+func NewOAuthServerUsecase(
+	clientRepo entity.OAuthClientRepository,
+	codeRepo entity.AuthorizationCodeRepository,
+	consentRepo entity.OAuthConsentRepository,
+	refreshTokenRepo entity.RefreshTokenRepository,
+	userRepo entity.UserRepository,
+	denylist entity.TokenDenylist,
+	jwtService service.JWTService,
+	issuer string,
+	codeTTL time.Duration,
+	consentTTL time.Duration,
+	refreshTokenTTL time.Duration,
+) *oauthServerUsecase {
+	return &oauthServerUsecase{
+		clientRepo:       clientRepo,
+		codeRepo:         codeRepo,
+		consentRepo:      consentRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		userRepo:         userRepo,
+		denylist:         denylist,
+		jwtService:       jwtService,
+		issuer:           strings.TrimRight(issuer, "/"),
+		codeTTL:          codeTTL,
+		consentTTL:       consentTTL,
+		refreshTokenTTL:  refreshTokenTTL,
+	}
+}
+
+func (o *oauthServerUsecase) Discovery() *DiscoveryDocument {
+	return &DiscoveryDocument{
+		Issuer:                            o.issuer,
+		AuthorizationEndpoint:             o.issuer + "/authorize",
+		TokenEndpoint:                     o.issuer + "/token",
+		UserinfoEndpoint:                  o.issuer + "/userinfo",
+		JWKSURI:                           o.issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               supportedGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{o.jwtService.SigningAlgorithm()},
+		ScopesSupported:                   supportedScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "preferred_username", "email", "email_verified", "amr", "nonce"},
+	}
+}
+
+// RegisterClient returns the client secret in plain text; only its hash is
+// stored, so this is the only time it can be shown.
+func (o *oauthServerUsecase) RegisterClient(registration ClientRegistration) (*entity.OAuthClient, string, error) {
+	name := strings.TrimSpace(registration.Name)
+	if name == "" {
+		return nil, "", &ValidationError{Field: "name", Message: "is required"}
+	}
+
+	grantTypes := registration.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{entity.GrantAuthorizationCode, entity.GrantRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		if !slices.Contains(supportedGrantTypes, grantType) {
+			return nil, "", &ValidationError{Field: "grant_types", Message: fmt.Sprintf("unsupported grant type %q", grantType)}
+		}
+	}
+	if registration.Public && slices.Contains(grantTypes, entity.GrantClientCredentials) {
+		return nil, "", &ValidationError{Field: "grant_types", Message: "public clients cannot use client_credentials"}
+	}
+
+	if slices.Contains(grantTypes, entity.GrantAuthorizationCode) && len(registration.RedirectURIs) == 0 {
+		return nil, "", &ValidationError{Field: "redirect_uris", Message: "at least one is required for authorization_code"}
+	}
+	for _, redirectURI := range registration.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return nil, "", err
+		}
+	}
+
+	scopes := registration.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{service.ScopeOpenID, service.ScopeProfile, service.ScopeEmail}
+		if slices.Contains(grantTypes, entity.GrantRefreshToken) {
+			scopes = append(scopes, service.ScopeOfflineAccess)
+		}
+	}
+
+	client := &entity.OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		RedirectURIs: registration.RedirectURIs,
+		GrantTypes:   grantTypes,
+		Scopes:       scopes,
+		Trusted:      registration.Trusted,
+		CreatedAt:    time.Now(),
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	secret := ""
+	if !registration.Public {
+		var err error
+		secret, err = service.GenerateOpaqueToken()
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = service.HashToken(secret)
+	}
+
+	if err := o.clientRepo.Create(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// validateRedirectURI allows https, and plain http only on loopback for
+// native apps (RFC 8252), so codes never travel in the clear or to a
+// javascript: or data: URL.
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+		return &ValidationError{Field: "redirect_uris", Message: fmt.Sprintf("%q must be an absolute URL without fragment", redirectURI)}
+	}
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if isLoopbackHost(parsed.Hostname()) {
+			return nil
+		}
+		return &ValidationError{Field: "redirect_uris", Message: fmt.Sprintf("%q must use https, http is allowed only on localhost", redirectURI)}
+	default:
+		return &ValidationError{Field: "redirect_uris", Message: fmt.Sprintf("%q must use https", redirectURI)}
+	}
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (o *oauthServerUsecase) ListClients() ([]*entity.OAuthClient, error) {
+	return o.clientRepo.List()
+}
+
+func (o *oauthServerUsecase) DeleteClient(clientID string) error {
+	return o.clientRepo.Delete(clientID)
+}
+
+// Authorize validates an authorization request. Until client and redirect_uri
+// are known to be good, errors are returned to be shown to the user; after
+// that they are sent back to the client in the decision.
+func (o *oauthServerUsecase) Authorize(req *AuthorizationRequest, session *AuthorizationSession) (*AuthorizationDecision, error) {
+	client, redirectURI, err := o.resolveClient(req.ClientID, req.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, oauthErr := o.validateAuthorizationRequest(client, req)
+	if oauthErr != nil {
+		return &AuthorizationDecision{RedirectURL: errorRedirect(redirectURI, req.State, oauthErr)}, nil
+	}
+
+	if session == nil {
+		if req.Prompt == "none" {
+			return &AuthorizationDecision{RedirectURL: errorRedirect(redirectURI, req.State, oauthError("login_required", "the user is not logged in"))}, nil
+		}
+		return &AuthorizationDecision{LoginRequired: true}, nil
+	}
+
+	consented, err := o.hasConsent(client, session.UserID, scopes)
+	if err != nil {
+		return nil, err
+	}
+	if consented && req.Prompt != "consent" {
+		redirectURL, err := o.issueCode(client, redirectURI, req, scopes, session)
+		if err != nil {
+			return nil, err
+		}
+		return &AuthorizationDecision{RedirectURL: redirectURL}, nil
+	}
+	if req.Prompt == "none" {
+		return &AuthorizationDecision{RedirectURL: errorRedirect(redirectURI, req.State, oauthError("consent_required", "the user has not approved this application"))}, nil
+	}
+
+	// the consent screen posts this back, nothing has to be kept server-side
+	consentToken, err := o.jwtService.CreatePurposeToken(oauthConsentPurpose, session.UserID.String(), map[string]string{
+		"client_id":    client.ID,
+		"redirect_uri": redirectURI,
+		// empty when the client left redirect_uri out of the request
+		"requested_redirect_uri": req.RedirectURI,
+		"scope":                  strings.Join(scopes, " "),
+		"state":                  req.State,
+		"nonce":                  req.Nonce,
+		"code_challenge":         req.CodeChallenge,
+		"amr":                    strings.Join(session.AMR, " "),
+	}, o.consentTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consent request: %w", err)
+	}
+	return &AuthorizationDecision{ConsentToken: consentToken}, nil
+}
+
+func (o *oauthServerUsecase) ConsentDetails(consentToken string, userID uuid.UUID) (*ConsentPrompt, error) {
+	data, err := o.openConsent(consentToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := o.clientRepo.GetByID(data["client_id"])
+	if err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			return nil, ErrInvalidConsentRequest
+		}
+		return nil, err
+	}
+	return &ConsentPrompt{ClientName: client.Name, Scopes: strings.Fields(data["scope"])}, nil
+}
+
+// Consent records the user's answer and returns where to send the browser.
+func (o *oauthServerUsecase) Consent(consentToken string, userID uuid.UUID, approved bool) (string, error) {
+	data, err := o.openConsent(consentToken, userID)
+	if err != nil {
+		return "", err
+	}
+	client, redirectURI, err := o.resolveClient(data["client_id"], data["redirect_uri"])
+	if err != nil {
+		return "", ErrInvalidConsentRequest
+	}
+
+	if !approved {
+		return errorRedirect(redirectURI, data["state"], oauthError("access_denied", "the user denied the request")), nil
+	}
+
+	scopes := strings.Fields(data["scope"])
+	if err := o.consentRepo.Grant(userID, client.ID, scopes); err != nil {
+		return "", err
+	}
+
+	req := &AuthorizationRequest{
+		RedirectURI:   data["requested_redirect_uri"],
+		State:         data["state"],
+		Nonce:         data["nonce"],
+		CodeChallenge: data["code_challenge"],
+	}
+	session := &AuthorizationSession{UserID: userID, AMR: strings.Fields(data["amr"])}
+	return o.issueCode(client, redirectURI, req, scopes, session)
+}
+
+func (o *oauthServerUsecase) Token(req *TokenRequest) (*TokenResponse, error) {
+	client, err := o.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(client.GrantTypes, req.GrantType) {
+		if !slices.Contains(supportedGrantTypes, req.GrantType) {
+			return nil, oauthError("unsupported_grant_type", "")
+		}
+		return nil, oauthError("unauthorized_client", "the client may not use this grant type")
+	}
+
+	switch req.GrantType {
+	case entity.GrantAuthorizationCode:
+		return o.exchangeCode(client, req)
+	case entity.GrantRefreshToken:
+		return o.refresh(client, req)
+	default:
+		return o.clientCredentials(client, req)
+	}
+}
+
+func (o *oauthServerUsecase) UserInfo(accessToken string) (*UserInfo, error) {
+	claims, err := o.jwtService.ValidateClientAccessToken(accessToken)
+	if err != nil || !slices.Contains(strings.Fields(claims.Scope), service.ScopeOpenID) {
+		return nil, ErrInvalidOAuthAccessToken
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, ErrInvalidOAuthAccessToken
+	}
+
+	revoked, err := o.denylist.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		revoked, err = o.denylist.IsSubjectRevoked(claims.Subject, claims.IssuedAt.Time)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if revoked {
+		return nil, ErrInvalidOAuthAccessToken
+	}
+
+	user, err := o.userRepo.GetByID(userID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, ErrInvalidOAuthAccessToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &UserInfo{Subject: user.ID.String(), ProfileClaims: service.NewProfileClaims(user, strings.Fields(claims.Scope))}, nil
+}
+
+func (o *oauthServerUsecase) resolveClient(clientID, redirectURI string) (*entity.OAuthClient, string, error) {
+	client, err := o.clientRepo.GetByID(clientID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, "", ErrUnknownOAuthClient
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// redirect URIs are compared exactly, prefixes would allow open redirects
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	return client, redirectURI, nil
+}
+
+func (o *oauthServerUsecase) validateAuthorizationRequest(client *entity.OAuthClient, req *AuthorizationRequest) ([]string, *OAuthError) {
+	if req.ResponseType != "code" {
+		return nil, oauthError("unsupported_response_type", "only response_type=code is supported")
+	}
+	if !slices.Contains(client.GrantTypes, entity.GrantAuthorizationCode) {
+		return nil, oauthError("unauthorized_client", "the client may not use the authorization code flow")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		return nil, oauthError("invalid_scope", "scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, oauthError("invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+
+	if req.CodeChallenge == "" {
+		if client.Public() {
+			return nil, oauthError("invalid_request", "public clients must use PKCE")
+		}
+	} else if req.CodeChallengeMethod != "S256" {
+		return nil, oauthError("invalid_request", "code_challenge_method must be S256")
+	}
+	return scopes, nil
+}
+
+func (o *oauthServerUsecase) hasConsent(client *entity.OAuthClient, userID uuid.UUID, scopes []string) (bool, error) {
+	if client.Trusted {
+		return true, nil
+	}
+	consent, err := o.consentRepo.Get(userID, client.ID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (o *oauthServerUsecase) openConsent(consentToken string, userID uuid.UUID) (map[string]string, error) {
+	claims, err := o.jwtService.ValidatePurposeToken(oauthConsentPurpose, consentToken)
+	if err != nil || claims.Subject != userID.String() {
+		return nil, ErrInvalidConsentRequest
+	}
+	return claims.Data, nil
+}
+
+func (o *oauthServerUsecase) issueCode(client *entity.OAuthClient, redirectURI string, req *AuthorizationRequest, scopes []string, session *AuthorizationSession) (string, error) {
+	code, err := service.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = o.codeRepo.Create(&entity.AuthorizationCode{
+		CodeHash:            service.HashToken(code),
+		ClientID:            client.ID,
+		UserID:              session.UserID,
+		FamilyID:            uuid.New(),
+		RedirectURI:         redirectURI,
+		RedirectURIExplicit: req.RedirectURI != "",
+		Scopes:              scopes,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		AMR:                 session.AMR,
+		CreatedAt:           now,
+		ExpiresAt:           now.Add(o.codeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return appendQuery(redirectURI, params), nil
+}
+
+func (o *oauthServerUsecase) authenticateClient(clientID, clientSecret string) (*entity.OAuthClient, error) {
+	client, err := o.clientRepo.GetByID(clientID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public() {
+		if clientSecret != "" {
+			return nil, oauthError("invalid_client", "public clients have no secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(service.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+func (o *oauthServerUsecase) exchangeCode(client *entity.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	// a code issued to another client is neither burned nor revoked
+	code, fresh, err := o.codeRepo.Consume(service.HashToken(req.Code), client.ID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, oauthError("invalid_grant", "invalid authorization code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		// RFC 6749 4.1.2: revoke what was issued for a code that is replayed
+		if err := o.refreshTokenRepo.RevokeFamily(code.FamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		return nil, oauthError("invalid_grant", "authorization code was already used")
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return nil, oauthError("invalid_grant", "authorization code expired")
+	}
+	// RFC 6749 4.1.3: required and identical if it was sent to /authorize
+	if (code.RedirectURIExplicit || req.RedirectURI != "") && req.RedirectURI != code.RedirectURI {
+		return nil, oauthError("invalid_grant", "redirect_uri does not match")
+	}
+	if code.CodeChallenge != "" && !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError("invalid_grant", "code_verifier does not match")
+	}
+
+	user, err := o.userRepo.GetByID(code.UserID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, oauthError("invalid_grant", "the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o.issueTokens(client, user, code.FamilyID, code.Scopes, code.AMR, code.Nonce)
+}
+
+func (o *oauthServerUsecase) refresh(client *entity.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	stored, err := spendRefreshToken(o.refreshTokenRepo, req.RefreshToken, client.ID)
+	if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+		return nil, oauthError("invalid_grant", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// a client may ask for less than it was granted, never for more
+	scopes := stored.Scopes
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(stored.Scopes, scope) {
+				return nil, oauthError("invalid_scope", fmt.Sprintf("scope %q was not granted", scope))
+			}
+		}
+		scopes = requested
+	}
+
+	user, err := o.userRepo.GetByID(stored.UserID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, oauthError("invalid_grant", "the user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o.issueTokens(client, user, stored.FamilyID, scopes, stored.AMR, "")
+}
+
+// clientCredentials issues a token for the client itself, for service to
+// service calls; there is no user, so no ID token and no refresh token.
+func (o *oauthServerUsecase) clientCredentials(client *entity.OAuthClient, req *TokenRequest) (*TokenResponse, error) {
+	if client.Public() {
+		return nil, oauthError("unauthorized_client", "public clients cannot use client_credentials")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	for _, scope := range scopes {
+		if slices.Contains(supportedScopes, scope) {
+			return nil, oauthError("invalid_scope", fmt.Sprintf("scope %q needs a user", scope))
+		}
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, oauthError("invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+
+	accessToken, expiresAt, err := o.jwtService.CreateClientAccessToken(nil, client.ID, scopes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expiresAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+func (o *oauthServerUsecase) issueTokens(client *entity.OAuthClient, user *entity.User, familyID uuid.UUID, scopes, amr []string, nonce string) (*TokenResponse, error) {
+	accessToken, expiresAt, err := o.jwtService.CreateClientAccessToken(user, client.ID, scopes, amr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+	resp := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expiresAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+
+	if slices.Contains(scopes, service.ScopeOpenID) {
+		resp.IDToken, err = o.jwtService.CreateIDToken(user, client.ID, nonce, scopes, amr, accessToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ID token: %w", err)
+		}
+	}
+
+	if slices.Contains(scopes, service.ScopeOfflineAccess) && slices.Contains(client.GrantTypes, entity.GrantRefreshToken) {
+		refreshToken, err := service.GenerateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		err = o.refreshTokenRepo.Create(&entity.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FamilyID:  familyID,
+			TokenHash: service.HashToken(refreshToken),
+			AMR:       amr,
+			ClientID:  client.ID,
+			Scopes:    scopes,
+			CreatedAt: now,
+			ExpiresAt: now.Add(o.refreshTokenTTL),
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.RefreshToken = refreshToken
+	}
+	return resp, nil
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+func errorRedirect(redirectURI, state string, oauthErr *OAuthError) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return appendQuery(redirectURI, params)
+}
+
+// appendQuery keeps any query the registered redirect URI already has.
+func appendQuery(rawURL string, params url.Values) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
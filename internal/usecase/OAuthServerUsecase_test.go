@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/repository/memory"
+	"auth/internal/service"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRegisterClientRedirectURIs(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://upload.example.com/callback", true},
+		{"http://localhost:8085/callback", true},
+		{"http://127.0.0.1:8085/callback", true},
+		{"http://[::1]:8085/callback", true},
+
+		{"http://upload.example.com/callback", false},
+		{"http://192.168.209.1:8085/callback", false},
+		{"javascript:alert(document.cookie)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"com.example.app:/callback", false},
+		{"https://upload.example.com/callback#token", false},
+		{"/callback", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			clients := newFakeOAuthClientRepo()
+			uc := NewOAuthServerUsecase(clients, nil, nil, nil, nil, nil, nil,
+				"https://auth.example.com", time.Minute, time.Minute, time.Hour)
+			_, _, err := uc.RegisterClient(ClientRegistration{Name: "Upload", RedirectURIs: []string{tt.uri}})
+			if tt.valid {
+				if err != nil {
+					t.Errorf("RegisterClient: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != "redirect_uris" {
+				t.Errorf("RegisterClient error = %v, want a redirect_uris ValidationError", err)
+			}
+			if len(clients.clients) != 0 {
+				t.Error("client with an unsafe redirect URI was stored")
+			}
+		})
+	}
+}
+
+func TestExchangeCodeChecksPKCEAndRedirectURI(t *testing.T) {
+	user := &entity.User{ID: uuid.New(), Username: "ann", Email: "ann@example.com"}
+	client := &entity.OAuthClient{
+		ID:           "reports-app",
+		RedirectURIs: []string{"https://reports.example.com/callback", "https://reports.example.com/other"},
+		GrantTypes:   []string{entity.GrantAuthorizationCode},
+	}
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name         string
+		redirectURI  string
+		codeVerifier string
+		valid        bool
+	}{
+		{"matching", "https://reports.example.com/callback", verifier, true},
+		{"wrong verifier", "https://reports.example.com/callback", verifier + "x", false},
+		{"missing verifier", "https://reports.example.com/callback", "", false},
+		{"challenge as verifier", "https://reports.example.com/callback", challenge, false},
+		{"other registered redirect_uri", "https://reports.example.com/other", verifier, false},
+		{"missing redirect_uri", "", verifier, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codes := newFakeAuthorizationCodeRepo()
+			uc := NewOAuthServerUsecase(newFakeOAuthClientRepo(client), codes, nil, &fakeRefreshTokenRepo{},
+				newFakeUserRepo(user), memory.NewDenylist(), newTestJWTService(),
+				"https://auth.example.com", time.Minute, time.Minute, time.Hour)
+			codes.Create(&entity.AuthorizationCode{
+				CodeHash:            service.HashToken("the-code"),
+				ClientID:            client.ID,
+				UserID:              user.ID,
+				FamilyID:            uuid.New(),
+				RedirectURI:         "https://reports.example.com/callback",
+				RedirectURIExplicit: true,
+				Scopes:              []string{service.ScopeOpenID},
+				CodeChallenge:       challenge,
+				CreatedAt:           time.Now(),
+				ExpiresAt:           time.Now().Add(time.Minute),
+			})
+
+			resp, err := uc.Token(&TokenRequest{
+				GrantType:    entity.GrantAuthorizationCode,
+				ClientID:     client.ID,
+				Code:         "the-code",
+				RedirectURI:  tt.redirectURI,
+				CodeVerifier: tt.codeVerifier,
+			})
+			if tt.valid {
+				if err != nil || resp.AccessToken == "" {
+					t.Fatalf("Token = %v, want tokens", err)
+				}
+				return
+			}
+			var oauthErr *OAuthError
+			if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+				t.Fatalf("Token error = %v, want invalid_grant", err)
+			}
+			// the code is burned, the right verifier cannot be tried afterwards
+			_, err = uc.Token(&TokenRequest{
+				GrantType:    entity.GrantAuthorizationCode,
+				ClientID:     client.ID,
+				Code:         "the-code",
+				RedirectURI:  "https://reports.example.com/callback",
+				CodeVerifier: verifier,
+			})
+			if err == nil {
+				t.Error("code still works after a failed exchange")
+			}
+		})
+	}
+}
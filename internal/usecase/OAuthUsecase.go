@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/pkg/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+type OAuthUsecase interface {
+	Providers() []string
+	StartLogin(provider string) (*OAuthStart, error)
+	Authenticate(provider, stateToken, state, code string) (*entity.User, error)
+	ListIdentities(userID uuid.UUID) ([]*entity.ExternalIdentity, error)
+}
+
+// OAuthStart sends the browser to the provider. StateToken goes into a cookie
+// and comes back with the callback.
+type OAuthStart struct {
+	RedirectURL    string
+	StateToken     string
+	StateExpiresAt time.Time
+}
+
+const oauthStatePurpose = "oauth-state"
+
+var (
+	ErrInvalidOAuthState  = errors.New("invalid or expired login attempt, start again")
+	ErrOAuthFailed        = errors.New("login with the identity provider failed")
+	ErrOAuthEmailRequired = errors.New("the identity provider did not share an email address")
+	// the email belongs to a local account we cannot safely link automatically
+	ErrOAuthAccountExists = errors.New("an account with this email already exists, log in with your password first")
+)
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+type oauthUsecase struct {
+	providers    map[string]*service.OIDCProvider
+	identityRepo entity.IdentityRepository
+	userRepo     entity.UserRepository
+	jwtService   service.JWTService
+	verifier     verificationSender
+	stateTTL     time.Duration
+}
+
+func NewOAuthUsecase(
+	providers map[string]*service.OIDCProvider,
+	identityRepo entity.IdentityRepository,
+	userRepo entity.UserRepository,
+	jwtService service.JWTService,
+	verifier verificationSender,
+	stateTTL time.Duration,
+) *oauthUsecase {
+	return &oauthUsecase{
+		providers:    providers,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		jwtService:   jwtService,
+		verifier:     verifier,
+		stateTTL:     stateTTL,
+	}
+}
+
+func (o *oauthUsecase) Providers() []string {
+	names := make([]string, 0, len(o.providers))
+	for name := range o.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (o *oauthUsecase) StartLogin(provider string) (*OAuthStart, error) {
+	client, ok := o.providers[provider]
+	if !ok {
+		return nil, service.ErrUnknownOIDCProvider
+	}
+
+	state, err := service.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := service.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	redirectURL, err := client.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	stateToken, err := o.jwtService.CreatePurposeToken(oauthStatePurpose, provider, map[string]string{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+	}, o.stateTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create oauth state: %w", err)
+	}
+	return &OAuthStart{RedirectURL: redirectURL, StateToken: stateToken, StateExpiresAt: time.Now().Add(o.stateTTL)}, nil
+}
+
+// Authenticate finishes the authorization code flow and returns the local
+// user, linking or creating it on the first login with this identity.
+func (o *oauthUsecase) Authenticate(provider, stateToken, state, code string) (*entity.User, error) {
+	client, ok := o.providers[provider]
+	if !ok {
+		return nil, service.ErrUnknownOIDCProvider
+	}
+
+	claims, err := o.jwtService.ValidatePurposeToken(oauthStatePurpose, stateToken)
+	if err != nil || claims.Subject != provider || state == "" || claims.Data["state"] != state {
+		return nil, ErrInvalidOAuthState
+	}
+
+	identity, err := client.Exchange(code, claims.Data["verifier"], claims.Data["nonce"])
+	if err != nil {
+		logger.Logger.Warn().Err(err).Str("provider", provider).Msg("oidc login failed")
+		return nil, ErrOAuthFailed
+	}
+
+	linked, err := o.identityRepo.GetByProviderSubject(provider, identity.Subject)
+	if err == nil {
+		return o.userRepo.GetByID(linked.UserID)
+	}
+	if !errors.Is(err, entity.ErrNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, ErrOAuthEmailRequired
+	}
+
+	user, err := o.userRepo.GetByEmail(identity.Email)
+	switch {
+	case errors.Is(err, entity.ErrNotFound):
+		user, err = o.provisionUser(identity)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	// both sides must have proven the address, otherwise whoever registered it
+	// first could take over the other account
+	case !identity.EmailVerified || !user.EmailVerified:
+		return nil, ErrOAuthAccountExists
+	}
+
+	err = o.identityRepo.Create(&entity.ExternalIdentity{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Provider:  provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil && !errors.Is(err, entity.ErrConflict) {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (o *oauthUsecase) ListIdentities(userID uuid.UUID) ([]*entity.ExternalIdentity, error) {
+	return o.identityRepo.ListByUser(userID)
+}
+
+// provisionUser creates an account without a password; the user can set one
+// later through the password reset flow.
+func (o *oauthUsecase) provisionUser(identity *service.OIDCIdentity) (*entity.User, error) {
+	if err := validateEmail(identity.Email); err != nil {
+		return nil, ErrOAuthEmailRequired
+	}
+
+	username, err := o.availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &entity.User{
+		ID:            uuid.New(),
+		Username:      username,
+		Email:         identity.Email,
+		Roles:         []string{entity.RoleUser},
+		EmailVerified: identity.EmailVerified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := o.userRepo.Create(user); err != nil {
+		// registered with the same address in the meantime
+		if errors.Is(err, entity.ErrEmailTaken) {
+			return nil, ErrOAuthAccountExists
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if !user.EmailVerified {
+		if err := o.verifier.SendVerification(user); err != nil {
+			logger.Logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to send verification email")
+		}
+	}
+	return user, nil
+}
+
+// availableUsername derives a username from the provider profile and adds a
+// random suffix when it is taken.
+func (o *oauthUsecase) availableUsername(identity *service.OIDCIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameUnsafeChars.ReplaceAllString(base, "")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		exists, err := o.userRepo.Exists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", fmt.Errorf("failed to generate username: %w", err)
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", fmt.Errorf("failed to find a free username for %q", base)
+}
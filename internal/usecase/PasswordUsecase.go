@@ -0,0 +1,209 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/pkg/logger"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordUsecase interface {
+	ChangePassword(userID uuid.UUID, currentPassword, newPassword string) error
+	RequestPasswordReset(email, ip string) error
+	ResetPassword(token, newPassword string) error
+}
+
+var (
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrInvalidResetToken    = errors.New("invalid or expired password reset token")
+	ErrTooManyResetRequests = errors.New("too many password reset requests, try again later")
+)
+
+// reset requests are counted in the login attempt store under their own prefix
+const passwordResetIPKeyPrefix = "reset-ip:"
+
+type sessionRevoker interface {
+	RevokeAllSessions(userID uuid.UUID) error
+}
+
+type passwordUsecase struct {
+	userRepo  entity.UserRepository
+	resetRepo entity.PasswordResetRepository
+	sessions  sessionRevoker
+	mailer    service.Mailer
+	attempts  entity.LoginAttemptRepository
+	resetTTL  time.Duration
+	publicURL string
+
+	resendInterval time.Duration
+	maxPerIP       int
+	ipWindow       time.Duration
+	// runs the account lookup and the mail; asynchronous outside of tests
+	background func(func())
+}
+
+func NewPasswordUsecase(
+	userRepo entity.UserRepository,
+	resetRepo entity.PasswordResetRepository,
+	sessions sessionRevoker,
+	mailer service.Mailer,
+	attempts entity.LoginAttemptRepository,
+	resetTTL time.Duration,
+	resendInterval time.Duration,
+	maxPerIP int,
+	ipWindow time.Duration,
+	publicURL string,
+) *passwordUsecase {
+	return &passwordUsecase{
+		userRepo:       userRepo,
+		resetRepo:      resetRepo,
+		sessions:       sessions,
+		mailer:         mailer,
+		attempts:       attempts,
+		resetTTL:       resetTTL,
+		publicURL:      publicURL,
+		resendInterval: resendInterval,
+		maxPerIP:       maxPerIP,
+		ipWindow:       ipWindow,
+		background:     func(f func()) { go f() },
+	}
+}
+
+// ChangePassword logs the user out everywhere, including the current device.
+func (p *passwordUsecase) ChangePassword(userID uuid.UUID, currentPassword, newPassword string) error {
+	user, err := p.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	return p.setPassword(userID, newPassword)
+}
+
+// RequestPasswordReset never tells the caller whether the email is known:
+// the lookup and the mail run in the background, so known and unknown
+// addresses answer alike and equally fast. Only the per-IP limit is checked
+// before answering, it does not depend on the address.
+func (p *passwordUsecase) RequestPasswordReset(email, ip string) error {
+	requests, err := p.attempts.RecordFailure(passwordResetIPKeyPrefix+ip, p.ipWindow)
+	if err != nil {
+		return err
+	}
+	if requests > p.maxPerIP {
+		return ErrTooManyResetRequests
+	}
+
+	p.background(func() {
+		if err := p.sendPasswordReset(email); err != nil {
+			logger.Logger.Error().Err(err).Msg("failed to send password reset")
+		}
+	})
+	return nil
+}
+
+// sendPasswordReset mails a reset link at most once per resend interval, so
+// the endpoint cannot be used to flood somebody's inbox.
+func (p *passwordUsecase) sendPasswordReset(email string) error {
+	user, err := p.userRepo.GetByEmail(email)
+	if errors.Is(err, entity.ErrNotFound) {
+		logger.Logger.Info().Msg("password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sent, err := p.userRepo.TouchPasswordResetSent(user.ID, time.Now().Add(-p.resendInterval))
+	if err != nil {
+		return err
+	}
+	if !sent {
+		logger.Logger.Info().Msg("password reset mail throttled")
+		return nil
+	}
+
+	if err := p.resetRepo.InvalidateForUser(user.ID); err != nil {
+		return err
+	}
+
+	token, err := service.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = p.resetRepo.Create(&entity.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: service.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(p.resetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := p.publicURL + "/reset-password.html?token=" + url.QueryEscape(token)
+	return p.mailer.Send(service.Mail{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nsomebody asked to reset your password. Open the link below to choose a new one:\n\n%s\n\n"+
+				"The link is valid for %s and can be used once. If it was not you, ignore this mail.\n",
+			user.Username, link, p.resetTTL,
+		),
+	})
+}
+
+func (p *passwordUsecase) ResetPassword(token, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	stored, err := p.resetRepo.GetByHash(service.HashToken(token))
+	if errors.Is(err, entity.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	used, err := p.resetRepo.MarkUsed(stored.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	return p.setPassword(stored.UserID, newPassword)
+}
+
+func (p *passwordUsecase) setPassword(userID uuid.UUID, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := p.userRepo.UpdatePassword(userID, string(hash)); err != nil {
+		return err
+	}
+
+	if err := p.sessions.RevokeAllSessions(userID); err != nil {
+		return fmt.Errorf("password changed but failed to revoke sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type noSessions struct{}
+
+func (noSessions) RevokeAllSessions(uuid.UUID) error { return nil }
+
+// newResetTestUsecase runs the background work of RequestPasswordReset
+// before it returns, so tests can look at its effects.
+func newResetTestUsecase(users *fakeUserRepo, mailer *fakeMailer) *passwordUsecase {
+	uc := NewPasswordUsecase(users, &fakePasswordResetRepo{}, noSessions{}, mailer, newFakeLoginAttemptRepo(),
+		30*time.Minute, 2*time.Minute, 3, time.Hour, "https://freeze.test")
+	uc.background = func(f func()) { f() }
+	return uc
+}
+
+func TestRequestPasswordResetAnswersBeforeLookup(t *testing.T) {
+	users := newFakeUserRepo(&entity.User{ID: uuid.New(), Username: "ann", Email: "ann@example.com"})
+	mailer := &fakeMailer{}
+	uc := newResetTestUsecase(users, mailer)
+	var pending []func()
+	uc.background = func(f func()) { pending = append(pending, f) }
+
+	for _, email := range []string{"ann@example.com", "nobody@example.com"} {
+		if err := uc.RequestPasswordReset(email, "192.0.2.1"); err != nil {
+			t.Errorf("RequestPasswordReset(%q) = %v, want nil", email, err)
+		}
+	}
+	if len(mailer.mails()) != 0 {
+		t.Fatal("mail was sent before the request returned")
+	}
+	for _, f := range pending {
+		f()
+	}
+	if mails := mailer.mails(); len(mails) != 1 || mails[0].To != "ann@example.com" {
+		t.Errorf("mails = %v, want one to ann@example.com", mails)
+	}
+}
+
+func TestRequestPasswordResetOncePerInterval(t *testing.T) {
+	users := newFakeUserRepo(&entity.User{ID: uuid.New(), Username: "ann", Email: "ann@example.com"})
+	mailer := &fakeMailer{}
+	uc := newResetTestUsecase(users, mailer)
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if err := uc.RequestPasswordReset("ANN@example.com", ip); err != nil {
+			t.Fatalf("RequestPasswordReset: %v", err)
+		}
+	}
+	if n := len(mailer.mails()); n != 1 {
+		t.Errorf("sent %d mails, want 1 per resend interval", n)
+	}
+}
+
+func TestRequestPasswordResetLimitedPerIP(t *testing.T) {
+	uc := newResetTestUsecase(newFakeUserRepo(), &fakeMailer{})
+
+	for i := range 3 {
+		if err := uc.RequestPasswordReset("nobody@example.com", "192.0.2.1"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if err := uc.RequestPasswordReset("other@example.com", "192.0.2.1"); !errors.Is(err, ErrTooManyResetRequests) {
+		t.Errorf("request over the limit = %v, want ErrTooManyResetRequests", err)
+	}
+	if err := uc.RequestPasswordReset("nobody@example.com", "192.0.2.2"); err != nil {
+		t.Errorf("request from another IP = %v, want nil", err)
+	}
+}
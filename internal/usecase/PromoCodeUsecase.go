@@ -0,0 +1,106 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PromoCodeUsecase interface {
+	CreatePromoCode(actorID uuid.UUID, req PromoCodeRequest) (*entity.PromoCode, error)
+	ListPromoCodes() ([]*entity.PromoCode, error)
+	DeactivatePromoCode(id uuid.UUID) error
+}
+
+type PromoCodeRequest struct {
+	Code           string        `json:"code"`
+	Kind           string        `json:"kind"`
+	Percent        int           `json:"percent"`
+	Amount         *entity.Money `json:"amount"`
+	Categories     []string      `json:"categories"`
+	ValidFrom      *time.Time    `json:"valid_from"`
+	ValidUntil     *time.Time    `json:"valid_until"`
+	MaxRedemptions int           `json:"max_redemptions"`
+	PerUserLimit   int           `json:"per_user_limit"`
+}
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+var ErrPromoCodeTaken = errors.New("promo code already exists")
+
+type promoCodeUsecase struct {
+	promoRepo entity.PromoCodeRepository
+}
+
+func NewPromoCodeUsecase(promoRepo entity.PromoCodeRepository) *promoCodeUsecase {
+	return &promoCodeUsecase{promoRepo: promoRepo}
+}
+
+func (p *promoCodeUsecase) CreatePromoCode(actorID uuid.UUID, req PromoCodeRequest) (*entity.PromoCode, error) {
+	now := time.Now()
+	promo := &entity.PromoCode{
+		ID:             uuid.New(),
+		Code:           strings.ToUpper(strings.TrimSpace(req.Code)),
+		Kind:           req.Kind,
+		Categories:     req.Categories,
+		ValidFrom:      now,
+		ValidUntil:     req.ValidUntil,
+		MaxRedemptions: req.MaxRedemptions,
+		PerUserLimit:   req.PerUserLimit,
+		CreatedBy:      actorID,
+		CreatedAt:      now,
+	}
+	if req.ValidFrom != nil {
+		promo.ValidFrom = *req.ValidFrom
+	}
+
+	if !promoCodePattern.MatchString(promo.Code) {
+		return nil, &ValidationError{Field: "code", Message: "must be 3-32 characters of letters, digits, '_' or '-'"}
+	}
+	switch promo.Kind {
+	case entity.PromoPercent:
+		if req.Percent < 1 || req.Percent > 100 {
+			return nil, &ValidationError{Field: "percent", Message: "must be between 1 and 100"}
+		}
+		promo.Percent = req.Percent
+	case entity.PromoFixed:
+		if req.Amount == nil || req.Amount.Amount <= 0 || !entity.IsValidCurrency(req.Amount.Currency) {
+			return nil, &ValidationError{Field: "amount", Message: "must be a positive amount in a supported currency"}
+		}
+		promo.Amount = req.Amount
+	default:
+		return nil, &ValidationError{Field: "kind", Message: "must be percent or fixed"}
+	}
+	for _, category := range promo.Categories {
+		if !categoryPattern.MatchString(category) {
+			return nil, &ValidationError{Field: "categories", Message: "must be 1-32 characters of lower case letters, digits, '_' or '-'"}
+		}
+	}
+	if promo.ValidUntil != nil && !promo.ValidUntil.After(promo.ValidFrom) {
+		return nil, &ValidationError{Field: "valid_until", Message: "must be after valid_from"}
+	}
+	if promo.MaxRedemptions < 0 || promo.PerUserLimit < 0 {
+		return nil, &ValidationError{Field: "max_redemptions", Message: "limits must not be negative, 0 means unlimited"}
+	}
+
+	if err := p.promoRepo.Create(promo); err != nil {
+		if errors.Is(err, entity.ErrConflict) {
+			return nil, ErrPromoCodeTaken
+		}
+		return nil, err
+	}
+	return promo, nil
+}
+
+func (p *promoCodeUsecase) ListPromoCodes() ([]*entity.PromoCode, error) {
+	return p.promoRepo.List()
+}
+
+// DeactivatePromoCode ends the validity of the code now, past redemptions stay.
+func (p *promoCodeUsecase) DeactivatePromoCode(id uuid.UUID) error {
+	return p.promoRepo.Deactivate(id, time.Now())
+}
@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCreatePromoCode(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	tests := []struct {
+		name      string
+		req       PromoCodeRequest
+		wantField string
+	}{
+		{"percent", PromoCodeRequest{Code: "spring25", Kind: entity.PromoPercent, Percent: 25}, ""},
+		{"fixed", PromoCodeRequest{Code: "MINUS_50", Kind: entity.PromoFixed, Amount: &entity.Money{Amount: 5000, Currency: "RUB"}}, ""},
+		{"limited", PromoCodeRequest{Code: "VIP-1", Kind: entity.PromoPercent, Percent: 100, Categories: []string{"finance"},
+			ValidFrom: &earlier, ValidUntil: &now, MaxRedemptions: 10, PerUserLimit: 1}, ""},
+
+		{"short code", PromoCodeRequest{Code: "AB", Kind: entity.PromoPercent, Percent: 10}, "code"},
+		{"code with spaces", PromoCodeRequest{Code: "SPRING 25", Kind: entity.PromoPercent, Percent: 10}, "code"},
+		{"unknown kind", PromoCodeRequest{Code: "SPRING25", Kind: "bogo"}, "kind"},
+		{"zero percent", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent}, "percent"},
+		{"over 100 percent", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent, Percent: 101}, "percent"},
+		{"fixed without amount", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoFixed}, "amount"},
+		{"fixed negative", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoFixed, Amount: &entity.Money{Amount: -1, Currency: "RUB"}}, "amount"},
+		{"fixed unknown currency", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoFixed, Amount: &entity.Money{Amount: 100, Currency: "XYZ"}}, "amount"},
+		{"bad category", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent, Percent: 10, Categories: []string{"Finance"}}, "categories"},
+		{"ends before start", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent, Percent: 10, ValidFrom: &now, ValidUntil: &earlier}, "valid_until"},
+		{"negative limit", PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent, Percent: 10, PerUserLimit: -1}, "max_redemptions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakePromoRepo()
+			promo, err := NewPromoCodeUsecase(repo).CreatePromoCode(uuid.New(), tt.req)
+			if tt.wantField != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || validationErr.Field != tt.wantField {
+					t.Fatalf("CreatePromoCode error = %v, want a %s ValidationError", err, tt.wantField)
+				}
+				if len(repo.codes) != 0 {
+					t.Error("invalid code was stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreatePromoCode: %v", err)
+			}
+			if stored, err := repo.GetByCode(promo.Code); err != nil || stored.ID != promo.ID {
+				t.Errorf("code %q is not stored under its upper case form", promo.Code)
+			}
+		})
+	}
+}
+
+func TestCreatePromoCodeTaken(t *testing.T) {
+	uc := NewPromoCodeUsecase(newFakePromoRepo())
+	req := PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent, Percent: 25}
+	if _, err := uc.CreatePromoCode(uuid.New(), req); err != nil {
+		t.Fatalf("CreatePromoCode: %v", err)
+	}
+	req.Code = "spring25"
+	if _, err := uc.CreatePromoCode(uuid.New(), req); !errors.Is(err, ErrPromoCodeTaken) {
+		t.Errorf("duplicate code error = %v, want ErrPromoCodeTaken", err)
+	}
+}
+
+func TestDeactivatePromoCode(t *testing.T) {
+	repo := newFakePromoRepo()
+	uc := NewPromoCodeUsecase(repo)
+	promo, err := uc.CreatePromoCode(uuid.New(), PromoCodeRequest{Code: "SPRING25", Kind: entity.PromoPercent, Percent: 25})
+	if err != nil {
+		t.Fatalf("CreatePromoCode: %v", err)
+	}
+	if err := uc.DeactivatePromoCode(promo.ID); err != nil {
+		t.Fatalf("DeactivatePromoCode: %v", err)
+	}
+	stored, _ := repo.GetByCode("SPRING25")
+	if stored.ActiveAt(time.Now()) {
+		t.Error("code is still active after deactivation")
+	}
+	if err := uc.DeactivatePromoCode(uuid.New()); !errors.Is(err, entity.ErrNotFound) {
+		t.Errorf("deactivating unknown code error = %v, want ErrNotFound", err)
+	}
+}
@@ -3,8 +3,12 @@ package usecase
 import (
 	"auth/internal/entity"
 	"auth/internal/service"
+	"auth/pkg/logger"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -17,61 +21,220 @@ type UserRepository interface {
 	GetByUsername(username string) (*entity.User, error)
 	Exists(username string) (bool, error)
 	ListUsers() ([]*entity.User, error)
-	UpdateBalance(userID uuid.UUID, amount float64) error
 }
 
 type ReportUsecase interface {
-	CreateReport(report *entity.Report) error
+	CreateReport(userID uuid.UUID, req NewReport) (*entity.Report, error)
 	GetUserReports(userID uuid.UUID) ([]*entity.Report, error)
-	SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) error
-	GetUserIdAndPriceByReportId(reportID string) (uuid.UUID, float64, error)
-	PurchaseReport(reportID string) error
+	SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) (int64, error)
+	QuoteReport(userID uuid.UUID, reportID string, opts PurchaseOptions) (*Quote, error)
+	PurchaseReport(userID uuid.UUID, reportID string, opts PurchaseOptions) (*entity.ReportPurchase, error)
+	ResumePendingPurchases(startedBefore time.Time) error
+	RefundReport(actorID uuid.UUID, reportID, reason string) (*entity.ReportRefund, error)
+}
+
+// NewReport is what a client may send when creating a report.
+type NewReport struct {
+	ClientGeneratedID string
+	Description       string
+	// optional, promo codes can be limited to categories
+	Category string
+}
+
+// PurchaseOptions are the buyer's choices for a purchase, both optional.
+type PurchaseOptions struct {
+	// wallet to pay from, the report's currency if empty
+	Currency  string
+	PromoCode string
+}
+
+// Quote is what a purchase would cost. Total is charged to the wallet in its
+// currency, converted from the discounted price as Exchange records.
+type Quote struct {
+	Price     entity.Money     `json:"price"`
+	PromoCode string           `json:"promo_code,omitempty"`
+	Discount  *entity.Money    `json:"discount,omitempty"`
+	Total     entity.Money     `json:"total"`
+	Exchange  *entity.Exchange `json:"exchange,omitempty"`
+
+	promoCodeID *uuid.UUID
 }
 
 type UserUsecase interface {
-	RegisterUser(username, email, password string) (string, error)
-	LoginUser(username, password string) (string, error)
+	RegisterUser(username, email, password string, client entity.ClientInfo) (*entity.TokenPair, error)
+	LoginUser(username, password string, client entity.ClientInfo) (*LoginResult, error)
+	CompleteMFALogin(mfaToken, code string, client entity.ClientInfo) (*entity.TokenPair, error)
+	LoginWithPasskey(ceremonyToken string, response []byte, client entity.ClientInfo) (*entity.TokenPair, error)
+	LoginWithOIDC(provider, stateToken, state, code string, client entity.ClientInfo) (*LoginResult, error)
+	UnlockUser(userID uuid.UUID) error
+	RefreshTokens(refreshToken string, client entity.ClientInfo) (*entity.TokenPair, error)
+	Logout(accessToken, refreshToken string) error
+	ListSessions(userID uuid.UUID) ([]*entity.Session, error)
+	TerminateSession(userID, sessionID uuid.UUID) error
+	RevokeAllSessions(userID uuid.UUID) error
 	ListUsers() ([]*entity.User, error)
+	SetUserRoles(userID uuid.UUID, roles []string) error
+	GetUser(userID uuid.UUID) (*entity.User, error)
+	UpdateUser(userID uuid.UUID, update UserUpdate) (*entity.User, error)
+	DeleteUser(userID uuid.UUID) error
+}
+
+// UserUpdate is a partial update, nil fields are left unchanged. UpdatedAt must
+// be the value the caller read, otherwise entity.ErrConflict is returned.
+type UserUpdate struct {
+	Username  *string
+	Email     *string
+	UpdatedAt time.Time
+}
+
+// LoginResult holds either the issued tokens or, when the account has a second
+// factor, the challenge token to present to CompleteMFALogin.
+type LoginResult struct {
+	Tokens   *entity.TokenPair
+	MFAToken string
+}
+
+// LoginLockedError is returned while an account or IP is locked out.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
 }
 
+// compared against when the user does not exist, so unknown usernames take as
+// long as wrong passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+const (
+	mfaChallengePurpose   = "mfa-challenge"
+	mfaChallengeTTL       = 5 * time.Minute
+	maxUserAgentLength    = 512
+	maxRefundReasonLength = 500
+)
+
+var (
+	ErrUserExists          = errors.New("user already exists")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge, log in again")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrReportsClaimed      = errors.New("these reports were already claimed by another account")
+	ErrAlreadyPurchased    = errors.New("report is already purchased")
+	// the wallet was charged but the report could not be marked purchased
+	// yet; it will be, or the charge is refunded, by ResumePendingPurchases
+	ErrPurchasePending  = errors.New("purchase is being processed")
+	ErrAlreadyRefunded  = errors.New("report purchase is already refunded")
+	ErrInvalidPromoCode = errors.New("promo code is invalid or does not apply to this report")
+)
+
 type reportUsecase struct {
 	reportRepo entity.ReportRepository
-	userRepo   entity.UserRepository
+	claimRepo  entity.ReportClaimRepository
+	walletRepo entity.WalletRepository
+	promoRepo  entity.PromoCodeRepository
+	rates      service.RateProvider
+	price      entity.Money
 }
 
-func NewReportUsecase(reportRepo entity.ReportRepository, userRepo entity.UserRepository) *reportUsecase {
+func NewReportUsecase(reportRepo entity.ReportRepository, claimRepo entity.ReportClaimRepository, walletRepo entity.WalletRepository, promoRepo entity.PromoCodeRepository, rates service.RateProvider, price entity.Money) *reportUsecase {
 	return &reportUsecase{
 		reportRepo: reportRepo,
-		userRepo:   userRepo,
+		claimRepo:  claimRepo,
+		walletRepo: walletRepo,
+		promoRepo:  promoRepo,
+		rates:      rates,
+		price:      price,
 	}
 }
 
 type userUsecase struct {
-	userRepo   entity.UserRepository   // постгрес
-	reportRepo entity.ReportRepository // монга
-	jwtService service.JWTService
+	userRepo         entity.UserRepository         // постгрес
+	reportRepo       entity.ReportRepository       // монга
+	refreshTokenRepo entity.RefreshTokenRepository // постгрес
+	sessionRepo      entity.SessionRepository      // постгрес
+	denylist         entity.TokenDenylist
+	jwtService       service.JWTService
+	verifier         verificationSender
+	secondFactor     secondFactor
+	passkeys         passkeyVerifier
+	externalLogin    externalAuthenticator
+	loginLimiter     *service.LoginLimiter
+	refreshTokenTTL  time.Duration
+}
+
+type verificationSender interface {
+	SendVerification(user *entity.User) error
+}
+
+type secondFactor interface {
+	IsEnabled(userID uuid.UUID) (bool, error)
+	Verify(userID uuid.UUID, code string) error
+}
+
+type passkeyVerifier interface {
+	VerifyLogin(ceremonyToken string, response []byte) (*entity.User, error)
+}
+
+type externalAuthenticator interface {
+	Authenticate(provider, stateToken, state, code string) (*entity.User, error)
 }
 
-func NewUserUsecase(userRepo entity.UserRepository, reportRepo entity.ReportRepository, jwtService service.JWTService) *userUsecase {
+func NewUserUsecase(
+	userRepo entity.UserRepository,
+	reportRepo entity.ReportRepository,
+	refreshTokenRepo entity.RefreshTokenRepository,
+	sessionRepo entity.SessionRepository,
+	denylist entity.TokenDenylist,
+	jwtService service.JWTService,
+	verifier verificationSender,
+	secondFactor secondFactor,
+	passkeys passkeyVerifier,
+	externalLogin externalAuthenticator,
+	loginLimiter *service.LoginLimiter,
+	refreshTokenTTL time.Duration,
+) *userUsecase {
 	return &userUsecase{
-		userRepo:   userRepo,
-		reportRepo: reportRepo,
-		jwtService: jwtService,
+		userRepo:         userRepo,
+		reportRepo:       reportRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		sessionRepo:      sessionRepo,
+		denylist:         denylist,
+		jwtService:       jwtService,
+		verifier:         verifier,
+		secondFactor:     secondFactor,
+		passkeys:         passkeys,
+		externalLogin:    externalLogin,
+		loginLimiter:     loginLimiter,
+		refreshTokenTTL:  refreshTokenTTL,
 	}
 }
 
-func (u *userUsecase) RegisterUser(username, email, password string) (string, error) {
+func (u *userUsecase) RegisterUser(username, email, password string, client entity.ClientInfo) (*entity.TokenPair, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+
 	exists, err := u.userRepo.Exists(username)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if exists {
-		return "", fmt.Errorf("user already exists")
+		return nil, ErrUserExists
+	}
+	if err := u.checkEmailAvailable(email, uuid.Nil); err != nil {
+		return nil, err
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	user := &entity.User{
@@ -79,37 +242,340 @@ func (u *userUsecase) RegisterUser(username, email, password string) (string, er
 		Username:     username,
 		Email:        email,
 		PasswordHash: string(hash),
+		Roles:        []string{entity.RoleUser},
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
 	//здесь мы создаем пользователя в бд
 	err = u.userRepo.Create(user)
+	if errors.Is(err, entity.ErrEmailTaken) {
+		return nil, &ValidationError{Field: "email", Message: "is already taken"}
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create user: %v", err)
+		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
+
+	// письмо можно запросить повторно, регистрацию из-за него не валим
+	if err := u.verifier.SendVerification(user); err != nil {
+		logger.Logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to send verification email")
+	}
+
 	//здесь мы должны создать jwt токен для пользователя
 
-	token, err := u.jwtService.CreateJWT(user)
+	return u.openSession(user, []string{entity.AMRPassword}, client)
+}
+
+func (u *userUsecase) LoginUser(username, password string, client entity.ClientInfo) (*LoginResult, error) {
+	retryAfter, err := u.loginLimiter.RetryAfter(username, client.IP)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	user, err := u.userRepo.GetByUsername(username)
+	if err != nil && !errors.Is(err, entity.ErrNotFound) {
+		return nil, err
+	}
+
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.PasswordHash)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(password)); err != nil || user == nil {
+		if err := u.loginLimiter.Fail(username, client.IP); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
 
+	result, err := u.startSession(user, entity.AMRPassword, client)
 	if err != nil {
-		return "", fmt.Errorf("failed to create JWT token: %v", err)
+		return nil, err
 	}
+	// with a second factor the lockout counter is only reset once it passes
+	if result.Tokens != nil {
+		if err := u.loginLimiter.Succeed(username); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
 
-	return token, nil
+// LoginWithOIDC finishes a social login; accounts with TOTP still have to pass
+// the second factor.
+func (u *userUsecase) LoginWithOIDC(provider, stateToken, state, code string, client entity.ClientInfo) (*LoginResult, error) {
+	user, err := u.externalLogin.Authenticate(provider, stateToken, state, code)
+	if err != nil {
+		return nil, err
+	}
+	return u.startSession(user, entity.AMRFederated, client)
 }
 
-func (u *userUsecase) LoginUser(username, password string) (string, error) {
-	user, err := u.userRepo.GetByUsername(username)
+// startSession issues tokens for a user who passed the first factor, or an MFA
+// challenge remembering that factor when the account has TOTP enabled.
+func (u *userUsecase) startSession(user *entity.User, firstFactor string, client entity.ClientInfo) (*LoginResult, error) {
+	mfaEnabled, err := u.secondFactor.IsEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfaEnabled {
+		mfaToken, err := u.jwtService.CreatePurposeToken(mfaChallengePurpose, user.ID.String(),
+			map[string]string{"amr": firstFactor}, mfaChallengeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MFA challenge: %w", err)
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	tokens, err := u.openSession(user, []string{firstFactor}, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// CompleteMFALogin finishes a login started by LoginUser. Wrong codes count as
+// failed logins, so the challenge cannot be used to brute-force the code.
+func (u *userUsecase) CompleteMFALogin(mfaToken, code string, client entity.ClientInfo) (*entity.TokenPair, error) {
+	claims, err := u.jwtService.ValidatePurposeToken(mfaChallengePurpose, mfaToken)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	user, err := u.userRepo.GetByID(userID)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	retryAfter, err := u.loginLimiter.RetryAfter(user.Username, client.IP)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	if err := u.secondFactor.Verify(user.ID, code); err != nil {
+		if !errors.Is(err, ErrInvalidMFACode) {
+			return nil, err
+		}
+		if err := u.loginLimiter.Fail(user.Username, client.IP); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+
+	if err := u.loginLimiter.Succeed(user.Username); err != nil {
+		return nil, err
+	}
+
+	firstFactor := claims.Data["amr"]
+	if firstFactor == "" {
+		firstFactor = entity.AMRPassword
+	}
+	return u.openSession(user, []string{firstFactor, entity.AMROTP, entity.AMRMultiFactor}, client)
+}
+
+// LoginWithPasskey logs in without a password. Passkeys are created with user
+// verification required, so the assertion alone counts as multi-factor.
+func (u *userUsecase) LoginWithPasskey(ceremonyToken string, response []byte, client entity.ClientInfo) (*entity.TokenPair, error) {
+	user, err := u.passkeys.VerifyLogin(ceremonyToken, response)
+	if err != nil {
+		return nil, err
+	}
+	return u.openSession(user, []string{entity.AMRHardwareKey, entity.AMRMultiFactor}, client)
+}
+
+func (u *userUsecase) UnlockUser(userID uuid.UUID) error {
+	user, err := u.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return u.loginLimiter.Unlock(user.Username)
+}
+
+// RefreshTokens rotates a refresh token: the presented token is spent and a new
+// pair from the same family is issued. Presenting a spent token again revokes
+// the whole family, so both the thief and the victim have to log in again.
+func (u *userUsecase) RefreshTokens(refreshToken string, client entity.ClientInfo) (*entity.TokenPair, error) {
+	stored, err := spendRefreshToken(u.refreshTokenRepo, refreshToken, "")
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// the family is already revoked, end the session with its access tokens
+		if err := u.sessionRepo.Revoke(stored.UserID, stored.FamilyID); err != nil && !errors.Is(err, entity.ErrNotFound) {
+			return nil, err
+		}
+		if err := u.endSession(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.userRepo.GetByID(stored.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user for refresh token: %w", err)
+	}
+
+	if err := u.recordSession(user.ID, stored.FamilyID, client); err != nil {
+		return nil, err
+	}
+	return u.issueTokens(user, stored.FamilyID, stored.AMR)
+}
+
+// Logout revokes whatever the client presented; tokens that are already
+// invalid or expired are simply skipped.
+func (u *userUsecase) Logout(accessToken, refreshToken string) error {
+	if accessToken != "" {
+		if err := u.revokeAccessToken(accessToken); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken != "" {
+		stored, err := u.refreshTokenRepo.GetByHash(service.HashToken(refreshToken))
+		if err != nil && !errors.Is(err, entity.ErrNotFound) {
+			return err
+		}
+		if stored != nil {
+			if err := u.refreshTokenRepo.RevokeFamily(stored.FamilyID); err != nil {
+				return err
+			}
+			if err := u.sessionRepo.Revoke(stored.UserID, stored.FamilyID); err != nil && !errors.Is(err, entity.ErrNotFound) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (u *userUsecase) revokeAccessToken(accessToken string) error {
+	claims, err := u.jwtService.ValidateJWT(accessToken)
+	if err != nil {
+		return nil
+	}
+	if err := u.denylist.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere: every refresh token is
+// revoked and every access token issued until now is denied.
+func (u *userUsecase) RevokeAllSessions(userID uuid.UUID) error {
+	if err := u.refreshTokenRepo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	if err := u.sessionRepo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := u.denylist.RevokeSubject(userID.String(), now, now.Add(u.jwtService.AccessTokenTTL())); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+func (u *userUsecase) ListSessions(userID uuid.UUID) ([]*entity.Session, error) {
+	return u.sessionRepo.ListActiveByUser(userID)
+}
+
+// TerminateSession logs one device out: its refresh tokens stop working and
+// the access tokens it still holds are denied.
+func (u *userUsecase) TerminateSession(userID, sessionID uuid.UUID) error {
+	if err := u.sessionRepo.Revoke(userID, sessionID); err != nil {
+		return err
+	}
+	return u.endSession(sessionID)
+}
+
+func (u *userUsecase) endSession(sessionID uuid.UUID) error {
+	if err := u.refreshTokenRepo.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err := u.denylist.RevokeSubject(entity.SessionDenylistSubject(sessionID.String()), now, now.Add(u.jwtService.AccessTokenTTL()))
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to revoke session access tokens: %w", err)
 	}
+	return nil
+}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", fmt.Errorf("invalid credentials")
+// openSession starts a new session on the client's device.
+func (u *userUsecase) openSession(user *entity.User, amr []string, client entity.ClientInfo) (*entity.TokenPair, error) {
+	sessionID := uuid.New()
+	if err := u.recordSession(user.ID, sessionID, client); err != nil {
+		return nil, err
 	}
+	return u.issueTokens(user, sessionID, amr)
+}
 
-	return u.jwtService.CreateJWT(user)
+func (u *userUsecase) recordSession(userID, sessionID uuid.UUID, client entity.ClientInfo) error {
+	now := time.Now()
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+	return u.sessionRepo.Record(&entity.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(u.refreshTokenTTL),
+	})
+}
+
+// issueTokens continues a session; the session ID is the refresh token family.
+// amr is kept on the refresh token so refreshed access tokens report how the
+// session was originally authenticated.
+func (u *userUsecase) issueTokens(user *entity.User, familyID uuid.UUID, amr []string) (*entity.TokenPair, error) {
+	accessToken, accessExpiresAt, err := u.jwtService.CreateJWT(user, familyID.String(), amr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT token: %v", err)
+	}
+
+	refreshToken, err := service.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	stored := &entity.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: service.HashToken(refreshToken),
+		AMR:       amr,
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.refreshTokenTTL),
+	}
+	if err := u.refreshTokenRepo.Create(stored); err != nil {
+		return nil, err
+	}
+
+	return &entity.TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: stored.ExpiresAt,
+	}, nil
 }
 
 func (u *userUsecase) ListUsers() ([]*entity.User, error) {
@@ -120,15 +586,137 @@ func (u *userUsecase) ListUsers() ([]*entity.User, error) {
 	return users, nil
 }
 
+// SetUserRoles replaces the roles of a user. Access tokens issued before the
+// change are denied, so the new roles apply from the next refresh.
+func (u *userUsecase) SetUserRoles(userID uuid.UUID, roles []string) error {
+	if len(roles) == 0 {
+		return &ValidationError{Field: "roles", Message: "at least one role is required"}
+	}
+	for _, role := range roles {
+		if !entity.IsValidRole(role) {
+			return &ValidationError{Field: "roles", Message: fmt.Sprintf("unknown role %q", role)}
+		}
+	}
+
+	if err := u.userRepo.UpdateRoles(userID, roles); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := u.denylist.RevokeSubject(userID.String(), now, now.Add(u.jwtService.AccessTokenTTL())); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+func (u *userUsecase) GetUser(userID uuid.UUID) (*entity.User, error) {
+	return u.userRepo.GetByID(userID)
+}
+
+func (u *userUsecase) UpdateUser(userID uuid.UUID, update UserUpdate) (*entity.User, error) {
+	user, err := u.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Username != nil && *update.Username != user.Username {
+		if err := validateUsername(*update.Username); err != nil {
+			return nil, err
+		}
+		exists, err := u.userRepo.Exists(*update.Username)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, &ValidationError{Field: "username", Message: "is already taken"}
+		}
+		user.Username = *update.Username
+	}
+
+	emailChanged := false
+	if update.Email != nil && *update.Email != user.Email {
+		if err := validateEmail(*update.Email); err != nil {
+			return nil, err
+		}
+		if err := u.checkEmailAvailable(*update.Email, user.ID); err != nil {
+			return nil, err
+		}
+		user.Email = *update.Email
+		user.EmailVerified = false
+		emailChanged = true
+	}
+
+	user.UpdatedAt = update.UpdatedAt
+	if err := u.userRepo.Update(user); err != nil {
+		if errors.Is(err, entity.ErrEmailTaken) {
+			return nil, &ValidationError{Field: "email", Message: "is already taken"}
+		}
+		return nil, err
+	}
+
+	if emailChanged {
+		if err := u.verifier.SendVerification(user); err != nil {
+			logger.Logger.Error().Err(err).Str("user_id", user.ID.String()).Msg("failed to send verification email")
+		}
+	}
+	return user, nil
+}
+
+// checkEmailAvailable fails unless email is free or already belongs to userID.
+// The unique index decides races, this gives the usual answer up front.
+func (u *userUsecase) checkEmailAvailable(email string, userID uuid.UUID) error {
+	owner, err := u.userRepo.GetByEmail(email)
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if owner.ID != userID {
+		return &ValidationError{Field: "email", Message: "is already taken"}
+	}
+	return nil
+}
+
+func (u *userUsecase) DeleteUser(userID uuid.UUID) error {
+	if err := u.userRepo.Delete(userID); err != nil {
+		return err
+	}
+
+	// refresh tokens go away with the user row, access tokens have to be denied
+	now := time.Now()
+	if err := u.denylist.RevokeSubject(userID.String(), now, now.Add(u.jwtService.AccessTokenTTL())); err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
 //func (u *userUsecase) IssueJWT(username string) (string, error) {
 //return service.CreateJWT(username)
 //}
 
-func (r *reportUsecase) CreateReport(report *entity.Report) error {
+// CreateReport stores a report of userID, or an anonymous one when userID is
+// uuid.Nil. Owner, ID and price are decided here, never by the client.
+func (r *reportUsecase) CreateReport(userID uuid.UUID, req NewReport) (*entity.Report, error) {
+	if err := validateNewReport(userID, req); err != nil {
+		return nil, err
+	}
+
+	report := &entity.Report{
+		Client_generated_id: req.ClientGeneratedID,
+		Description:         strings.TrimSpace(req.Description),
+		Category:            req.Category,
+		Report_id:           uuid.NewString(),
+		Price:               r.price,
+	}
+	if userID != uuid.Nil {
+		report.User_id = userID.String()
+	}
+
 	if err := r.reportRepo.CreateReport(report); err != nil {
-		return fmt.Errorf("failed to create report: %v", err)
+		return nil, fmt.Errorf("failed to create report: %v", err)
 	}
-	return nil
+	return report, nil
 }
 
 func (r *reportUsecase) GetUserReports(userID uuid.UUID) ([]*entity.Report, error) {
@@ -139,38 +727,214 @@ func (r *reportUsecase) GetUserReports(userID uuid.UUID) ([]*entity.Report, erro
 	return reports, nil
 }
 
-func (r *reportUsecase) SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) error {
-	if err := r.reportRepo.SetAnonimousIdReport(clientGeneratedID, userID); err != nil {
-		return fmt.Errorf("failed to set anonymous ID for report: %v", err)
+// SetAnonimousIdReport claims the reports a client made before signing up. The
+// first user to claim an ID owns it: others get ErrReportsClaimed, while the
+// owner may claim again to pick up reports made since (or after a crash
+// between the two stores).
+func (r *reportUsecase) SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) (int64, error) {
+	if !clientGeneratedIDPattern.MatchString(clientGeneratedID) {
+		return 0, &ValidationError{Field: "client_generated_id", Message: "must be 8-64 characters of letters, digits, '_' or '-'"}
 	}
-	return nil
+
+	if err := r.claimRepo.Claim(clientGeneratedID, userID); err != nil {
+		if errors.Is(err, entity.ErrConflict) {
+			return 0, ErrReportsClaimed
+		}
+		return 0, err
+	}
+
+	claimed, err := r.reportRepo.SetAnonimousIdReport(clientGeneratedID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set anonymous ID for report: %v", err)
+	}
+	return claimed, nil
 }
 
-func (r *reportUsecase) PurchaseReport(reportID string) error {
-	userID, price, err := r.reportRepo.GetUserIdAndPriceByReportId(reportID)
+// PurchaseReport charges the owner of the report its price, from their wallet
+// in currency (the price's currency if empty) at the current exchange rate.
+// The debit and a pending purchase are committed together in Postgres first,
+// then the report is marked purchased in Mongo. If that step fails the
+// purchase stays pending and ResumePendingPurchases finishes or refunds it.
+func (r *reportUsecase) PurchaseReport(userID uuid.UUID, reportID string, opts PurchaseOptions) (*entity.ReportPurchase, error) {
+	quote, err := r.quote(userID, reportID, opts)
 	if err != nil {
-		return fmt.Errorf("step 1 failed: %w", err)
+		return nil, err
+	}
+
+	purchase := &entity.ReportPurchase{
+		ID:          uuid.New(),
+		UserID:      userID,
+		ReportID:    reportID,
+		Amount:      quote.Total,
+		Exchange:    quote.Exchange,
+		PromoCodeID: quote.promoCodeID,
+		PromoCode:   quote.PromoCode,
+		Discount:    quote.Discount,
+		CreatedAt:   time.Now(),
+	}
+	// the promo code is checked again and redeemed in the same transaction
+	if err := r.walletRepo.StartPurchase(purchase); err != nil {
+		switch {
+		case errors.Is(err, entity.ErrConflict):
+			return nil, ErrAlreadyPurchased
+		case errors.Is(err, entity.ErrPromoCodeUnavailable):
+			return nil, ErrInvalidPromoCode
+		}
+		return nil, err
+	}
+
+	if err := r.finishPurchase(purchase); err != nil {
+		return nil, err
 	}
+	return purchase, nil
+}
+
+// QuoteReport tells what PurchaseReport would charge with the same options.
+func (r *reportUsecase) QuoteReport(userID uuid.UUID, reportID string, opts PurchaseOptions) (*Quote, error) {
+	return r.quote(userID, reportID, opts)
+}
 
-	if userID == uuid.Nil {
-		return fmt.Errorf("no user found for report ID %s", reportID)
+func (r *reportUsecase) quote(userID uuid.UUID, reportID string, opts PurchaseOptions) (*Quote, error) {
+	report, err := r.reportRepo.GetReport(reportID)
+	if err != nil {
+		return nil, err
+	}
+	// other users' reports are reported as missing, not as forbidden
+	if report.User_id != userID.String() {
+		return nil, entity.ErrNotFound
+	}
+	if report.Is_purchased {
+		return nil, ErrAlreadyPurchased
 	}
 
-	if err := r.userRepo.UpdateBalance(userID, price); err != nil {
-		return fmt.Errorf("step 2 failed: %w", err)
+	quote := &Quote{Price: report.Price, Total: report.Price}
+
+	if code := strings.ToUpper(strings.TrimSpace(opts.PromoCode)); code != "" {
+		promo, err := r.promoRepo.GetByCode(code)
+		if errors.Is(err, entity.ErrNotFound) {
+			return nil, ErrInvalidPromoCode
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !promo.ActiveAt(time.Now()) || !promo.AppliesTo(report.Category) ||
+			(promo.MaxRedemptions > 0 && promo.Redemptions >= promo.MaxRedemptions) {
+			return nil, ErrInvalidPromoCode
+		}
+		if promo.PerUserLimit > 0 {
+			used, err := r.promoRepo.CountUserRedemptions(promo.ID, userID)
+			if err != nil {
+				return nil, err
+			}
+			if used >= promo.PerUserLimit {
+				return nil, ErrInvalidPromoCode
+			}
+		}
+		discount, err := promo.Discount(report.Price)
+		if err != nil {
+			return nil, ErrInvalidPromoCode
+		}
+		if quote.Total, err = report.Price.Add(discount.Neg()); err != nil {
+			return nil, err
+		}
+		quote.PromoCode, quote.Discount, quote.promoCodeID = promo.Code, &discount, &promo.ID
 	}
 
-	if err := r.reportRepo.PurchaseReport(reportID); err != nil {
-		// откат баланса через userRepo
-		if rollbackErr := r.userRepo.UpdateBalance(userID, -price); rollbackErr != nil {
-			return fmt.Errorf("step 3 failed: %v (also failed to rollback balance: %v)", err, rollbackErr)
+	if opts.Currency != "" && opts.Currency != report.Price.Currency {
+		if !entity.IsValidCurrency(opts.Currency) {
+			return nil, &ValidationError{Field: "currency", Message: "is not supported"}
+		}
+		rate, err := r.rates.Rate(report.Price.Currency, opts.Currency)
+		if errors.Is(err, service.ErrRateUnavailable) {
+			return nil, &ValidationError{Field: "currency", Message: "cannot pay for this report in " + opts.Currency}
+		}
+		if err != nil {
+			return nil, err
+		}
+		converted, err := quote.Total.Convert(opts.Currency, rate)
+		if err != nil {
+			return nil, err
 		}
-		return fmt.Errorf("step 3 failed, rolled back balance: %w", err)
+		quote.Exchange = &entity.Exchange{Rate: rate, Original: quote.Total}
+		quote.Total = converted
 	}
+	return quote, nil
+}
 
+// ResumePendingPurchases finishes purchases started before startedBefore that
+// were interrupted between the two stores.
+func (r *reportUsecase) ResumePendingPurchases(startedBefore time.Time) error {
+	purchases, err := r.walletRepo.ListPendingPurchases(startedBefore)
+	if err != nil {
+		return err
+	}
+	for _, purchase := range purchases {
+		if err := r.finishPurchase(purchase); err != nil && !errors.Is(err, entity.ErrNotFound) {
+			logger.Logger.Warn().Err(err).Str("purchase_id", purchase.ID.String()).Msg("pending purchase not finished yet")
+		}
+	}
 	return nil
 }
 
-func (r *reportUsecase) GetUserIdAndPriceByReportId(reportID string) (uuid.UUID, float64, error) {
-	return r.reportRepo.GetUserIdAndPriceByReportId(reportID)
+// RefundReport gives the buyer their money back on behalf of actorID and lets
+// the report be bought again. The credit is committed in Postgres first; if the
+// report could not be updated in Mongo, refunding again finishes that step.
+func (r *reportUsecase) RefundReport(actorID uuid.UUID, reportID, reason string) (*entity.ReportRefund, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxRefundReasonLength {
+		return nil, &ValidationError{Field: "reason", Message: fmt.Sprintf("is required, at most %d characters", maxRefundReasonLength)}
+	}
+
+	report, err := r.reportRepo.GetReport(reportID)
+	if err != nil {
+		return nil, err
+	}
+
+	refund := &entity.ReportRefund{
+		ID:        uuid.New(),
+		ReportID:  reportID,
+		Reason:    reason,
+		ActorID:   actorID,
+		CreatedAt: time.Now(),
+	}
+	err = r.walletRepo.RefundPurchase(refund)
+	if errors.Is(err, entity.ErrConflict) {
+		if !report.Is_purchased {
+			return nil, ErrAlreadyRefunded
+		}
+		// refunded in Postgres, but the report still shows as purchased
+		refund, err = r.walletRepo.LastRefund(reportID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.reportRepo.MarkReportRefunded(refund); err != nil {
+		return nil, err
+	}
+	logger.Logger.Info().Str("report_id", reportID).Str("actor_id", actorID.String()).Str("amount", refund.Amount.String()).Msg("report purchase refunded")
+	return refund, nil
+}
+
+// finishPurchase marks the report purchased and completes the purchase, or
+// refunds it when the report no longer exists. Every step is idempotent.
+func (r *reportUsecase) finishPurchase(purchase *entity.ReportPurchase) error {
+	if err := r.reportRepo.PurchaseReport(purchase.ReportID); err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			if err := r.walletRepo.FailPurchase(purchase.ID); err != nil && !errors.Is(err, entity.ErrNotFound) {
+				logger.Logger.Error().Err(err).Str("purchase_id", purchase.ID.String()).Msg("failed to refund purchase")
+				return ErrPurchasePending
+			}
+			return entity.ErrNotFound
+		}
+		logger.Logger.Error().Err(err).Str("purchase_id", purchase.ID.String()).Msg("failed to mark report purchased")
+		return ErrPurchasePending
+	}
+
+	if err := r.walletRepo.CompletePurchase(purchase.ID); err != nil {
+		logger.Logger.Error().Err(err).Str("purchase_id", purchase.ID.String()).Msg("failed to complete purchase")
+		return ErrPurchasePending
+	}
+	purchase.Status = entity.PurchaseCompleted
+	return nil
 }
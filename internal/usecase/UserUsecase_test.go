@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/repository/memory"
+	"auth/internal/service"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRegisterUserTaken(t *testing.T) {
+	users := newFakeUserRepo(&entity.User{ID: uuid.New(), Username: "ann", Email: "ann@example.com"})
+	uc := NewUserUsecase(users, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, 0)
+
+	if _, err := uc.RegisterUser("ann", "other@example.com", "correct horse battery", entity.ClientInfo{}); !errors.Is(err, ErrUserExists) {
+		t.Errorf("taken username error = %v, want ErrUserExists", err)
+	}
+	var validationErr *ValidationError
+	if _, err := uc.RegisterUser("bob", "ANN@example.com", "correct horse battery", entity.ClientInfo{}); !errors.As(err, &validationErr) || validationErr.Field != "email" {
+		t.Errorf("taken email error = %v, want an email ValidationError", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	user := &entity.User{ID: uuid.New(), Username: "ann", Email: "ann@example.com"}
+	refreshTokens := &fakeRefreshTokenRepo{}
+	sessions := newFakeSessionRepo()
+	denylist := memory.NewDenylist()
+	uc := NewUserUsecase(newFakeUserRepo(user), nil, refreshTokens, sessions, denylist, newTestJWTService(),
+		nil, nil, nil, nil, nil, time.Hour)
+
+	first, err := uc.openSession(user, []string{entity.AMRPassword}, entity.ClientInfo{})
+	if err != nil {
+		t.Fatalf("openSession: %v", err)
+	}
+	rotated, err := uc.RefreshTokens(first.RefreshToken, entity.ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+
+	// a stolen copy of the first token is replayed after the rotation
+	if _, err := uc.RefreshTokens(first.RefreshToken, entity.ClientInfo{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed token error = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := uc.RefreshTokens(rotated.RefreshToken, entity.ClientInfo{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("rotated token after reuse = %v, want ErrInvalidRefreshToken", err)
+	}
+	if active, _ := sessions.ListActiveByUser(user.ID); len(active) != 0 {
+		t.Errorf("%d sessions still active after reuse", len(active))
+	}
+	familyID := refreshTokens.tokens[0].FamilyID
+	if revoked, _ := denylist.IsSubjectRevoked(entity.SessionDenylistSubject(familyID.String()), time.Now().Add(-time.Minute)); !revoked {
+		t.Error("access tokens of the session are not revoked")
+	}
+}
+
+// spendRefreshToken is shared with OAuth clients, which have no sessions to
+// fall back on, so it has to revoke the family itself.
+func TestSpendRefreshTokenReuse(t *testing.T) {
+	repo := &fakeRefreshTokenRepo{}
+	familyID := uuid.New()
+	for _, raw := range []string{"first", "second"} {
+		repo.Create(&entity.RefreshToken{ID: uuid.New(), FamilyID: familyID, TokenHash: service.HashToken(raw),
+			ClientID: "reports-app", ExpiresAt: time.Now().Add(time.Hour)})
+	}
+
+	if _, err := spendRefreshToken(repo, "first", ""); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("token of a client spent as our own = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := spendRefreshToken(repo, "first", "reports-app"); err != nil {
+		t.Fatalf("spendRefreshToken: %v", err)
+	}
+	if _, err := spendRefreshToken(repo, "first", "reports-app"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("spent twice = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := spendRefreshToken(repo, "second", "reports-app"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("rest of the family after reuse = %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const emailVerificationPurpose = "email-verification"
+
+type VerificationUsecase interface {
+	SendVerification(user *entity.User) error
+	ResendVerification(userID uuid.UUID) error
+	VerifyEmail(token string) error
+}
+
+var (
+	ErrVerificationThrottled    = errors.New("verification email was sent recently, try again later")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+)
+
+type verificationUsecase struct {
+	userRepo       entity.UserRepository
+	jwtService     service.JWTService
+	mailer         service.Mailer
+	tokenTTL       time.Duration
+	resendInterval time.Duration
+	publicURL      string
+}
+
+func NewVerificationUsecase(
+	userRepo entity.UserRepository,
+	jwtService service.JWTService,
+	mailer service.Mailer,
+	tokenTTL time.Duration,
+	resendInterval time.Duration,
+	publicURL string,
+) *verificationUsecase {
+	return &verificationUsecase{
+		userRepo:       userRepo,
+		jwtService:     jwtService,
+		mailer:         mailer,
+		tokenTTL:       tokenTTL,
+		resendInterval: resendInterval,
+		publicURL:      publicURL,
+	}
+}
+
+// SendVerification mails a signed link bound to the user's current address,
+// so a link sent to an old address stops working once the email changes.
+func (v *verificationUsecase) SendVerification(user *entity.User) error {
+	sent, err := v.userRepo.TouchVerificationSent(user.ID, time.Now().Add(-v.resendInterval))
+	if err != nil {
+		return err
+	}
+	if !sent {
+		return ErrVerificationThrottled
+	}
+
+	token, err := v.jwtService.CreatePurposeToken(
+		emailVerificationPurpose, user.ID.String(), map[string]string{"email": user.Email}, v.tokenTTL,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %w", err)
+	}
+
+	link := v.publicURL + "/verify-email?token=" + url.QueryEscape(token)
+	return v.mailer.Send(service.Mail{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nplease confirm your email address by opening the link below:\n\n%s\n\nThe link is valid for %s.\n",
+			user.Username, link, v.tokenTTL,
+		),
+	})
+}
+
+func (v *verificationUsecase) ResendVerification(userID uuid.UUID) error {
+	user, err := v.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return v.SendVerification(user)
+}
+
+func (v *verificationUsecase) VerifyEmail(token string) error {
+	claims, err := v.jwtService.ValidatePurposeToken(emailVerificationPurpose, token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	verified, err := v.userRepo.MarkEmailVerified(userID, claims.Data["email"])
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
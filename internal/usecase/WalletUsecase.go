@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/pkg/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WalletUsecase interface {
+	GetWallet(userID uuid.UUID) (*Wallet, error)
+	TopUp(userID uuid.UUID, amount entity.Money) (*TopUp, error)
+	HandlePaymentWebhook(header http.Header, body []byte) error
+}
+
+type Wallet struct {
+	// one per currency the user holds
+	Balances     []entity.Money              `json:"balances"`
+	Transactions []*entity.WalletTransaction `json:"transactions"`
+}
+
+// TopUp is a started top-up, the user completes it at CheckoutURL (if any).
+type TopUp struct {
+	*entity.PaymentIntent
+	CheckoutURL string `json:"checkout_url,omitempty"`
+}
+
+const recentWalletTransactions = 20
+
+var ErrInvalidPaymentWebhook = errors.New("invalid payment webhook")
+
+type walletUsecase struct {
+	walletRepo  entity.WalletRepository
+	paymentRepo entity.PaymentRepository
+	provider    service.PaymentProvider
+	rates       service.RateProvider
+	// converted for top-ups in other currencies
+	maxTopUp entity.Money
+}
+
+func NewWalletUsecase(walletRepo entity.WalletRepository, paymentRepo entity.PaymentRepository, provider service.PaymentProvider, rates service.RateProvider, maxTopUp entity.Money) *walletUsecase {
+	return &walletUsecase{
+		walletRepo:  walletRepo,
+		paymentRepo: paymentRepo,
+		provider:    provider,
+		rates:       rates,
+		maxTopUp:    maxTopUp,
+	}
+}
+
+func (w *walletUsecase) GetWallet(userID uuid.UUID) (*Wallet, error) {
+	balances, err := w.walletRepo.GetBalances(userID)
+	if err != nil {
+		return nil, err
+	}
+	if balances == nil {
+		balances = []entity.Money{}
+	}
+	transactions, err := w.walletRepo.ListTransactions(userID, recentWalletTransactions)
+	if err != nil {
+		return nil, err
+	}
+	if transactions == nil {
+		transactions = []*entity.WalletTransaction{}
+	}
+	return &Wallet{Balances: balances, Transactions: transactions}, nil
+}
+
+// TopUp records a pending payment intent and creates the payment at the
+// provider. The wallet of the amount's currency is credited by
+// HandlePaymentWebhook.
+func (w *walletUsecase) TopUp(userID uuid.UUID, amount entity.Money) (*TopUp, error) {
+	if !entity.IsValidCurrency(amount.Currency) {
+		return nil, &ValidationError{Field: "currency", Message: "is not supported"}
+	}
+	// the limit applies in every currency we have a rate for
+	rate, err := w.rates.Rate(w.maxTopUp.Currency, amount.Currency)
+	if errors.Is(err, service.ErrRateUnavailable) {
+		return nil, &ValidationError{Field: "currency", Message: "is not supported"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	maxTopUp, err := w.maxTopUp.Convert(amount.Currency, rate)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Amount <= 0 || amount.Amount > maxTopUp.Amount {
+		return nil, &ValidationError{Field: "amount", Message: "must be more than 0 and at most " + maxTopUp.String()}
+	}
+
+	now := time.Now()
+	intent := &entity.PaymentIntent{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Amount:    amount,
+		Provider:  w.provider.Name(),
+		Status:    entity.PaymentPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// stored first, so a webhook can never arrive for an unknown payment
+	if err := w.paymentRepo.Create(intent); err != nil {
+		return nil, err
+	}
+
+	payment, err := w.provider.CreatePayment(intent.ID, intent.Amount)
+	if err != nil {
+		if _, failErr := w.paymentRepo.Fail(intent.ID); failErr != nil {
+			logger.Logger.Error().Err(failErr).Str("payment_id", intent.ID.String()).Msg("failed to mark payment failed")
+		}
+		return nil, fmt.Errorf("failed to create payment: %w", err)
+	}
+	if err := w.paymentRepo.SetReference(intent.ID, payment.Reference); err != nil {
+		return nil, err
+	}
+	intent.Reference = payment.Reference
+
+	return &TopUp{PaymentIntent: intent, CheckoutURL: payment.CheckoutURL}, nil
+}
+
+// HandlePaymentWebhook applies a provider notification. Providers retry
+// webhooks, so notifications about settled payments are accepted and ignored.
+func (w *walletUsecase) HandlePaymentWebhook(header http.Header, body []byte) error {
+	event, err := w.provider.ParseWebhook(header, body)
+	if err != nil {
+		return ErrInvalidPaymentWebhook
+	}
+
+	intent, err := w.paymentRepo.GetByReference(w.provider.Name(), event.Reference)
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	switch event.Status {
+	case entity.PaymentSucceeded:
+		changed, err = w.paymentRepo.Succeed(intent.ID)
+	case entity.PaymentFailed:
+		changed, err = w.paymentRepo.Fail(intent.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if !changed {
+		logger.Logger.Info().Str("payment_id", intent.ID.String()).Str("status", event.Status).Msg("payment already settled, webhook ignored")
+	}
+	return nil
+}
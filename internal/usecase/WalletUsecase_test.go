@@ -0,0 +1,147 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTopUpValidatesAmount(t *testing.T) {
+	provider := service.NewFakePaymentProvider("whsec_test", time.Minute)
+	wallets := newFakeWalletRepo()
+	uc := NewWalletUsecase(wallets, newFakePaymentRepo(wallets), provider, newFakeRates(nil), rub(100000))
+
+	for _, amount := range []entity.Money{rub(0), rub(-500), rub(100001), {Amount: 500, Currency: "USD"}} {
+		var validationErr *ValidationError
+		if _, err := uc.TopUp(uuid.New(), amount); !errors.As(err, &validationErr) {
+			t.Errorf("TopUp(%s) error = %v, want a validation error", amount, err)
+		}
+	}
+	if _, err := uc.TopUp(uuid.New(), rub(100000)); err != nil {
+		t.Errorf("TopUp(1000.00 RUB) = %v, the limit itself is allowed", err)
+	}
+}
+
+func TestTopUpInvalidCurrencyNotQuoted(t *testing.T) {
+	provider := service.NewFakePaymentProvider("whsec_test", time.Minute)
+	wallets := newFakeWalletRepo()
+	rates := newFakeRates(nil)
+	uc := NewWalletUsecase(wallets, newFakePaymentRepo(wallets), provider, rates, rub(100000))
+
+	var validationErr *ValidationError
+	if _, err := uc.TopUp(uuid.New(), entity.Money{Amount: 100, Currency: "XYZ"}); !errors.As(err, &validationErr) || validationErr.Field != "currency" {
+		t.Errorf("TopUp error = %v, want a currency validation error", err)
+	}
+	if len(rates.asked) != 0 {
+		t.Errorf("rate provider was asked for %v", rates.asked)
+	}
+}
+
+func TestTopUpLimitIsConverted(t *testing.T) {
+	provider := service.NewFakePaymentProvider("whsec_test", time.Minute)
+	wallets := newFakeWalletRepo()
+	rates := newFakeRates(map[string]string{"RUB/USD": "0.0125"})
+	uc := NewWalletUsecase(wallets, newFakePaymentRepo(wallets), provider, rates, rub(100000))
+
+	// 1000 RUB is 12.50 USD at this rate
+	if _, err := uc.TopUp(uuid.New(), entity.Money{Amount: 1250, Currency: "USD"}); err != nil {
+		t.Errorf("TopUp(12.50 USD) = %v, want allowed", err)
+	}
+	var validationErr *ValidationError
+	if _, err := uc.TopUp(uuid.New(), entity.Money{Amount: 1251, Currency: "USD"}); !errors.As(err, &validationErr) || validationErr.Field != "amount" {
+		t.Errorf("TopUp(12.51 USD) error = %v, want an amount validation error", err)
+	}
+}
+
+// webhook builds a fake provider notification signed at the given time.
+func webhook(provider *service.FakePaymentProvider, kind, reference string, at time.Time) (http.Header, []byte) {
+	body := []byte(`{"type":"` + kind + `","payment_id":"` + reference + `"}`)
+	header := http.Header{}
+	header.Set("Payment-Signature", provider.Sign(body, at))
+	return header, body
+}
+
+func TestPaymentWebhookCreditsOnce(t *testing.T) {
+	provider := service.NewFakePaymentProvider("whsec_test", time.Minute)
+	wallets := newFakeWalletRepo()
+	uc := NewWalletUsecase(wallets, newFakePaymentRepo(wallets), provider, newFakeRates(nil), rub(100000))
+	userID := uuid.New()
+
+	topUp, err := uc.TopUp(userID, rub(2550))
+	if err != nil {
+		t.Fatalf("TopUp: %v", err)
+	}
+	if topUp.Status != entity.PaymentPending {
+		t.Errorf("status = %s, want pending", topUp.Status)
+	}
+	wallet, err := uc.GetWallet(userID)
+	if err != nil {
+		t.Fatalf("GetWallet before the webhook: %v", err)
+	}
+	if len(wallet.Balances) != 0 {
+		t.Fatalf("balances = %v before the webhook, want none", wallet.Balances)
+	}
+
+	// providers deliver webhooks at least once
+	for i := 0; i < 2; i++ {
+		if err := uc.HandlePaymentWebhook(webhook(provider, "payment.succeeded", topUp.Reference, time.Now())); err != nil {
+			t.Fatalf("HandlePaymentWebhook #%d: %v", i+1, err)
+		}
+	}
+	wallet, err = uc.GetWallet(userID)
+	if err != nil {
+		t.Fatalf("GetWallet: %v", err)
+	}
+	if len(wallet.Balances) != 1 || wallet.Balances[0] != rub(2550) || len(wallet.Transactions) != 1 {
+		t.Errorf("wallet = %v with %d entries, want 25.50 RUB with 1", wallet.Balances, len(wallet.Transactions))
+	}
+
+	// a late failure cannot undo the settled payment
+	if err := uc.HandlePaymentWebhook(webhook(provider, "payment.failed", topUp.Reference, time.Now())); err != nil {
+		t.Fatalf("HandlePaymentWebhook: %v", err)
+	}
+	if balance := wallets.balance(userID, "RUB"); balance != 2550 {
+		t.Errorf("balance = %d, want 2550", balance)
+	}
+}
+
+func TestPaymentWebhookRejectsForgeries(t *testing.T) {
+	provider := service.NewFakePaymentProvider("whsec_test", time.Minute)
+	wallets := newFakeWalletRepo()
+	uc := NewWalletUsecase(wallets, newFakePaymentRepo(wallets), provider, newFakeRates(nil), rub(100000))
+	userID := uuid.New()
+	topUp, err := uc.TopUp(userID, rub(1000))
+	if err != nil {
+		t.Fatalf("TopUp: %v", err)
+	}
+
+	forger := service.NewFakePaymentProvider("not_the_secret", time.Minute)
+	tests := map[string]func() (http.Header, []byte){
+		"wrong secret": func() (http.Header, []byte) {
+			return webhook(forger, "payment.succeeded", topUp.Reference, time.Now())
+		},
+		"replayed later": func() (http.Header, []byte) {
+			return webhook(provider, "payment.succeeded", topUp.Reference, time.Now().Add(-time.Hour))
+		},
+		"body changed after signing": func() (http.Header, []byte) {
+			header, _ := webhook(provider, "payment.failed", topUp.Reference, time.Now())
+			_, body := webhook(provider, "payment.succeeded", topUp.Reference, time.Now())
+			return header, body
+		},
+	}
+	for name, build := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := uc.HandlePaymentWebhook(build()); !errors.Is(err, ErrInvalidPaymentWebhook) {
+				t.Errorf("error = %v, want ErrInvalidPaymentWebhook", err)
+			}
+		})
+	}
+	if balance := wallets.balance(userID, "RUB"); balance != 0 {
+		t.Errorf("balance = %d, want 0", balance)
+	}
+}
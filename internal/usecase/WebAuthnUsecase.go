@@ -0,0 +1,328 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"auth/pkg/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+type WebAuthnUsecase interface {
+	BeginRegistration(userID uuid.UUID) (*PasskeyCeremony, error)
+	FinishRegistration(userID uuid.UUID, ceremonyToken, name string, response []byte) (*entity.WebAuthnCredential, error)
+	ListCredentials(userID uuid.UUID) ([]*entity.WebAuthnCredential, error)
+	DeleteCredential(userID, credentialID uuid.UUID) error
+	BeginLogin() (*PasskeyCeremony, error)
+	VerifyLogin(ceremonyToken string, response []byte) (*entity.User, error)
+}
+
+// PasskeyCeremony is handed to navigator.credentials. The ceremony token keeps
+// the challenge on the client, signed, until the response comes back.
+type PasskeyCeremony struct {
+	Options       interface{} `json:"options"`
+	CeremonyToken string      `json:"ceremony_token"`
+}
+
+const (
+	passkeyRegistrationPurpose = "webauthn-registration"
+	passkeyLoginPurpose        = "webauthn-login"
+	maxPasskeyNameLength       = 64
+)
+
+var (
+	ErrInvalidPasskeyCeremony = errors.New("invalid or expired passkey ceremony, start again")
+	ErrPasskeyRejected        = errors.New("passkey could not be verified")
+	ErrPasskeyAlreadyExists   = errors.New("this passkey is already registered")
+)
+
+type webAuthnUsecase struct {
+	credentialRepo entity.WebAuthnCredentialRepository
+	userRepo       entity.UserRepository
+	jwtService     service.JWTService
+	denylist       entity.TokenDenylist
+	webAuthn       *webauthn.WebAuthn
+	ceremonyTTL    time.Duration
+}
+
+func NewWebAuthnUsecase(
+	credentialRepo entity.WebAuthnCredentialRepository,
+	userRepo entity.UserRepository,
+	jwtService service.JWTService,
+	denylist entity.TokenDenylist,
+	webAuthn *webauthn.WebAuthn,
+	ceremonyTTL time.Duration,
+) *webAuthnUsecase {
+	return &webAuthnUsecase{
+		credentialRepo: credentialRepo,
+		userRepo:       userRepo,
+		jwtService:     jwtService,
+		denylist:       denylist,
+		webAuthn:       webAuthn,
+		ceremonyTTL:    ceremonyTTL,
+	}
+}
+
+func (w *webAuthnUsecase) BeginRegistration(userID uuid.UUID) (*PasskeyCeremony, error) {
+	user, err := w.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the authenticator refuses to create a second passkey for this account
+	options, session, err := w.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey registration: %w", err)
+	}
+
+	token, err := w.sealSession(passkeyRegistrationPurpose, userID.String(), session)
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{Options: options, CeremonyToken: token}, nil
+}
+
+func (w *webAuthnUsecase) FinishRegistration(userID uuid.UUID, ceremonyToken, name string, response []byte) (*entity.WebAuthnCredential, error) {
+	session, subject, err := w.openSession(passkeyRegistrationPurpose, ceremonyToken)
+	if err != nil {
+		return nil, err
+	}
+	if subject != userID.String() {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) > maxPasskeyNameLength {
+		return nil, &ValidationError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxPasskeyNameLength)}
+	}
+
+	user, err := w.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyRejected
+	}
+	created, err := w.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		logger.Logger.Warn().Err(err).Str("user_id", userID.String()).Msg("passkey registration rejected")
+		return nil, ErrPasskeyRejected
+	}
+
+	transports := make([]string, 0, len(created.Transport))
+	for _, transport := range created.Transport {
+		transports = append(transports, string(transport))
+	}
+	credential := &entity.WebAuthnCredential{
+		ID:              uuid.New(),
+		UserID:          userID,
+		CredentialID:    created.ID,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		Transports:      transports,
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       created.Authenticator.SignCount,
+		BackupEligible:  created.Flags.BackupEligible,
+		BackupState:     created.Flags.BackupState,
+		Name:            name,
+		CreatedAt:       time.Now(),
+	}
+	err = w.credentialRepo.Create(credential)
+	if errors.Is(err, entity.ErrConflict) {
+		return nil, ErrPasskeyAlreadyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (w *webAuthnUsecase) ListCredentials(userID uuid.UUID) ([]*entity.WebAuthnCredential, error) {
+	return w.credentialRepo.ListByUser(userID)
+}
+
+func (w *webAuthnUsecase) DeleteCredential(userID, credentialID uuid.UUID) error {
+	return w.credentialRepo.Delete(userID, credentialID)
+}
+
+// BeginLogin starts a usernameless login: the browser offers every passkey it
+// has for this site and the user handle in the response tells us who it is.
+func (w *webAuthnUsecase) BeginLogin() (*PasskeyCeremony, error) {
+	options, session, err := w.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin passkey login: %w", err)
+	}
+
+	token, err := w.sealSession(passkeyLoginPurpose, "", session)
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyCeremony{Options: options, CeremonyToken: token}, nil
+}
+
+func (w *webAuthnUsecase) VerifyLogin(ceremonyToken string, response []byte) (*entity.User, error) {
+	session, _, err := w.openSession(passkeyLoginPurpose, ceremonyToken)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyRejected
+	}
+
+	var owner *webAuthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		owner, err = w.loadUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		return owner, nil
+	}
+
+	validated, err := w.webAuthn.ValidateDiscoverableLogin(findUser, *session, parsed)
+	if err != nil {
+		logger.Logger.Warn().Err(err).Msg("passkey login rejected")
+		return nil, ErrPasskeyRejected
+	}
+
+	stored := owner.find(validated.ID)
+	if stored == nil {
+		return nil, ErrPasskeyRejected
+	}
+	// the counter went backwards: two copies of the private key exist
+	if validated.Authenticator.CloneWarning {
+		logger.Logger.Warn().Str("user_id", owner.user.ID.String()).Str("credential", stored.ID.String()).
+			Msg("passkey sign counter regressed, possible cloned authenticator")
+		return nil, ErrPasskeyRejected
+	}
+
+	if err := w.credentialRepo.UpdateUsage(stored.ID, validated.Authenticator.SignCount, validated.Flags.BackupState); err != nil {
+		return nil, err
+	}
+	return owner.user, nil
+}
+
+// sealSession puts the ceremony state into a short-lived purpose token so no
+// server-side session store is needed.
+func (w *webAuthnUsecase) sealSession(purpose, subject string, session *webauthn.SessionData) (string, error) {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode passkey session: %w", err)
+	}
+	token, err := w.jwtService.CreatePurposeToken(purpose, subject, map[string]string{"session": string(raw)}, w.ceremonyTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to create passkey ceremony token: %w", err)
+	}
+	return token, nil
+}
+
+// openSession accepts a ceremony token once, so a captured response cannot be
+// replayed against the same challenge.
+func (w *webAuthnUsecase) openSession(purpose, token string) (*webauthn.SessionData, string, error) {
+	claims, err := w.jwtService.ValidatePurposeToken(purpose, token)
+	if err != nil {
+		return nil, "", ErrInvalidPasskeyCeremony
+	}
+
+	revoked, err := w.denylist.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check passkey ceremony: %w", err)
+	}
+	if revoked {
+		return nil, "", ErrInvalidPasskeyCeremony
+	}
+	if err := w.denylist.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, "", fmt.Errorf("failed to spend passkey ceremony: %w", err)
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(claims.Data["session"]), &session); err != nil {
+		return nil, "", ErrInvalidPasskeyCeremony
+	}
+	return &session, claims.Subject, nil
+}
+
+func (w *webAuthnUsecase) loadUser(userID uuid.UUID) (*webAuthnUser, error) {
+	user, err := w.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := w.credentialRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, credential := range stored {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credential.CredentialID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.AAGUID,
+				SignCount: credential.SignCount,
+			},
+		})
+	}
+	return &webAuthnUser{user: user, stored: stored, credentials: credentials}, nil
+}
+
+// webAuthnUser adapts entity.User to webauthn.User. The user handle is the
+// account UUID, so it never changes with the username.
+type webAuthnUser struct {
+	user        *entity.User
+	stored      []*entity.WebAuthnCredential
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *webAuthnUser) find(credentialID []byte) *entity.WebAuthnCredential {
+	for _, credential := range u.stored {
+		if string(credential.CredentialID) == string(credentialID) {
+			return credential
+		}
+	}
+	return nil
+}
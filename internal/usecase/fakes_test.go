@@ -0,0 +1,1176 @@
+package usecase
+
+import (
+	"auth/config"
+	"auth/internal/entity"
+	"auth/internal/service"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// In-memory stand-ins for the repositories, keeping the contracts documented
+// on the entity interfaces and nothing more.
+
+type fakeReportRepo struct {
+	mu      sync.Mutex
+	reports map[string]*entity.Report
+	// returned by PurchaseReport instead of marking the report, to
+	// interrupt a purchase between the two stores
+	purchaseErr error
+	// returned by MarkReportRefunded, for refunds interrupted the same way
+	refundErr error
+}
+
+func newFakeReportRepo(reports ...*entity.Report) *fakeReportRepo {
+	repo := &fakeReportRepo{reports: make(map[string]*entity.Report)}
+	for _, report := range reports {
+		repo.reports[report.Report_id] = report
+	}
+	return repo
+}
+
+func (f *fakeReportRepo) CreateReport(report *entity.Report) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reports[report.Report_id] = report
+	return nil
+}
+
+func (f *fakeReportRepo) GetUserReports(userID uuid.UUID) ([]*entity.Report, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var reports []*entity.Report
+	for _, report := range f.reports {
+		if report.User_id == userID.String() {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+func (f *fakeReportRepo) SetAnonimousIdReport(clientGeneratedID string, userID uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeReportRepo) GetReport(reportID string) (*entity.Report, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	report, ok := f.reports[reportID]
+	if !ok {
+		return nil, entity.ErrNotFound
+	}
+	copied := *report
+	return &copied, nil
+}
+
+func (f *fakeReportRepo) PurchaseReport(reportID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.purchaseErr != nil {
+		return f.purchaseErr
+	}
+	report, ok := f.reports[reportID]
+	if !ok {
+		return entity.ErrNotFound
+	}
+	report.Is_purchased = true
+	return nil
+}
+
+func (f *fakeReportRepo) MarkReportRefunded(refund *entity.ReportRefund) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.refundErr != nil {
+		return f.refundErr
+	}
+	report, ok := f.reports[refund.ReportID]
+	if !ok {
+		return entity.ErrNotFound
+	}
+	for _, entry := range report.Refunds {
+		if entry.ID == refund.ID.String() {
+			return nil
+		}
+	}
+	report.Is_purchased = false
+	report.Refunds = append(report.Refunds, entity.ReportRefundEntry{
+		ID:        refund.ID.String(),
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		ActorID:   refund.ActorID.String(),
+		CreatedAt: refund.CreatedAt,
+	})
+	return nil
+}
+
+func (f *fakeReportRepo) isPurchased(reportID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reports[reportID].Is_purchased
+}
+
+// newTestJWTService signs with a shared secret, so tokens need no key files.
+func newTestJWTService() service.JWTService {
+	return service.NewJWTService(service.NewHMACKeySet("test-secret"), config.AuthConfig{
+		Issuer: "freeze-auth", Audience: "freeze-api", AccessTokenTTL: time.Minute,
+	})
+}
+
+func rub(kopecks int64) entity.Money {
+	return entity.Money{Amount: kopecks, Currency: "RUB"}
+}
+
+type walletKey struct {
+	userID   uuid.UUID
+	currency string
+}
+
+// fakeWalletRepo keeps a ledger like the Postgres one: every change of a
+// balance is an entry, balances never go below zero and a user has a wallet
+// per currency. Promo codes are redeemed in promos, as in the same transaction.
+type fakeWalletRepo struct {
+	mu        sync.Mutex
+	balances  map[walletKey]int64
+	ledger    []*entity.WalletTransaction
+	purchases []*entity.ReportPurchase
+	refunds   []*entity.ReportRefund
+	promos    *fakePromoRepo
+	// returned by StartPurchase before anything is changed
+	startErr error
+}
+
+func newFakeWalletRepo() *fakeWalletRepo {
+	return &fakeWalletRepo{balances: make(map[walletKey]int64)}
+}
+
+func (f *fakeWalletRepo) deposit(userID uuid.UUID, amount entity.Money) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.post(userID, amount, entity.TransactionOpeningBalance, "")
+}
+
+// post needs f.mu held
+func (f *fakeWalletRepo) post(userID uuid.UUID, amount entity.Money, kind, reference string) (*entity.WalletTransaction, error) {
+	key := walletKey{userID, amount.Currency}
+	balance, ok := f.balances[key]
+	if (!ok && amount.Amount < 0) || balance+amount.Amount < 0 {
+		return nil, entity.ErrInsufficientFunds
+	}
+	f.balances[key] = balance + amount.Amount
+	transaction := &entity.WalletTransaction{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Amount:       amount,
+		BalanceAfter: entity.Money{Amount: f.balances[key], Currency: amount.Currency},
+		Kind:         kind,
+		Reference:    reference,
+		CreatedAt:    time.Now(),
+	}
+	f.ledger = append(f.ledger, transaction)
+	return transaction, nil
+}
+
+func (f *fakeWalletRepo) GetBalances(userID uuid.UUID) ([]entity.Money, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var balances []entity.Money
+	for key, amount := range f.balances {
+		if key.userID == userID {
+			balances = append(balances, entity.Money{Amount: amount, Currency: key.currency})
+		}
+	}
+	return balances, nil
+}
+
+// balance is the balance of a wallet in minor units, 0 if there is none
+func (f *fakeWalletRepo) balance(userID uuid.UUID, currency string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.balances[walletKey{userID, currency}]
+}
+
+func (f *fakeWalletRepo) ListTransactions(userID uuid.UUID, limit int) ([]*entity.WalletTransaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var transactions []*entity.WalletTransaction
+	for i := len(f.ledger) - 1; i >= 0 && len(transactions) < limit; i-- {
+		if f.ledger[i].UserID == userID {
+			transactions = append(transactions, f.ledger[i])
+		}
+	}
+	return transactions, nil
+}
+
+func (f *fakeWalletRepo) StartPurchase(purchase *entity.ReportPurchase) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.startErr != nil {
+		return f.startErr
+	}
+	for _, existing := range f.purchases {
+		if existing.ReportID == purchase.ReportID && (existing.Status == entity.PurchasePending || existing.Status == entity.PurchaseCompleted) {
+			return entity.ErrConflict
+		}
+	}
+	if purchase.PromoCodeID != nil {
+		if err := f.promos.redeem(*purchase.PromoCodeID, purchase.UserID, purchase.ID); err != nil {
+			return err
+		}
+	}
+	debit, err := f.post(purchase.UserID, purchase.Amount.Neg(), entity.TransactionPurchase, purchase.ID.String())
+	if err != nil {
+		if purchase.PromoCodeID != nil {
+			f.promos.release(purchase.ID)
+		}
+		return err
+	}
+	debit.Exchange = purchase.Exchange
+	purchase.TransactionID = debit.ID
+	purchase.Status = entity.PurchasePending
+	stored := *purchase
+	f.purchases = append(f.purchases, &stored)
+	return nil
+}
+
+// find needs f.mu held
+func (f *fakeWalletRepo) find(purchaseID uuid.UUID) *entity.ReportPurchase {
+	for _, purchase := range f.purchases {
+		if purchase.ID == purchaseID {
+			return purchase
+		}
+	}
+	return nil
+}
+
+func (f *fakeWalletRepo) CompletePurchase(purchaseID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	purchase := f.find(purchaseID)
+	if purchase == nil {
+		return entity.ErrNotFound
+	}
+	if purchase.Status == entity.PurchasePending {
+		purchase.Status = entity.PurchaseCompleted
+	}
+	return nil
+}
+
+func (f *fakeWalletRepo) FailPurchase(purchaseID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	purchase := f.find(purchaseID)
+	if purchase == nil || purchase.Status != entity.PurchasePending {
+		return entity.ErrNotFound
+	}
+	if _, err := f.post(purchase.UserID, purchase.Amount, entity.TransactionPurchaseReverse, purchase.ID.String()); err != nil {
+		return err
+	}
+	if purchase.PromoCodeID != nil {
+		f.promos.release(purchase.ID)
+	}
+	purchase.Status = entity.PurchaseFailed
+	return nil
+}
+
+func (f *fakeWalletRepo) ListPendingPurchases(startedBefore time.Time) ([]*entity.ReportPurchase, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var pending []*entity.ReportPurchase
+	for _, purchase := range f.purchases {
+		if purchase.Status == entity.PurchasePending && purchase.CreatedAt.Before(startedBefore) {
+			copied := *purchase
+			pending = append(pending, &copied)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeWalletRepo) RefundPurchase(refund *entity.ReportRefund) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	refunded := false
+	for _, purchase := range f.purchases {
+		if purchase.ReportID != refund.ReportID {
+			continue
+		}
+		switch purchase.Status {
+		case entity.PurchaseRefunded:
+			refunded = true
+		case entity.PurchaseCompleted:
+			credit, err := f.post(purchase.UserID, purchase.Amount, entity.TransactionRefund, refund.ID.String())
+			if err != nil {
+				return err
+			}
+			if purchase.PromoCodeID != nil {
+				f.promos.release(purchase.ID)
+			}
+			purchase.Status = entity.PurchaseRefunded
+			refund.PurchaseID, refund.UserID, refund.Amount = purchase.ID, purchase.UserID, purchase.Amount
+			refund.TransactionID = credit.ID
+			stored := *refund
+			f.refunds = append(f.refunds, &stored)
+			return nil
+		}
+	}
+	if refunded {
+		return entity.ErrConflict
+	}
+	return entity.ErrNotFound
+}
+
+func (f *fakeWalletRepo) LastRefund(reportID string) (*entity.ReportRefund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.refunds) - 1; i >= 0; i-- {
+		if f.refunds[i].ReportID == reportID {
+			copied := *f.refunds[i]
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakeWalletRepo) purchaseStatuses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var statuses []string
+	for _, purchase := range f.purchases {
+		statuses = append(statuses, purchase.Status)
+	}
+	return statuses
+}
+
+// fakePaymentRepo credits the wallet repo it was given when an intent succeeds.
+type fakePaymentRepo struct {
+	mu      sync.Mutex
+	wallets *fakeWalletRepo
+	intents map[uuid.UUID]*entity.PaymentIntent
+}
+
+func newFakePaymentRepo(wallets *fakeWalletRepo) *fakePaymentRepo {
+	return &fakePaymentRepo{wallets: wallets, intents: make(map[uuid.UUID]*entity.PaymentIntent)}
+}
+
+func (f *fakePaymentRepo) Create(intent *entity.PaymentIntent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := *intent
+	f.intents[intent.ID] = &stored
+	return nil
+}
+
+func (f *fakePaymentRepo) SetReference(id uuid.UUID, reference string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[id]
+	if !ok {
+		return entity.ErrNotFound
+	}
+	intent.Reference = reference
+	return nil
+}
+
+func (f *fakePaymentRepo) GetByReference(provider, reference string) (*entity.PaymentIntent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, intent := range f.intents {
+		if intent.Provider == provider && intent.Reference == reference {
+			copied := *intent
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakePaymentRepo) Succeed(id uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[id]
+	if !ok || intent.Status != entity.PaymentPending {
+		return false, nil
+	}
+	f.wallets.mu.Lock()
+	_, err := f.wallets.post(intent.UserID, intent.Amount, entity.TransactionTopUp, intent.ID.String())
+	f.wallets.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	intent.Status = entity.PaymentSucceeded
+	return true, nil
+}
+
+func (f *fakePaymentRepo) Fail(id uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, ok := f.intents[id]
+	if !ok || intent.Status != entity.PaymentPending {
+		return false, nil
+	}
+	intent.Status = entity.PaymentFailed
+	return true, nil
+}
+
+type promoRedemption struct {
+	codeID, userID, purchaseID uuid.UUID
+}
+
+// fakePromoRepo counts redemptions like the promo_code_redemptions table.
+type fakePromoRepo struct {
+	mu          sync.Mutex
+	codes       []*entity.PromoCode
+	redemptions []promoRedemption
+}
+
+func newFakePromoRepo(codes ...*entity.PromoCode) *fakePromoRepo {
+	return &fakePromoRepo{codes: codes}
+}
+
+func (f *fakePromoRepo) Create(code *entity.PromoCode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, existing := range f.codes {
+		if existing.Code == code.Code {
+			return entity.ErrConflict
+		}
+	}
+	f.codes = append(f.codes, code)
+	return nil
+}
+
+func (f *fakePromoRepo) GetByCode(code string) (*entity.PromoCode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, existing := range f.codes {
+		if existing.Code == code {
+			copied := *existing
+			copied.Redemptions = f.count(existing.ID, uuid.Nil)
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakePromoRepo) List() ([]*entity.PromoCode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.codes), nil
+}
+
+func (f *fakePromoRepo) Deactivate(id uuid.UUID, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, existing := range f.codes {
+		if existing.ID == id {
+			existing.ValidUntil = &at
+			return nil
+		}
+	}
+	return entity.ErrNotFound
+}
+
+func (f *fakePromoRepo) CountUserRedemptions(codeID, userID uuid.UUID) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count(codeID, userID), nil
+}
+
+// count needs f.mu held; uuid.Nil counts every user
+func (f *fakePromoRepo) count(codeID, userID uuid.UUID) int {
+	n := 0
+	for _, redemption := range f.redemptions {
+		if redemption.codeID == codeID && (userID == uuid.Nil || redemption.userID == userID) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakePromoRepo) redeem(codeID, userID, purchaseID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	idx := slices.IndexFunc(f.codes, func(code *entity.PromoCode) bool { return code.ID == codeID })
+	if idx < 0 {
+		return entity.ErrPromoCodeUnavailable
+	}
+	code := f.codes[idx]
+	if !code.ActiveAt(time.Now()) ||
+		(code.MaxRedemptions > 0 && f.count(codeID, uuid.Nil) >= code.MaxRedemptions) ||
+		(code.PerUserLimit > 0 && f.count(codeID, userID) >= code.PerUserLimit) {
+		return entity.ErrPromoCodeUnavailable
+	}
+	f.redemptions = append(f.redemptions, promoRedemption{codeID, userID, purchaseID})
+	return nil
+}
+
+func (f *fakePromoRepo) release(purchaseID uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.redemptions = slices.DeleteFunc(f.redemptions, func(redemption promoRedemption) bool {
+		return redemption.purchaseID == purchaseID
+	})
+}
+
+func (f *fakePromoRepo) redemptionCount(codeID uuid.UUID) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count(codeID, uuid.Nil)
+}
+
+// fakeRates serves fixed rates and remembers which pairs were asked for.
+type fakeRates struct {
+	mu    sync.Mutex
+	rates map[string]string
+	asked []string
+}
+
+func newFakeRates(rates map[string]string) *fakeRates {
+	return &fakeRates{rates: rates}
+}
+
+func (f *fakeRates) Rate(from, to string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.asked = append(f.asked, from+"/"+to)
+	if from == to {
+		return "1", nil
+	}
+	if rate, ok := f.rates[from+"/"+to]; ok {
+		return rate, nil
+	}
+	return "", service.ErrRateUnavailable
+}
+
+// fakeUserRepo keeps users by ID; emails match without regard to case, like
+// the unique index on lower(email).
+type fakeUserRepo struct {
+	mu                  sync.Mutex
+	users               map[uuid.UUID]*entity.User
+	verificationSentAt  map[uuid.UUID]time.Time
+	passwordResetSentAt map[uuid.UUID]time.Time
+}
+
+func newFakeUserRepo(users ...*entity.User) *fakeUserRepo {
+	f := &fakeUserRepo{
+		users:               map[uuid.UUID]*entity.User{},
+		verificationSentAt:  map[uuid.UUID]time.Time{},
+		passwordResetSentAt: map[uuid.UUID]time.Time{},
+	}
+	for _, user := range users {
+		f.users[user.ID] = user
+	}
+	return f
+}
+
+func (f *fakeUserRepo) Create(user *entity.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, existing := range f.users {
+		if existing.Username == user.Username || (user.Email != "" && strings.EqualFold(existing.Email, user.Email)) {
+			return entity.ErrConflict
+		}
+	}
+	copied := *user
+	f.users[user.ID] = &copied
+	return nil
+}
+
+func (f *fakeUserRepo) find(match func(user *entity.User) bool) (*entity.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, user := range f.users {
+		if match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakeUserRepo) GetByID(id uuid.UUID) (*entity.User, error) {
+	return f.find(func(user *entity.User) bool { return user.ID == id })
+}
+
+func (f *fakeUserRepo) GetByUsername(username string) (*entity.User, error) {
+	return f.find(func(user *entity.User) bool { return user.Username == username })
+}
+
+func (f *fakeUserRepo) GetByEmail(email string) (*entity.User, error) {
+	return f.find(func(user *entity.User) bool { return user.Email != "" && strings.EqualFold(user.Email, email) })
+}
+
+func (f *fakeUserRepo) Update(user *entity.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.users[user.ID]; !ok {
+		return entity.ErrNotFound
+	}
+	copied := *user
+	f.users[user.ID] = &copied
+	return nil
+}
+
+func (f *fakeUserRepo) Delete(id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.users, id)
+	return nil
+}
+
+func (f *fakeUserRepo) List() ([]*entity.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := make([]*entity.User, 0, len(f.users))
+	for _, user := range f.users {
+		copied := *user
+		users = append(users, &copied)
+	}
+	return users, nil
+}
+
+func (f *fakeUserRepo) Exists(username string) (bool, error) {
+	_, err := f.GetByUsername(username)
+	return err == nil, nil
+}
+
+func (f *fakeUserRepo) update(userID uuid.UUID, change func(user *entity.User)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[userID]
+	if !ok {
+		return entity.ErrNotFound
+	}
+	change(user)
+	return nil
+}
+
+func (f *fakeUserRepo) UpdateRoles(userID uuid.UUID, roles []string) error {
+	return f.update(userID, func(user *entity.User) { user.Roles = slices.Clone(roles) })
+}
+
+func (f *fakeUserRepo) UpdatePassword(userID uuid.UUID, passwordHash string) error {
+	return f.update(userID, func(user *entity.User) { user.PasswordHash = passwordHash })
+}
+
+func (f *fakeUserRepo) MarkEmailVerified(userID uuid.UUID, email string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[userID]
+	if !ok || user.Email != email {
+		return false, nil
+	}
+	user.EmailVerified = true
+	return true, nil
+}
+
+// touch needs f.mu held
+func (f *fakeUserRepo) touch(sentAt map[uuid.UUID]time.Time, userID uuid.UUID, notBefore time.Time) bool {
+	if last, ok := sentAt[userID]; ok && !last.Before(notBefore) {
+		return false
+	}
+	sentAt[userID] = time.Now()
+	return true
+}
+
+func (f *fakeUserRepo) TouchVerificationSent(userID uuid.UUID, notBefore time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.touch(f.verificationSentAt, userID, notBefore), nil
+}
+
+func (f *fakeUserRepo) TouchPasswordResetSent(userID uuid.UUID, notBefore time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.touch(f.passwordResetSentAt, userID, notBefore), nil
+}
+
+type loginAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil *time.Time
+}
+
+// fakeLoginAttemptRepo counts failures per key within a window, like the
+// login_failures table.
+type fakeLoginAttemptRepo struct {
+	mu   sync.Mutex
+	keys map[string]*loginAttempts
+}
+
+func newFakeLoginAttemptRepo() *fakeLoginAttemptRepo {
+	return &fakeLoginAttemptRepo{keys: map[string]*loginAttempts{}}
+}
+
+func (f *fakeLoginAttemptRepo) get(key string) *loginAttempts {
+	attempts, ok := f.keys[key]
+	if !ok {
+		attempts = &loginAttempts{}
+		f.keys[key] = attempts
+	}
+	return attempts
+}
+
+func (f *fakeLoginAttemptRepo) RecordFailure(key string, window time.Duration) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempts := f.get(key)
+	if now := time.Now(); attempts.failures == 0 || now.Sub(attempts.windowStart) > window {
+		attempts.failures, attempts.windowStart = 0, now
+	}
+	attempts.failures++
+	return attempts.failures, nil
+}
+
+func (f *fakeLoginAttemptRepo) LockUntil(key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get(key).lockedUntil = &until
+	return nil
+}
+
+func (f *fakeLoginAttemptRepo) LockedUntil(key string) (*time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if attempts, ok := f.keys[key]; ok {
+		return attempts.lockedUntil, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeLoginAttemptRepo) Reset(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.keys, key)
+	return nil
+}
+
+// fakePasswordResetRepo keeps reset tokens in memory.
+type fakePasswordResetRepo struct {
+	mu     sync.Mutex
+	tokens []*entity.PasswordResetToken
+}
+
+func (f *fakePasswordResetRepo) Create(token *entity.PasswordResetToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *token
+	f.tokens = append(f.tokens, &copied)
+	return nil
+}
+
+func (f *fakePasswordResetRepo) GetByHash(tokenHash string) (*entity.PasswordResetToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && time.Now().Before(token.ExpiresAt) {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakePasswordResetRepo) MarkUsed(id uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.ID == id && token.UsedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakePasswordResetRepo) InvalidateForUser(userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, token := range f.tokens {
+		if token.UserID == userID && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// fakeMailer collects sent mails.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []service.Mail
+}
+
+func (f *fakeMailer) Send(mail service.Mail) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, mail)
+	return nil
+}
+
+func (f *fakeMailer) mails() []service.Mail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sent)
+}
+
+type fakeOAuthClientRepo struct {
+	mu      sync.Mutex
+	clients map[string]*entity.OAuthClient
+}
+
+func newFakeOAuthClientRepo(clients ...*entity.OAuthClient) *fakeOAuthClientRepo {
+	f := &fakeOAuthClientRepo{clients: map[string]*entity.OAuthClient{}}
+	for _, client := range clients {
+		f.clients[client.ID] = client
+	}
+	return f
+}
+
+func (f *fakeOAuthClientRepo) Create(client *entity.OAuthClient) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[client.ID]; ok {
+		return entity.ErrConflict
+	}
+	copied := *client
+	f.clients[client.ID] = &copied
+	return nil
+}
+
+func (f *fakeOAuthClientRepo) GetByID(clientID string) (*entity.OAuthClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	client, ok := f.clients[clientID]
+	if !ok {
+		return nil, entity.ErrNotFound
+	}
+	copied := *client
+	return &copied, nil
+}
+
+func (f *fakeOAuthClientRepo) List() ([]*entity.OAuthClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clients := make([]*entity.OAuthClient, 0, len(f.clients))
+	for _, client := range f.clients {
+		copied := *client
+		clients = append(clients, &copied)
+	}
+	return clients, nil
+}
+
+func (f *fakeOAuthClientRepo) Delete(clientID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[clientID]; !ok {
+		return entity.ErrNotFound
+	}
+	delete(f.clients, clientID)
+	return nil
+}
+
+type fakeRefreshTokenRepo struct {
+	mu     sync.Mutex
+	tokens []*entity.RefreshToken
+}
+
+func (f *fakeRefreshTokenRepo) Create(token *entity.RefreshToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *token
+	f.tokens = append(f.tokens, &copied)
+	return nil
+}
+
+func (f *fakeRefreshTokenRepo) GetByHash(tokenHash string) (*entity.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakeRefreshTokenRepo) MarkUsed(id uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.ID == id && token.UsedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRefreshTokenRepo) revoke(match func(token *entity.RefreshToken) bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, token := range f.tokens {
+		if match(token) && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+}
+
+func (f *fakeRefreshTokenRepo) RevokeFamily(familyID uuid.UUID) error {
+	f.revoke(func(token *entity.RefreshToken) bool { return token.FamilyID == familyID })
+	return nil
+}
+
+func (f *fakeRefreshTokenRepo) RevokeAllForUser(userID uuid.UUID) error {
+	f.revoke(func(token *entity.RefreshToken) bool { return token.UserID == userID })
+	return nil
+}
+
+type fakeSessionRepo struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*entity.Session
+}
+
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{sessions: map[uuid.UUID]*entity.Session{}}
+}
+
+func (f *fakeSessionRepo) Record(session *entity.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.sessions[session.ID]; ok {
+		existing.LastSeenAt, existing.IP, existing.UserAgent = session.LastSeenAt, session.IP, session.UserAgent
+		return nil
+	}
+	copied := *session
+	f.sessions[session.ID] = &copied
+	return nil
+}
+
+func (f *fakeSessionRepo) ListActiveByUser(userID uuid.UUID) ([]*entity.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var sessions []*entity.Session
+	for _, session := range f.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessionRepo) Revoke(userID, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[id]
+	if !ok || session.UserID != userID {
+		return entity.ErrNotFound
+	}
+	if session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (f *fakeSessionRepo) RevokeAllForUser(userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, session := range f.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type fakeMFARepo struct {
+	mu            sync.Mutex
+	enrollments   map[uuid.UUID]*entity.TOTPEnrollment
+	recoveryCodes map[uuid.UUID][]string
+}
+
+func newFakeMFARepo(enrollments ...*entity.TOTPEnrollment) *fakeMFARepo {
+	f := &fakeMFARepo{enrollments: map[uuid.UUID]*entity.TOTPEnrollment{}, recoveryCodes: map[uuid.UUID][]string{}}
+	for _, enrollment := range enrollments {
+		f.enrollments[enrollment.UserID] = enrollment
+	}
+	return f
+}
+
+func (f *fakeMFARepo) GetTOTP(userID uuid.UUID) (*entity.TOTPEnrollment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	enrollment, ok := f.enrollments[userID]
+	if !ok {
+		return nil, entity.ErrNotFound
+	}
+	copied := *enrollment
+	return &copied, nil
+}
+
+func (f *fakeMFARepo) SaveTOTP(enrollment *entity.TOTPEnrollment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.enrollments[enrollment.UserID]; ok && existing.Enabled {
+		return entity.ErrConflict
+	}
+	copied := *enrollment
+	f.enrollments[enrollment.UserID] = &copied
+	return nil
+}
+
+func (f *fakeMFARepo) EnableTOTP(userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	enrollment, ok := f.enrollments[userID]
+	if !ok {
+		return entity.ErrNotFound
+	}
+	now := time.Now()
+	enrollment.Enabled, enrollment.ConfirmedAt = true, &now
+	return nil
+}
+
+func (f *fakeMFARepo) DeleteTOTP(userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.enrollments, userID)
+	delete(f.recoveryCodes, userID)
+	return nil
+}
+
+func (f *fakeMFARepo) UseTOTPStep(userID uuid.UUID, step int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	enrollment, ok := f.enrollments[userID]
+	if !ok || enrollment.LastUsedStep >= step {
+		return false, nil
+	}
+	enrollment.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeMFARepo) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recoveryCodes[userID] = slices.Clone(codeHashes)
+	return nil
+}
+
+func (f *fakeMFARepo) UseRecoveryCode(userID uuid.UUID, codeHash string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	codes := f.recoveryCodes[userID]
+	idx := slices.Index(codes, codeHash)
+	if idx < 0 {
+		return false, nil
+	}
+	f.recoveryCodes[userID] = slices.Delete(codes, idx, idx+1)
+	return true, nil
+}
+
+type fakeAuthorizationCodeRepo struct {
+	mu    sync.Mutex
+	codes map[string]*entity.AuthorizationCode
+}
+
+func newFakeAuthorizationCodeRepo() *fakeAuthorizationCodeRepo {
+	return &fakeAuthorizationCodeRepo{codes: map[string]*entity.AuthorizationCode{}}
+}
+
+func (f *fakeAuthorizationCodeRepo) Create(code *entity.AuthorizationCode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *code
+	f.codes[code.CodeHash] = &copied
+	return nil
+}
+
+func (f *fakeAuthorizationCodeRepo) Consume(codeHash, clientID string) (*entity.AuthorizationCode, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	code, ok := f.codes[codeHash]
+	if !ok || code.ClientID != clientID {
+		return nil, false, entity.ErrNotFound
+	}
+	fresh := code.UsedAt == nil
+	if fresh {
+		now := time.Now()
+		code.UsedAt = &now
+	}
+	copied := *code
+	return &copied, fresh, nil
+}
+
+type fakeAPIKeyRepo struct {
+	mu   sync.Mutex
+	keys []*entity.APIKey
+}
+
+func (f *fakeAPIKeyRepo) Create(key *entity.APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *key
+	f.keys = append(f.keys, &copied)
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) GetByHash(keyHash string) (*entity.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range f.keys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, entity.ErrNotFound
+}
+
+func (f *fakeAPIKeyRepo) ListByUser(userID uuid.UUID) ([]*entity.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []*entity.APIKey
+	for _, key := range f.keys {
+		if key.UserID == userID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeAPIKeyRepo) Revoke(userID, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range f.keys {
+		if key.ID == id && key.UserID == userID {
+			if key.RevokedAt == nil {
+				now := time.Now()
+				key.RevokedAt = &now
+			}
+			return nil
+		}
+	}
+	return entity.ErrNotFound
+}
+
+func (f *fakeAPIKeyRepo) TouchLastUsed(id uuid.UUID, at, notBefore time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range f.keys {
+		if key.ID == id && (key.LastUsedAt == nil || key.LastUsedAt.Before(notBefore)) {
+			key.LastUsedAt = &at
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// percentPromo is a 25% code valid since an hour ago, adjusted by configure.
+func percentPromo(code string, configure func(p *entity.PromoCode)) *entity.PromoCode {
+	promo := &entity.PromoCode{
+		ID:        uuid.New(),
+		Code:      code,
+		Kind:      entity.PromoPercent,
+		Percent:   25,
+		ValidFrom: time.Now().Add(-time.Hour),
+	}
+	if configure != nil {
+		configure(promo)
+	}
+	return promo
+}
+
+func TestQuoteReportPromoCode(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	tests := []struct {
+		name         string
+		promo        *entity.PromoCode
+		code         string
+		currency     string
+		redeemed     int // by other users
+		redeemedByMe int
+		wantTotal    entity.Money
+		wantDiscount int64
+		wantErr      error
+	}{
+		{name: "percent", promo: percentPromo("SPRING25", nil), code: "SPRING25",
+			wantTotal: rub(7500), wantDiscount: 2500},
+		{name: "code is case insensitive", promo: percentPromo("SPRING25", nil), code: " spring25 ",
+			wantTotal: rub(7500), wantDiscount: 2500},
+		{name: "fixed", promo: percentPromo("MINUS30", func(p *entity.PromoCode) {
+			p.Kind, p.Amount = entity.PromoFixed, &entity.Money{Amount: 3000, Currency: "RUB"}
+		}), code: "MINUS30", wantTotal: rub(7000), wantDiscount: 3000},
+		{name: "fixed above price", promo: percentPromo("FREE", func(p *entity.PromoCode) {
+			p.Kind, p.Amount = entity.PromoFixed, &entity.Money{Amount: 20000, Currency: "RUB"}
+		}), code: "FREE", wantTotal: rub(0), wantDiscount: 10000},
+		{name: "discount before conversion", promo: percentPromo("SPRING25", nil), code: "SPRING25", currency: "USD",
+			wantTotal: entity.Money{Amount: 81, Currency: "USD"}, wantDiscount: 2500},
+		{name: "matching category", promo: percentPromo("FIN", func(p *entity.PromoCode) { p.Categories = []string{"finance"} }),
+			code: "FIN", wantTotal: rub(7500), wantDiscount: 2500},
+		{name: "under limits", promo: percentPromo("LIMITED", func(p *entity.PromoCode) { p.MaxRedemptions, p.PerUserLimit = 3, 2 }),
+			code: "LIMITED", redeemed: 1, redeemedByMe: 1, wantTotal: rub(7500), wantDiscount: 2500},
+
+		{name: "unknown code", promo: percentPromo("SPRING25", nil), code: "WINTER", wantErr: ErrInvalidPromoCode},
+		{name: "fixed in other currency", promo: percentPromo("USD5", func(p *entity.PromoCode) {
+			p.Kind, p.Amount = entity.PromoFixed, &entity.Money{Amount: 500, Currency: "USD"}
+		}), code: "USD5", wantErr: ErrInvalidPromoCode},
+		{name: "expired", promo: percentPromo("OLD", func(p *entity.PromoCode) { p.ValidUntil = &past }),
+			code: "OLD", wantErr: ErrInvalidPromoCode},
+		{name: "not started", promo: percentPromo("SOON", func(p *entity.PromoCode) { p.ValidFrom = future }),
+			code: "SOON", wantErr: ErrInvalidPromoCode},
+		{name: "other category", promo: percentPromo("LEGAL", func(p *entity.PromoCode) { p.Categories = []string{"legal"} }),
+			code: "LEGAL", wantErr: ErrInvalidPromoCode},
+		{name: "used up", promo: percentPromo("ONCE", func(p *entity.PromoCode) { p.MaxRedemptions = 2 }),
+			code: "ONCE", redeemed: 2, wantErr: ErrInvalidPromoCode},
+		{name: "used up by the user", promo: percentPromo("MINE", func(p *entity.PromoCode) { p.PerUserLimit = 1 }),
+			code: "MINE", redeemed: 5, redeemedByMe: 1, wantErr: ErrInvalidPromoCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buyer := uuid.New()
+			reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(10000), Category: "finance"})
+			promos := newFakePromoRepo(tt.promo)
+			for i := 0; i < tt.redeemed; i++ {
+				promos.redemptions = append(promos.redemptions, promoRedemption{tt.promo.ID, uuid.New(), uuid.New()})
+			}
+			for i := 0; i < tt.redeemedByMe; i++ {
+				promos.redemptions = append(promos.redemptions, promoRedemption{tt.promo.ID, buyer, uuid.New()})
+			}
+			rates := newFakeRates(map[string]string{"RUB/USD": "0.0108"})
+			uc := NewReportUsecase(reports, nil, newFakeWalletRepo(), promos, rates, rub(10000))
+
+			quote, err := uc.QuoteReport(buyer, "r1", PurchaseOptions{Currency: tt.currency, PromoCode: tt.code})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("QuoteReport error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if quote.Total != tt.wantTotal {
+				t.Errorf("total = %v, want %v", quote.Total, tt.wantTotal)
+			}
+			if quote.Price != rub(10000) || quote.PromoCode != tt.promo.Code {
+				t.Errorf("quote = %v with %q, want 100.00 RUB with %q", quote.Price, quote.PromoCode, tt.promo.Code)
+			}
+			if quote.Discount == nil || *quote.Discount != rub(tt.wantDiscount) {
+				t.Errorf("discount = %v, want %d RUB minor units", quote.Discount, tt.wantDiscount)
+			}
+		})
+	}
+}
+
+func TestPurchaseReportWithPromoCode(t *testing.T) {
+	buyer := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(10000)})
+	promo := percentPromo("SPRING25", func(p *entity.PromoCode) { p.MaxRedemptions = 1 })
+	promos := newFakePromoRepo(promo)
+	wallets := newFakeWalletRepo()
+	wallets.promos = promos
+	wallets.deposit(buyer, rub(10000))
+	uc := NewReportUsecase(reports, nil, wallets, promos, newFakeRates(nil), rub(10000))
+
+	purchase, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{PromoCode: "spring25"})
+	if err != nil {
+		t.Fatalf("PurchaseReport: %v", err)
+	}
+	if purchase.Amount != rub(7500) || purchase.PromoCode != "SPRING25" || purchase.Discount == nil || *purchase.Discount != rub(2500) {
+		t.Errorf("purchase = %v with %q, discount %v, want 75.00 RUB with SPRING25, discount 25.00", purchase.Amount, purchase.PromoCode, purchase.Discount)
+	}
+	if balance := wallets.balance(buyer, "RUB"); balance != 2500 {
+		t.Errorf("balance = %d, want 2500", balance)
+	}
+	if n := promos.redemptionCount(promo.ID); n != 1 {
+		t.Errorf("redemptions = %d, want 1", n)
+	}
+
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{PromoCode: "SPRING25"}); !errors.Is(err, ErrAlreadyPurchased) {
+		t.Errorf("second purchase error = %v, want ErrAlreadyPurchased", err)
+	}
+}
+
+func TestRefundReleasesPromoCode(t *testing.T) {
+	buyer := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(10000)})
+	promo := percentPromo("SPRING25", func(p *entity.PromoCode) { p.MaxRedemptions = 1 })
+	promos := newFakePromoRepo(promo)
+	wallets := newFakeWalletRepo()
+	wallets.promos = promos
+	wallets.deposit(buyer, rub(7500))
+	uc := NewReportUsecase(reports, nil, wallets, promos, newFakeRates(nil), rub(10000))
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{PromoCode: "SPRING25"}); err != nil {
+		t.Fatalf("PurchaseReport: %v", err)
+	}
+
+	refund, err := uc.RefundReport(uuid.New(), "r1", "wrong report")
+	if err != nil {
+		t.Fatalf("RefundReport: %v", err)
+	}
+	// the discounted amount comes back, and the code with it
+	if refund.Amount != rub(7500) {
+		t.Errorf("refunded %s, want 75.00 RUB", refund.Amount)
+	}
+	if n := promos.redemptionCount(promo.ID); n != 0 {
+		t.Errorf("redemptions after refund = %d, want 0", n)
+	}
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{PromoCode: "SPRING25"}); err != nil {
+		t.Errorf("purchase with the released code: %v", err)
+	}
+}
+
+func TestFailedPurchaseReleasesPromoCode(t *testing.T) {
+	buyer := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(10000)})
+	reports.purchaseErr = entity.ErrNotFound
+	promo := percentPromo("SPRING25", func(p *entity.PromoCode) { p.MaxRedemptions = 1 })
+	promos := newFakePromoRepo(promo)
+	wallets := newFakeWalletRepo()
+	wallets.promos = promos
+	wallets.deposit(buyer, rub(10000))
+	uc := NewReportUsecase(reports, nil, wallets, promos, newFakeRates(nil), rub(10000))
+
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{PromoCode: "SPRING25"}); !errors.Is(err, entity.ErrNotFound) {
+		t.Fatalf("PurchaseReport error = %v, want ErrNotFound", err)
+	}
+	if n := promos.redemptionCount(promo.ID); n != 0 {
+		t.Errorf("redemptions = %d, want the failed one released", n)
+	}
+	if balance := wallets.balance(buyer, "RUB"); balance != 10000 {
+		t.Errorf("balance = %d, want 10000 back", balance)
+	}
+}
+
+func TestPurchaseReportPromoCodeUsedUpConcurrently(t *testing.T) {
+	buyer := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(10000)})
+	promos := newFakePromoRepo(percentPromo("ONCE", func(p *entity.PromoCode) { p.PerUserLimit = 1 }))
+	wallets := newFakeWalletRepo()
+	wallets.promos = promos
+	wallets.deposit(buyer, rub(10000))
+	// the quote passed, but another purchase redeemed the code before the
+	// purchase transaction ran
+	wallets.startErr = entity.ErrPromoCodeUnavailable
+	uc := NewReportUsecase(reports, nil, wallets, promos, newFakeRates(nil), rub(10000))
+
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{PromoCode: "ONCE"}); !errors.Is(err, ErrInvalidPromoCode) {
+		t.Fatalf("PurchaseReport error = %v, want ErrInvalidPromoCode", err)
+	}
+	if balance := wallets.balance(buyer, "RUB"); balance != 10000 {
+		t.Errorf("balance = %d, want unchanged", balance)
+	}
+}
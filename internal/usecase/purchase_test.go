@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPurchaseReportDebitsOnce(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+	wallets := newFakeWalletRepo()
+	wallets.deposit(owner, rub(15000))
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(10000))
+
+	purchase, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{})
+	if err != nil {
+		t.Fatalf("PurchaseReport: %v", err)
+	}
+	if purchase.Status != entity.PurchaseCompleted || purchase.Amount != rub(10000) {
+		t.Errorf("purchase = %s %v, want completed 100.00 RUB", purchase.Status, purchase.Amount)
+	}
+	if !reports.isPurchased("r1") {
+		t.Error("report is not marked purchased")
+	}
+
+	if _, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{}); !errors.Is(err, ErrAlreadyPurchased) {
+		t.Errorf("second purchase error = %v, want ErrAlreadyPurchased", err)
+	}
+	if balance := wallets.balance(owner, "RUB"); balance != 5000 {
+		t.Errorf("balance = %d, want 5000", balance)
+	}
+}
+
+func TestPurchaseReportRejected(t *testing.T) {
+	owner := uuid.New()
+	tests := []struct {
+		name    string
+		buyer   uuid.UUID
+		report  string
+		balance int64
+		wantErr error
+	}{
+		{"insufficient funds", owner, "r1", 9999, entity.ErrInsufficientFunds},
+		{"no wallet yet", owner, "r1", 0, entity.ErrInsufficientFunds},
+		{"someone else's report", uuid.New(), "r1", 50000, entity.ErrNotFound},
+		{"unknown report", owner, "missing", 50000, entity.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+			wallets := newFakeWalletRepo()
+			if tt.balance > 0 {
+				wallets.deposit(tt.buyer, rub(tt.balance))
+			}
+			uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(10000))
+
+			if _, err := uc.PurchaseReport(tt.buyer, tt.report, PurchaseOptions{}); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PurchaseReport error = %v, want %v", err, tt.wantErr)
+			}
+			if balance := wallets.balance(tt.buyer, "RUB"); balance != tt.balance {
+				t.Errorf("balance = %d, want unchanged %d", balance, tt.balance)
+			}
+			if reports.isPurchased("r1") {
+				t.Error("report is marked purchased")
+			}
+		})
+	}
+}
+
+func TestPurchaseReportInAnotherCurrency(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+	wallets := newFakeWalletRepo()
+	wallets.deposit(owner, entity.Money{Amount: 500, Currency: "USD"})
+	wallets.deposit(owner, rub(100))
+	rates := newFakeRates(map[string]string{"RUB/USD": "0.010811"})
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), rates, rub(10000))
+
+	purchase, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{Currency: "USD"})
+	if err != nil {
+		t.Fatalf("PurchaseReport: %v", err)
+	}
+	// 100 RUB * 0.010811 = 1.0811 USD, rounded to the cent
+	if want := (entity.Money{Amount: 108, Currency: "USD"}); purchase.Amount != want {
+		t.Errorf("charged %s, want %s", purchase.Amount, want)
+	}
+	if purchase.Exchange == nil || purchase.Exchange.Rate != "0.010811" || purchase.Exchange.Original != rub(10000) {
+		t.Errorf("exchange = %+v, want 0.010811 from 100.00 RUB", purchase.Exchange)
+	}
+	if usd, rubles := wallets.balance(owner, "USD"), wallets.balance(owner, "RUB"); usd != 392 || rubles != 100 {
+		t.Errorf("balances = %d USD, %d RUB, want 392 and the rubles untouched", usd, rubles)
+	}
+	debit := wallets.ledger[len(wallets.ledger)-1]
+	if debit.Exchange == nil || debit.Exchange.Original != rub(10000) {
+		t.Errorf("debit exchange = %+v, want the original price kept", debit.Exchange)
+	}
+}
+
+func TestPurchaseReportInUnavailableCurrency(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+	wallets := newFakeWalletRepo()
+	wallets.deposit(owner, entity.Money{Amount: 50000, Currency: "EUR"})
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(10000))
+
+	var validationErr *ValidationError
+	if _, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{Currency: "EUR"}); !errors.As(err, &validationErr) || validationErr.Field != "currency" {
+		t.Fatalf("PurchaseReport error = %v, want a currency validation error", err)
+	}
+	if balance := wallets.balance(owner, "EUR"); balance != 50000 {
+		t.Errorf("balance = %d, want untouched", balance)
+	}
+}
+
+func TestPurchaseReportInvalidCurrencyNotQuoted(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+	rates := newFakeRates(nil)
+	uc := NewReportUsecase(reports, nil, newFakeWalletRepo(), newFakePromoRepo(), rates, rub(10000))
+
+	for _, currency := range []string{"usd", "XYZ", "RUB/USD"} {
+		var validationErr *ValidationError
+		if _, err := uc.QuoteReport(owner, "r1", PurchaseOptions{Currency: currency}); !errors.As(err, &validationErr) || validationErr.Field != "currency" {
+			t.Errorf("QuoteReport(%q) error = %v, want a currency validation error", currency, err)
+		}
+	}
+	if len(rates.asked) != 0 {
+		t.Errorf("rate provider was asked for %v", rates.asked)
+	}
+}
+
+func TestResumePendingPurchases(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+	reports.purchaseErr = errors.New("mongo is down")
+	wallets := newFakeWalletRepo()
+	wallets.deposit(owner, rub(10000))
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(10000))
+
+	if _, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{}); !errors.Is(err, ErrPurchasePending) {
+		t.Fatalf("PurchaseReport error = %v, want ErrPurchasePending", err)
+	}
+	// the money is taken once, a retry meets the pending purchase
+	if _, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{}); !errors.Is(err, ErrAlreadyPurchased) {
+		t.Errorf("retry while pending error = %v, want ErrAlreadyPurchased", err)
+	}
+
+	// too recent, may still be in flight
+	if err := uc.ResumePendingPurchases(time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("ResumePendingPurchases: %v", err)
+	}
+	if got := wallets.purchaseStatuses(); !slices.Equal(got, []string{entity.PurchasePending}) {
+		t.Fatalf("statuses = %v, want the purchase left pending", got)
+	}
+
+	reports.purchaseErr = nil
+	if err := uc.ResumePendingPurchases(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("ResumePendingPurchases: %v", err)
+	}
+	if got := wallets.purchaseStatuses(); !slices.Equal(got, []string{entity.PurchaseCompleted}) {
+		t.Errorf("statuses = %v, want completed", got)
+	}
+	if !reports.isPurchased("r1") {
+		t.Error("report is not marked purchased after resume")
+	}
+	if balance := wallets.balance(owner, "RUB"); balance != 0 {
+		t.Errorf("balance = %d, want 0", balance)
+	}
+}
+
+func TestPurchaseOfDeletedReportIsReversed(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(10000)})
+	// deleted between the lookup and marking it purchased
+	reports.purchaseErr = entity.ErrNotFound
+	wallets := newFakeWalletRepo()
+	wallets.deposit(owner, rub(10000))
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(10000))
+
+	if _, err := uc.PurchaseReport(owner, "r1", PurchaseOptions{}); !errors.Is(err, entity.ErrNotFound) {
+		t.Fatalf("PurchaseReport error = %v, want ErrNotFound", err)
+	}
+	if balance := wallets.balance(owner, "RUB"); balance != 10000 {
+		t.Errorf("balance = %d, want 10000 back", balance)
+	}
+	if got := wallets.purchaseStatuses(); !slices.Equal(got, []string{entity.PurchaseFailed}) {
+		t.Errorf("statuses = %v, want failed", got)
+	}
+}
@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"auth/internal/service"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// spendRefreshToken is the rotation step shared by our own sessions and OAuth
+// clients: the presented token is marked used and returned so the caller can
+// issue the next one in the same family. Presenting a spent token again revokes
+// the whole family; the spent token is returned with ErrRefreshTokenReused so
+// the caller can clean up after it. clientID must match the client the token
+// was issued to, "" for our own sessions.
+func spendRefreshToken(repo entity.RefreshTokenRepository, refreshToken, clientID string) (*entity.RefreshToken, error) {
+	stored, err := repo.GetByHash(service.HashToken(refreshToken))
+	if errors.Is(err, entity.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		return stored, revokeReusedFamily(repo, stored.FamilyID)
+	}
+
+	fresh, err := repo.MarkUsed(stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		// another request rotated this token concurrently
+		return stored, revokeReusedFamily(repo, stored.FamilyID)
+	}
+	return stored, nil
+}
+
+func revokeReusedFamily(repo entity.RefreshTokenRepository, familyID uuid.UUID) error {
+	if err := repo.RevokeFamily(familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return ErrRefreshTokenReused
+}
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRefundReport(t *testing.T) {
+	buyer, support := uuid.New(), uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(4000)})
+	wallets := newFakeWalletRepo()
+	wallets.deposit(buyer, rub(4000))
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(4000))
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{}); err != nil {
+		t.Fatalf("PurchaseReport: %v", err)
+	}
+
+	refund, err := uc.RefundReport(support, "r1", "  charged twice  ")
+	if err != nil {
+		t.Fatalf("RefundReport: %v", err)
+	}
+	if refund.UserID != buyer || refund.Amount != rub(4000) || refund.Reason != "charged twice" || refund.ActorID != support {
+		t.Errorf("refund = %+v", refund)
+	}
+	if balance := wallets.balance(buyer, "RUB"); balance != 4000 {
+		t.Errorf("balance = %d, want 4000 back", balance)
+	}
+	report, _ := reports.GetReport("r1")
+	if report.Is_purchased || len(report.Refunds) != 1 {
+		t.Errorf("report purchased = %v with %d refunds, want not purchased with 1", report.Is_purchased, len(report.Refunds))
+	}
+
+	if _, err := uc.RefundReport(support, "r1", "again"); !errors.Is(err, ErrAlreadyRefunded) {
+		t.Errorf("second refund error = %v, want ErrAlreadyRefunded", err)
+	}
+	// the report can be bought again after a refund
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{}); err != nil {
+		t.Errorf("purchase after refund: %v", err)
+	}
+}
+
+func TestRefundReportRejected(t *testing.T) {
+	owner := uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: owner.String(), Price: rub(4000)})
+	uc := NewReportUsecase(reports, nil, newFakeWalletRepo(), newFakePromoRepo(), newFakeRates(nil), rub(4000))
+
+	var validationErr *ValidationError
+	if _, err := uc.RefundReport(uuid.New(), "r1", "   "); !errors.As(err, &validationErr) {
+		t.Errorf("blank reason error = %v, want a validation error", err)
+	}
+	if _, err := uc.RefundReport(uuid.New(), "r1", "never bought"); !errors.Is(err, entity.ErrNotFound) {
+		t.Errorf("unpurchased report error = %v, want ErrNotFound", err)
+	}
+	if _, err := uc.RefundReport(uuid.New(), "missing", "no report"); !errors.Is(err, entity.ErrNotFound) {
+		t.Errorf("unknown report error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRefundReportFinishesInterruptedRefund(t *testing.T) {
+	buyer, support := uuid.New(), uuid.New()
+	reports := newFakeReportRepo(&entity.Report{Report_id: "r1", User_id: buyer.String(), Price: rub(4000)})
+	wallets := newFakeWalletRepo()
+	wallets.deposit(buyer, rub(4000))
+	uc := NewReportUsecase(reports, nil, wallets, newFakePromoRepo(), newFakeRates(nil), rub(4000))
+	if _, err := uc.PurchaseReport(buyer, "r1", PurchaseOptions{}); err != nil {
+		t.Fatalf("PurchaseReport: %v", err)
+	}
+
+	reports.refundErr = errors.New("mongo is down")
+	if _, err := uc.RefundReport(support, "r1", "charged twice"); err == nil {
+		t.Fatal("RefundReport succeeded while the report could not be updated")
+	}
+	reports.refundErr = nil
+
+	refund, err := uc.RefundReport(support, "r1", "charged twice")
+	if err != nil {
+		t.Fatalf("retried RefundReport: %v", err)
+	}
+	if last, _ := wallets.LastRefund("r1"); len(wallets.refunds) != 1 || last.ID != refund.ID {
+		t.Errorf("retry recorded a new refund, %d refunds", len(wallets.refunds))
+	}
+	if balance := wallets.balance(buyer, "RUB"); balance != 4000 {
+		t.Errorf("balance = %d, want credited once", balance)
+	}
+	if reports.isPurchased("r1") {
+		t.Error("report still purchased after the retry")
+	}
+}
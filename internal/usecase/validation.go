@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// ValidationError is returned for bad user input, handlers map it to 400.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores the rest
+)
+
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return &ValidationError{Field: "username", Message: "must be 3-32 characters of letters, digits, '_', '.' or '-'"}
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return &ValidationError{Field: "email", Message: "must be a valid email address"}
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return &ValidationError{Field: "password", Message: fmt.Sprintf("must be %d-%d characters long", minPasswordLength, maxPasswordLength)}
+	}
+	return nil
+}
+
+var clientGeneratedIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{8,64}$`)
+
+var categoryPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+const maxReportDescriptionLength = 10000
+
+// validateNewReport requires a client_generated_id from anonymous clients, it
+// is how their reports are claimed after they sign up.
+func validateNewReport(userID uuid.UUID, req NewReport) error {
+	if req.ClientGeneratedID == "" {
+		if userID == uuid.Nil {
+			return &ValidationError{Field: "client_generated_id", Message: "is required for anonymous reports"}
+		}
+	} else if !clientGeneratedIDPattern.MatchString(req.ClientGeneratedID) {
+		return &ValidationError{Field: "client_generated_id", Message: "must be 8-64 characters of letters, digits, '_' or '-'"}
+	}
+
+	description := strings.TrimSpace(req.Description)
+	if description == "" || utf8.RuneCountInString(description) > maxReportDescriptionLength {
+		return &ValidationError{Field: "description", Message: fmt.Sprintf("must be 1-%d characters long", maxReportDescriptionLength)}
+	}
+
+	if req.Category != "" && !categoryPattern.MatchString(req.Category) {
+		return &ValidationError{Field: "category", Message: "must be 1-32 characters of lower case letters, digits, '_' or '-'"}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+-- key is "user:<username>" or "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_failures (
+    key             TEXT PRIMARY KEY,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failed_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ
+);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id         UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret          TEXT NOT NULL,
+    enabled         BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    confirmed_at    TIMESTAMPTZ,
+    last_used_step  BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id          UUID PRIMARY KEY,
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash   TEXT NOT NULL,
+    used_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id_idx ON mfa_recovery_codes (user_id);
+
+-- how the session was authenticated, carried over on refresh
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{pwd}';
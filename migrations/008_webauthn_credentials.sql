@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id                  UUID PRIMARY KEY,
+    user_id             UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credential_id       BYTEA NOT NULL UNIQUE,
+    public_key          BYTEA NOT NULL,
+    attestation_type    TEXT NOT NULL DEFAULT '',
+    transports          TEXT[] NOT NULL DEFAULT '{}',
+    aaguid              BYTEA,
+    sign_count          BIGINT NOT NULL DEFAULT 0,
+    backup_eligible     BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state        BOOLEAN NOT NULL DEFAULT FALSE,
+    name                TEXT NOT NULL DEFAULT '',
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at        TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
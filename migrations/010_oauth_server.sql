@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id              TEXT PRIMARY KEY,
+    secret_hash     TEXT NOT NULL DEFAULT '', -- empty for public clients
+    name            TEXT NOT NULL,
+    redirect_uris   TEXT[] NOT NULL DEFAULT '{}',
+    grant_types     TEXT[] NOT NULL DEFAULT '{}',
+    scopes          TEXT[] NOT NULL DEFAULT '{}',
+    trusted         BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    code_hash       TEXT PRIMARY KEY,
+    client_id       TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family_id       UUID NOT NULL,
+    redirect_uri    TEXT NOT NULL,
+    scopes          TEXT[] NOT NULL DEFAULT '{}',
+    nonce           TEXT NOT NULL DEFAULT '',
+    code_challenge  TEXT NOT NULL DEFAULT '',
+    amr             TEXT[] NOT NULL DEFAULT '{}',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    used_at         TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id   TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scopes      TEXT[] NOT NULL DEFAULT '{}',
+    granted_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- refresh tokens issued to OAuth clients; empty client_id is our own session
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,6 @@
+-- anonymous reports are claimed by client_generated_id, only once
+CREATE TABLE IF NOT EXISTS report_claims (
+    client_generated_id TEXT PRIMARY KEY,
+    user_id             UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    claimed_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS wallets (
+    user_id     UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    balance     NUMERIC(18, 2) NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- append-only, mistakes are corrected by compensating entries
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+    id              UUID PRIMARY KEY,
+    user_id         UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    amount          NUMERIC(18, 2) NOT NULL, -- negative for debits
+    balance_after   NUMERIC(18, 2) NOT NULL,
+    kind            TEXT NOT NULL,
+    reference       TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS wallet_transactions_user_id_idx ON wallet_transactions (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS report_purchases (
+    id              UUID PRIMARY KEY,
+    user_id         UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    report_id       TEXT NOT NULL,
+    amount          NUMERIC(18, 2) NOT NULL,
+    transaction_id  UUID NOT NULL,
+    status          TEXT NOT NULL, -- pending | completed | failed
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- a report is bought at most once, failed attempts do not count
+CREATE UNIQUE INDEX IF NOT EXISTS report_purchases_report_id_idx ON report_purchases (report_id) WHERE status <> 'failed';
+CREATE INDEX IF NOT EXISTS report_purchases_pending_idx ON report_purchases (created_at) WHERE status = 'pending';
+
+-- balances left by users.balance become opening entries of the ledger
+INSERT INTO wallets (user_id, balance)
+SELECT id, balance FROM users WHERE balance > 0
+ON CONFLICT (user_id) DO NOTHING;
+
+INSERT INTO wallet_transactions (id, user_id, amount, balance_after, kind)
+SELECT gen_random_uuid(), w.user_id, w.balance, w.balance, 'opening_balance'
+FROM wallets w
+WHERE NOT EXISTS (SELECT 1 FROM wallet_transactions t WHERE t.user_id = w.user_id);
+
+ALTER TABLE users DROP COLUMN IF EXISTS balance;
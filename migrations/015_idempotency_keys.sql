@@ -0,0 +1,14 @@
+-- responses of requests sent with an Idempotency-Key, replayed to retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope           TEXT NOT NULL, -- user ID, 'anonymous:<fingerprint>' for anonymous requests
+    key             TEXT NOT NULL,
+    fingerprint     TEXT NOT NULL,
+    status_code     INTEGER NOT NULL DEFAULT 0, -- 0 while the request is running
+    content_type    TEXT NOT NULL DEFAULT '',
+    body            BYTEA,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS payment_intents (
+    id          UUID PRIMARY KEY,
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    amount      NUMERIC(18, 2) NOT NULL CHECK (amount > 0),
+    provider    TEXT NOT NULL,
+    reference   TEXT NOT NULL DEFAULT '', -- payment ID at the provider
+    status      TEXT NOT NULL, -- pending | succeeded | failed
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS payment_intents_reference_idx ON payment_intents (provider, reference) WHERE reference <> '';
+CREATE INDEX IF NOT EXISTS payment_intents_user_id_idx ON payment_intents (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS report_refunds (
+    id              UUID PRIMARY KEY,
+    purchase_id     UUID NOT NULL UNIQUE REFERENCES report_purchases (id), -- one refund per purchase
+    report_id       TEXT NOT NULL,
+    user_id         UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    amount          NUMERIC(18, 2) NOT NULL,
+    reason          TEXT NOT NULL,
+    actor_id        UUID NOT NULL, -- admin or support user who refunded, kept if they are deleted
+    transaction_id  UUID NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS report_refunds_report_id_idx ON report_refunds (report_id, created_at DESC);
+
+-- a refunded report can be bought again
+DROP INDEX IF EXISTS report_purchases_report_id_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS report_purchases_active_report_id_idx ON report_purchases (report_id) WHERE status IN ('pending', 'completed');
@@ -0,0 +1,39 @@
+-- amounts become integer minor units plus an ISO 4217 currency code. Everything
+-- stored so far is in RUB (the default reports.currency) with 2 decimal places.
+-- Guarded, so running the file again does not multiply the amounts twice.
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'wallets' AND column_name = 'balance') = 'numeric' THEN
+
+        ALTER TABLE wallets
+            ALTER COLUMN balance DROP DEFAULT,
+            ALTER COLUMN balance TYPE BIGINT USING ROUND(balance * 100)::BIGINT,
+            ALTER COLUMN balance SET DEFAULT 0,
+            ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+
+        ALTER TABLE wallet_transactions
+            ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT,
+            ALTER COLUMN balance_after TYPE BIGINT USING ROUND(balance_after * 100)::BIGINT,
+            ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+
+        ALTER TABLE report_purchases
+            ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT,
+            ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+
+        ALTER TABLE payment_intents
+            ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT,
+            ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+
+        ALTER TABLE report_refunds
+            ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT,
+            ADD COLUMN currency TEXT NOT NULL DEFAULT 'RUB';
+    END IF;
+END $$;
+
+-- new rows always name their currency
+ALTER TABLE wallets ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE wallet_transactions ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE report_purchases ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE payment_intents ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE report_refunds ALTER COLUMN currency DROP DEFAULT;
@@ -0,0 +1,10 @@
+-- a wallet per currency
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_pkey;
+ALTER TABLE wallets ADD PRIMARY KEY (user_id, currency);
+
+-- set when the amount was converted from another currency, e.g. a report
+-- priced in USD paid from the RUB wallet
+ALTER TABLE wallet_transactions
+    ADD COLUMN IF NOT EXISTS exchange_rate TEXT, -- units of currency per unit of original_currency
+    ADD COLUMN IF NOT EXISTS original_amount BIGINT,
+    ADD COLUMN IF NOT EXISTS original_currency TEXT;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id              UUID PRIMARY KEY,
+    code            TEXT NOT NULL UNIQUE, -- upper case
+    kind            TEXT NOT NULL, -- percent | fixed
+    percent         INTEGER NOT NULL DEFAULT 0,
+    amount          BIGINT, -- fixed codes only, in minor units of currency
+    currency        TEXT,
+    categories      TEXT[] NOT NULL DEFAULT '{}', -- empty: every category
+    valid_from      TIMESTAMPTZ NOT NULL,
+    valid_until     TIMESTAMPTZ,
+    max_redemptions INTEGER NOT NULL DEFAULT 0, -- 0: unlimited
+    per_user_limit  INTEGER NOT NULL DEFAULT 0, -- 0: unlimited
+    redemptions     INTEGER NOT NULL DEFAULT 0,
+    created_by      UUID NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- written in the same transaction as the purchase it discounts
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id              UUID PRIMARY KEY,
+    promo_code_id   UUID NOT NULL REFERENCES promo_codes (id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purchase_id     UUID NOT NULL UNIQUE REFERENCES report_purchases (id),
+    discount        BIGINT NOT NULL,
+    currency        TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS promo_redemptions_user_idx ON promo_redemptions (promo_code_id, user_id);
@@ -0,0 +1,4 @@
+-- whether redirect_uri was sent to /authorize; if it was, the token request
+-- must repeat it (RFC 6749 4.1.3). Codes issued before are treated as if it was.
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN IF NOT EXISTS redirect_uri_explicit BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,24 @@
+-- an address belongs to one account, so lookups by email are unambiguous.
+-- Which of several accounts keeps a shared address is not decided here: the
+-- migration stops and lists the duplicates, an operator resolves them (see
+-- README) and runs it again.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(address || ': ' || ids, E'\n' ORDER BY address) INTO duplicates
+    FROM (
+        SELECT lower(email) AS address, string_agg(id::TEXT, ', ' ORDER BY created_at) AS ids
+        FROM users
+        WHERE email <> ''
+        GROUP BY lower(email)
+        HAVING COUNT(*) > 1
+    ) shared;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'accounts share email addresses, give each one its own before adding users_lower_email_key'
+            USING DETAIL = duplicates;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_lower_email_key ON users (lower(email)) WHERE email <> '';
@@ -0,0 +1,4 @@
+-- Set-Cookie headers of responses that sign the client in (/register), so a
+-- replayed response signs the client in as well. Pruned with the key.
+ALTER TABLE idempotency_keys
+    ADD COLUMN IF NOT EXISTS cookies TEXT[];
@@ -26,8 +26,63 @@ toggleLink.addEventListener('click', () => {
 	}
 })
 
+// После входа возвращаемся туда, откуда пришли (например, на /authorize
+// приложения, входящего через нас), иначе — на upload
+async function afterLogin() {
+	await claimAnonymousReports()
+
+	const returnTo = new URLSearchParams(window.location.search).get('return_to')
+	// только пути этого сервера, иначе это открытый редирект
+	if (returnTo && returnTo.startsWith('/') && !returnTo.startsWith('//') && !returnTo.startsWith('/\\')) {
+		window.location.href = returnTo
+		return
+	}
+	window.location.href = 'http://192.168.209.1:8085'
+}
+
+// Отчёты, созданные до входа, привязываем к аккаунту. ID берётся из куки
+// upload-клиента; ошибка не мешает входу
+async function claimAnonymousReports() {
+	try {
+		await fetch('http://192.168.209.1:8083/api/reports/claim', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: '{}',
+			credentials: 'include',
+		})
+	} catch (err) {
+		console.error('Не удалось привязать анонимные отчёты:', err)
+	}
+}
+
 // При загрузке страницы проверяем JWT по куке
 window.addEventListener('DOMContentLoaded', async () => {
+	// возврат по ссылке подтверждения email
+	const params = new URLSearchParams(window.location.search)
+	const verified = params.get('email_verified')
+	if (verified === 'true') {
+		alert('Email подтверждён')
+	} else if (verified === 'false') {
+		alert('Ссылка подтверждения недействительна или устарела')
+	}
+
+	// возврат от внешнего провайдера входа
+	const oauthError = params.get('oauth_error')
+	if (oauthError === 'account_exists') {
+		alert('Аккаунт с этим email уже есть — войдите по паролю')
+	} else if (oauthError === 'email_required') {
+		alert('Провайдер не передал email')
+	} else if (oauthError) {
+		alert('Ошибка входа через внешний сервис')
+	}
+	const mfaToken = params.get('mfa_token')
+	if (mfaToken) {
+		history.replaceState(null, '', '/')
+		await completeMfaLogin(mfaToken)
+	}
+
+	loadOAuthProviders()
+
 	console.log('Проверка авторизации запускается...')
 	try {
 		const res = await fetch('http://192.168.209.1:8083/api/check', {
@@ -36,7 +91,18 @@ window.addEventListener('DOMContentLoaded', async () => {
 
 		if (res.ok) {
 			console.log('Авторизация успешна. Переход на upload...')
-			window.location.href = 'http://192.168.209.1:8085'
+			afterLogin()
+			return
+		}
+
+		// access токен истёк — пробуем обновить по refresh куке
+		const refreshRes = await fetch('http://192.168.209.1:8083/refresh', {
+			method: 'POST',
+			credentials: 'include',
+		})
+		if (refreshRes.ok) {
+			console.log('Токен обновлён. Переход на upload...')
+			afterLogin()
 		} else {
 			console.log('Авторизация не пройдена.')
 		}
@@ -68,7 +134,11 @@ authForm.addEventListener('submit', async e => {
 		})
 
 		if (res.ok) {
-			window.location.href = 'http://192.168.209.1:8085'
+			const data = await res.json()
+			if (data.mfa_required && !(await completeMfaLogin(data.mfa_token))) {
+				return
+			}
+			afterLogin()
 		} else {
 			alert('Ошибка: логин или регистрация не удалась')
 		}
@@ -77,6 +147,97 @@ authForm.addEventListener('submit', async e => {
 	}
 })
 
+// Второй шаг входа: код из приложения-аутентификатора или резервный код
+async function completeMfaLogin(mfaToken) {
+	const code = prompt('Введите код из приложения-аутентификатора или резервный код')
+	if (!code) return false
+
+	const res = await fetch('http://192.168.209.1:8083/login/mfa', {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json' },
+		body: JSON.stringify({ mfa_token: mfaToken, code: code.trim() }),
+		credentials: 'include',
+	})
+	if (!res.ok) {
+		alert('Ошибка: неверный код')
+		return false
+	}
+	return true
+}
+
+// Вход по ключу доступа (passkey), без логина и пароля
+document.getElementById('passkey-btn').addEventListener('click', async () => {
+	if (!window.PublicKeyCredential) {
+		alert('Браузер не поддерживает ключи доступа')
+		return
+	}
+
+	try {
+		const beginRes = await fetch('http://192.168.209.1:8083/login/passkey/begin', {
+			method: 'POST',
+			credentials: 'include',
+		})
+		if (!beginRes.ok) {
+			alert('Ошибка: вход по ключу недоступен')
+			return
+		}
+		const { options, ceremony_token } = await beginRes.json()
+
+		const credential = await navigator.credentials.get(decodeRequestOptions(options))
+
+		const finishRes = await fetch('http://192.168.209.1:8083/login/passkey/finish', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ ceremony_token, credential: encodeAssertion(credential) }),
+			credentials: 'include',
+		})
+		if (finishRes.ok) {
+			afterLogin()
+		} else {
+			alert('Ошибка: ключ не принят')
+		}
+	} catch (err) {
+		// пользователь закрыл окно выбора ключа
+		console.error('Вход по ключу прерван:', err)
+	}
+})
+
+// Кнопки входа через внешние сервисы (OpenID Connect)
+async function loadOAuthProviders() {
+	try {
+		const res = await fetch('http://192.168.209.1:8083/oauth/providers')
+		const { providers } = await res.json()
+		const container = document.getElementById('oauth-providers')
+		for (const provider of providers) {
+			const link = document.createElement('a')
+			link.href = `http://192.168.209.1:8083/oauth/${encodeURIComponent(provider)}/start`
+			link.className =
+				'block w-full text-center border border-gray-300 hover:bg-gray-50 text-gray-700 font-semibold py-2 rounded-md transition-colors duration-200'
+			link.textContent = `Sign in with ${provider}`
+			container.append(link)
+		}
+	} catch (err) {
+		console.error('Не удалось загрузить провайдеров входа:', err)
+	}
+}
+
+// Восстановление пароля по email
+document.getElementById('forgot-link').addEventListener('click', async () => {
+	const email = prompt('Введите email, указанный при регистрации')
+	if (!email) return
+
+	try {
+		await fetch('http://192.168.209.1:8083/password/forgot', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ email: email.trim() }),
+		})
+		alert('Если такой email зарегистрирован, мы отправили на него ссылку')
+	} catch (err) {
+		alert('Сервер недоступен')
+	}
+})
+
 // Показать пароль при зажатии и скрыть при отпускании
 showPasswordArea.addEventListener('mousedown', () => {
 	passwordInput.type = 'text'
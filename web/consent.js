@@ -0,0 +1,54 @@
+const consentRequest = new URLSearchParams(window.location.search).get('request')
+const result = document.getElementById('result')
+
+const scopeDescriptions = {
+	openid: 'Узнать ваш идентификатор',
+	profile: 'Видеть имя пользователя',
+	email: 'Видеть ваш email',
+	offline_access: 'Сохранять доступ, когда вы не в сети',
+}
+
+async function loadConsent() {
+	const res = await fetch(`/api/oauth/consent?request=${encodeURIComponent(consentRequest)}`, {
+		credentials: 'include',
+	})
+	if (res.status === 401) {
+		window.location.href = '/'
+		return
+	}
+	const data = await res.json()
+	if (!res.ok) {
+		result.textContent = data.error
+		document.getElementById('approve-btn').disabled = true
+		return
+	}
+
+	document.getElementById('consent-title').textContent = `Authorize ${data.client_name}`
+	const scopeList = document.getElementById('scope-list')
+	for (const scope of data.scopes) {
+		const item = document.createElement('li')
+		item.textContent = scopeDescriptions[scope] || scope
+		scopeList.append(item)
+	}
+}
+
+async function answer(approved) {
+	const res = await fetch('/api/oauth/consent', {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json' },
+		body: JSON.stringify({ request: consentRequest, approved }),
+		credentials: 'include',
+	})
+	const data = await res.json()
+	if (!res.ok) {
+		result.textContent = data.error
+		return
+	}
+	// обратно в приложение, с кодом или с отказом
+	window.location.href = data.redirect_to
+}
+
+document.getElementById('approve-btn').addEventListener('click', () => answer(true))
+document.getElementById('deny-btn').addEventListener('click', () => answer(false))
+
+loadConsent()
@@ -0,0 +1,78 @@
+const passkeyList = document.getElementById('passkey-list')
+const result = document.getElementById('result')
+
+async function loadPasskeys() {
+	const res = await fetch('/api/me/passkeys', { credentials: 'include' })
+	if (res.status === 401) {
+		window.location.href = '/'
+		return
+	}
+	const passkeys = await res.json()
+
+	passkeyList.innerHTML = ''
+	if (passkeys.length === 0) {
+		passkeyList.innerHTML = '<li class="text-gray-500 text-center">Ключей пока нет</li>'
+	}
+	for (const passkey of passkeys) {
+		const item = document.createElement('li')
+		item.className = 'flex items-center justify-between border rounded-md px-3 py-2'
+
+		const label = document.createElement('span')
+		const lastUsed = passkey.last_used_at
+			? new Date(passkey.last_used_at).toLocaleString()
+			: 'не использовался'
+		label.textContent = `${passkey.name || 'Без названия'} · ${lastUsed}`
+
+		const removeBtn = document.createElement('button')
+		removeBtn.className = 'text-red-600 hover:underline text-sm'
+		removeBtn.textContent = 'Удалить'
+		removeBtn.addEventListener('click', () => removePasskey(passkey.id))
+
+		item.append(label, removeBtn)
+		passkeyList.append(item)
+	}
+}
+
+async function removePasskey(id) {
+	if (!confirm('Удалить ключ доступа?')) return
+
+	const res = await fetch(`/api/me/passkeys/${id}`, {
+		method: 'DELETE',
+		credentials: 'include',
+	})
+	result.textContent = res.ok ? 'Ключ удалён' : 'Ошибка: ключ не удалён'
+	await loadPasskeys()
+}
+
+document.getElementById('add-passkey-btn').addEventListener('click', async () => {
+	if (!window.PublicKeyCredential) {
+		result.textContent = 'Браузер не поддерживает ключи доступа'
+		return
+	}
+
+	try {
+		const beginRes = await fetch('/api/me/passkeys/register/begin', {
+			method: 'POST',
+			credentials: 'include',
+		})
+		const { options, ceremony_token } = await beginRes.json()
+
+		const credential = await navigator.credentials.create(decodeCreationOptions(options))
+		const name = prompt('Название ключа (например, «Ноутбук»)') || ''
+
+		const finishRes = await fetch('/api/me/passkeys/register/finish', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ ceremony_token, name, credential: encodeAttestation(credential) }),
+			credentials: 'include',
+		})
+		const body = await finishRes.json()
+
+		result.textContent = finishRes.ok ? 'Ключ добавлен' : `Ошибка: ${body.error}`
+		await loadPasskeys()
+	} catch (err) {
+		result.textContent = 'Добавление ключа прервано'
+	}
+})
+
+window.addEventListener('DOMContentLoaded', loadPasskeys)
@@ -0,0 +1,28 @@
+const resetForm = document.getElementById('reset-form')
+const result = document.getElementById('result')
+const token = new URLSearchParams(window.location.search).get('token')
+
+resetForm.addEventListener('submit', async e => {
+	e.preventDefault()
+
+	try {
+		const res = await fetch('/password/reset', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({
+				token,
+				new_password: resetForm.password.value,
+			}),
+		})
+		const body = await res.json()
+
+		if (res.ok) {
+			result.textContent = 'Пароль изменён, войдите заново'
+			setTimeout(() => (window.location.href = '/'), 1500)
+		} else {
+			result.textContent = `Ошибка: ${body.error}`
+		}
+	} catch (err) {
+		result.textContent = 'Сервер недоступен'
+	}
+})
@@ -0,0 +1,64 @@
+const sessionList = document.getElementById('session-list')
+const result = document.getElementById('result')
+
+async function loadSessions() {
+	const res = await fetch('/api/me/sessions', { credentials: 'include' })
+	if (res.status === 401) {
+		window.location.href = '/'
+		return
+	}
+	const sessions = await res.json()
+
+	sessionList.innerHTML = ''
+	for (const session of sessions) {
+		const item = document.createElement('li')
+		item.className = 'flex items-center justify-between border rounded-md px-3 py-2'
+
+		const label = document.createElement('span')
+		label.className = 'text-sm'
+		const lastSeen = new Date(session.last_seen_at).toLocaleString()
+		label.textContent = `${session.user_agent || 'Неизвестное устройство'} · ${session.ip} · ${lastSeen}`
+
+		item.append(label)
+		if (session.current) {
+			const current = document.createElement('span')
+			current.className = 'text-green-600 text-sm'
+			current.textContent = 'Это устройство'
+			item.append(current)
+		} else {
+			const removeBtn = document.createElement('button')
+			removeBtn.className = 'text-red-600 hover:underline text-sm'
+			removeBtn.textContent = 'Завершить'
+			removeBtn.addEventListener('click', () => terminateSession(session.id))
+			item.append(removeBtn)
+		}
+		sessionList.append(item)
+	}
+}
+
+async function terminateSession(id) {
+	if (!confirm('Завершить сеанс на этом устройстве?')) return
+
+	const res = await fetch(`/api/me/sessions/${id}`, {
+		method: 'DELETE',
+		credentials: 'include',
+	})
+	result.textContent = res.ok ? 'Сеанс завершён' : 'Ошибка: сеанс не завершён'
+	await loadSessions()
+}
+
+document.getElementById('revoke-all-btn').addEventListener('click', async () => {
+	if (!confirm('Выйти на всех устройствах, включая это?')) return
+
+	const res = await fetch('/api/sessions/revoke-all', {
+		method: 'POST',
+		credentials: 'include',
+	})
+	if (res.ok) {
+		window.location.href = '/'
+	} else {
+		result.textContent = 'Ошибка: не удалось завершить сеансы'
+	}
+})
+
+window.addEventListener('DOMContentLoaded', loadSessions)
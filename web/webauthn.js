@@ -0,0 +1,64 @@
+// Преобразования между JSON сервера (base64url) и ArrayBuffer для navigator.credentials
+
+function base64urlToBuffer(value) {
+	const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+	const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4)
+	return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer
+}
+
+function bufferToBase64url(buffer) {
+	const bytes = String.fromCharCode(...new Uint8Array(buffer))
+	return btoa(bytes).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+function decodeCreationOptions(options) {
+	const publicKey = options.publicKey
+	publicKey.challenge = base64urlToBuffer(publicKey.challenge)
+	publicKey.user.id = base64urlToBuffer(publicKey.user.id)
+	publicKey.excludeCredentials = (publicKey.excludeCredentials || []).map(c => ({
+		...c,
+		id: base64urlToBuffer(c.id),
+	}))
+	return options
+}
+
+function decodeRequestOptions(options) {
+	const publicKey = options.publicKey
+	publicKey.challenge = base64urlToBuffer(publicKey.challenge)
+	publicKey.allowCredentials = (publicKey.allowCredentials || []).map(c => ({
+		...c,
+		id: base64urlToBuffer(c.id),
+	}))
+	return options
+}
+
+function encodeAttestation(credential) {
+	return {
+		id: credential.id,
+		rawId: bufferToBase64url(credential.rawId),
+		type: credential.type,
+		authenticatorAttachment: credential.authenticatorAttachment,
+		response: {
+			clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+			attestationObject: bufferToBase64url(credential.response.attestationObject),
+			transports: credential.response.getTransports ? credential.response.getTransports() : [],
+		},
+	}
+}
+
+function encodeAssertion(credential) {
+	return {
+		id: credential.id,
+		rawId: bufferToBase64url(credential.rawId),
+		type: credential.type,
+		authenticatorAttachment: credential.authenticatorAttachment,
+		response: {
+			clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+			authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+			signature: bufferToBase64url(credential.response.signature),
+			userHandle: credential.response.userHandle
+				? bufferToBase64url(credential.response.userHandle)
+				: null,
+		},
+	}
+}